@@ -0,0 +1,95 @@
+package metadatacontroller
+
+import (
+	"context"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// BatchOp is the kind of an operation of a batch.
+type BatchOp string
+
+// Operations of a batch.
+const (
+	BatchExamine    BatchOp = "examine"
+	BatchCreateTree BatchOp = "createtree"
+	BatchMove       BatchOp = "move"
+	BatchCopy       BatchOp = "copy"
+	BatchDelete     BatchOp = "delete"
+)
+
+// BatchOperation is an operation of a batch.
+type BatchOperation struct {
+	Op       BatchOp
+	PathSpec string
+	// TargetPathSpec is the path an object is moved or copied to.
+	TargetPathSpec string `json:",omitempty"`
+	// Recursive creates the missing parent trees of a tree.
+	Recursive bool `json:",omitempty"`
+}
+
+// BatchResult is the outcome of an operation of a batch.
+type BatchResult struct {
+	// ObjectInfo is the object examined.
+	ObjectInfo *entities.ObjectInfo
+	Err        error
+}
+
+// Batcher is implemented by controllers applying a batch of
+// operations atomically, in a single transaction.
+type Batcher interface {
+	// ApplyBatch applies ops in order like ApplyBatch. If one fails,
+	// none is applied. The error is only set if the transaction fails.
+	ApplyBatch(ctx context.Context, user *entities.User, ops []*BatchOperation) ([]*BatchResult, error)
+}
+
+// ApplyOperation applies op with c.
+func ApplyOperation(ctx context.Context, c ContextMetaDataController, user *entities.User, op *BatchOperation) *BatchResult {
+	res := &BatchResult{}
+	switch op.Op {
+	case BatchExamine:
+		res.ObjectInfo, res.Err = c.ExamineObjectContext(ctx, user, op.PathSpec)
+	case BatchCreateTree:
+		res.Err = c.CreateTreeContext(ctx, user, op.PathSpec, op.Recursive)
+	case BatchMove:
+		res.Err = c.MoveObjectContext(ctx, user, op.PathSpec, op.TargetPathSpec)
+	case BatchCopy:
+		res.Err = c.CopyObjectContext(ctx, user, op.PathSpec, op.TargetPathSpec)
+	case BatchDelete:
+		res.Err = c.DeleteObjectContext(ctx, user, op.PathSpec)
+	default:
+		res.Err = codes.NewErr(codes.BadInputData, "unknown operation "+string(op.Op))
+	}
+	return res
+}
+
+// ApplyBatch applies ops in order with c and stops at the first failure.
+// It returns the results of the operations applied, the last one being
+// the failure if any. Transactional controllers call it with a controller
+// bound to the transaction to implement Batcher.
+func ApplyBatch(ctx context.Context, c ContextMetaDataController, user *entities.User, ops []*BatchOperation) []*BatchResult {
+	var results []*BatchResult
+	for _, op := range ops {
+		res := ApplyOperation(ctx, c, user, op)
+		results = append(results, res)
+		if res.Err != nil {
+			break
+		}
+	}
+	return results
+}
+
+// BatchFailed reports whether the batch of results stopped at a failure.
+func BatchFailed(results []*BatchResult) bool {
+	return len(results) > 0 && results[len(results)-1].Err != nil
+}
+
+// batchChanges are the changes recorded for
+// the operations of a batch applied.
+var batchChanges = map[BatchOp]ChangeOp{
+	BatchCreateTree: ChangeCreate,
+	BatchMove:       ChangeMove,
+	BatchCopy:       ChangeCopy,
+	BatchDelete:     ChangeDelete,
+}
@@ -0,0 +1,728 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	metadatacontroller.Register("bolt", func(opts map[string]string) (metadatacontroller.MetaDataController, error) {
+		return New(&Options{Path: opts["Path"]})
+	})
+}
+
+// rootKey is the key of the home tree of an user.
+var rootKey = []byte("/")
+
+type controller struct {
+	db *bolt.DB
+	// tx is the transaction of the batch applied, if any,
+	// in which every operation is done.
+	tx *bolt.Tx
+}
+
+// record is the value stored for every object of the namespace.
+type record struct {
+	Type     entities.ObjectType `json:"type"`
+	Size     int64               `json:"size"`
+	Checksum string              `json:"checksum"`
+	ModTime  int64               `json:"modtime"`
+	ETag     string              `json:"etag,omitempty"`
+	// Properties are kept in the record so they are moved,
+	// copied and deleted with the object.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// New returns an implementation of MetaDataController that keeps
+// the namespace of every user in a bucket of a BoltDB database. The
+// controller implements io.Closer, to close the database.
+func New(opts *Options) (metadatacontroller.MetaDataController, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	db, err := bolt.Open(opts.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &controller{db: db}, nil
+}
+
+// Close closes the database, after which the controller cannot be used.
+func (c *controller) Close() error {
+	return c.db.Close()
+}
+
+// Options hold the configuration options for the
+// BoltMetaDataController.
+type Options struct {
+	// Path is the location of the database file.
+	Path string
+}
+
+func (c *controller) Init(user *entities.User) error {
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(user.Username))
+		if err != nil {
+			return err
+		}
+		if b.Get(rootKey) != nil {
+			return nil
+		}
+		return putRecord(b, rootKey, newTree())
+	})
+}
+
+func (c *controller) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	p := cleanPath(pathSpec)
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		rec, err := getRecord(b, key(p))
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			if recursive && rec.Type == entities.ObjectTypeTree {
+				return nil
+			} else if recursive {
+				return codes.NewErr(codes.BadInputData, "object is not a tree")
+			}
+			return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+		}
+		if !recursive {
+			if err := checkParent(b, p); err != nil {
+				return err
+			}
+			if err := putRecord(b, key(p), newTree()); err != nil {
+				return err
+			}
+			return touchAncestors(b, p)
+		}
+
+		// create the missing trees from the top most one.
+		var missing []string
+		for p := p; p != "/"; p = path.Dir(p) {
+			rec, err := getRecord(b, key(p))
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				if rec.Type != entities.ObjectTypeTree {
+					return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+				}
+				break
+			}
+			missing = append(missing, p)
+		}
+		for i := len(missing) - 1; i >= 0; i-- {
+			if err := putRecord(b, key(missing[i]), newTree()); err != nil {
+				return err
+			}
+		}
+		return touchAncestors(b, p)
+	})
+}
+
+func (c *controller) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	return c.ExamineObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) (*entities.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var oinfo *entities.ObjectInfo
+	err := c.view(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		rec, err := getRecord(b, key(cleanPath(pathSpec)))
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return codes.NewErr(codes.NotFound, "object not found")
+		}
+		if err := cond.Check(rec.ETag, true); err != nil {
+			return err
+		}
+		oinfo = getObjectInfo(pathSpec, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oinfo, nil
+}
+
+func (c *controller) ListTree(user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.ListTreeIf(context.Background(), user, pathSpec, opts, nil)
+}
+
+func (c *controller) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, cond *metadatacontroller.Condition) ([]*entities.ObjectInfo, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	pos, err := opts.Position()
+	if err != nil {
+		return nil, "", err
+	}
+	depth, err := opts.GetDepth()
+	if err != nil {
+		return nil, "", err
+	}
+	var oinfos []*entities.ObjectInfo
+	var next string
+	err = c.view(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		rec, err := getRecord(b, key(cleanPath(pathSpec)))
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return codes.NewErr(codes.NotFound, "object not found")
+		}
+		if err := cond.Check(rec.ETag, true); err != nil {
+			return err
+		}
+		if rec.Type != entities.ObjectTypeTree {
+			return codes.NewErr(codes.BadInputData, "object is not a tree")
+		}
+		if pos.Order() != metadatacontroller.SortByName || depth != 1 {
+			oinfos, next, err = metadatacontroller.Walk(pathSpec, opts, func(pathSpec string) ([]*entities.ObjectInfo, error) {
+				return readChildren(b, pathSpec, "", 0)
+			})
+			return err
+		}
+
+		// keys are sorted by name, so a page in name order
+		// is read without visiting the previous entries.
+		limit := 0
+		if opts != nil && opts.Limit > 0 {
+			limit = opts.Limit + 1
+		}
+		oinfos, err = readChildren(b, pathSpec, pos.Name(), limit)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && len(oinfos) == limit {
+			oinfos = oinfos[:len(oinfos)-1]
+			next = pos.NextCursor(oinfos[len(oinfos)-1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return oinfos, next, nil
+}
+
+func (c *controller) DeleteObject(user *entities.User, pathSpec string) error {
+	return c.DeleteObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p := cleanPath(pathSpec)
+	if p == "/" {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be deleted")
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		if err := checkCondition(b, p, cond); err != nil {
+			return err
+		}
+		if b.Get(key(p)) == nil {
+			return codes.NewErr(codes.NotFound, "object not found")
+		}
+		if err := deleteObject(b, p); err != nil {
+			return err
+		}
+		return touchAncestors(b, p)
+	})
+}
+
+func (c *controller) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.MoveObjectIf(context.Background(), user, sourcePathSpec, targetPathSpec, nil)
+}
+
+func (c *controller) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	if source == "/" {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be moved")
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(target, source+"/") {
+			return codes.NewErr(codes.BadInputData, "object cannot be moved inside itself")
+		}
+		if err := checkCondition(b, source, cond); err != nil {
+			return err
+		}
+		objects, err := c.prepareTransfer(b, source, target)
+		if err != nil {
+			return err
+		}
+		if source == target {
+			return nil
+		}
+		if err := deleteObject(b, source); err != nil {
+			return err
+		}
+		for p, rec := range objects {
+			if err := putRecord(b, key(path.Join(target, p)), rec); err != nil {
+				return err
+			}
+		}
+		if err := touchAncestors(b, source); err != nil {
+			return err
+		}
+		return touchAncestors(b, target)
+	})
+}
+
+func (c *controller) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		objects, err := c.prepareTransfer(b, source, target)
+		if err != nil {
+			return err
+		}
+		modTime, etag := now(), metadatacontroller.NewETag()
+		for p, rec := range objects {
+			rec.ModTime = modTime
+			rec.ETag = etag
+			if err := putRecord(b, key(path.Join(target, p)), rec); err != nil {
+				return err
+			}
+		}
+		return touchAncestors(b, target)
+	})
+}
+
+func (c *controller) PutBLOB(user *entities.User, pathSpec string, size int64, checksum string) error {
+	p := cleanPath(pathSpec)
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		if err := checkParent(b, p); err != nil {
+			return err
+		}
+		rec, err := getRecord(b, key(p))
+		if err != nil {
+			return err
+		}
+		if rec != nil && rec.Type == entities.ObjectTypeTree {
+			return codes.NewErr(codes.BadInputData, "object is a tree")
+		}
+		blob := &record{
+			Type:     entities.ObjectTypeBLOB,
+			Size:     size,
+			Checksum: checksum,
+			ModTime:  now(),
+			ETag:     metadatacontroller.NewETag(),
+		}
+		if rec != nil {
+			blob.Properties = rec.Properties
+		}
+		if err := putRecord(b, key(p), blob); err != nil {
+			return err
+		}
+		return touchAncestors(b, p)
+	})
+}
+
+func (c *controller) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	if err := metadatacontroller.CheckProperties(props); err != nil {
+		return err
+	}
+	return c.updateRecord(user, pathSpec, func(rec *record) {
+		if rec.Properties == nil {
+			rec.Properties = map[string]string{}
+		}
+		for k, v := range props {
+			rec.Properties[k] = v
+		}
+	})
+}
+
+func (c *controller) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	props := map[string]string{}
+	err := c.view(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		rec, err := getRecord(b, key(cleanPath(pathSpec)))
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return codes.NewErr(codes.NotFound, "object not found")
+		}
+		for k, v := range rec.Properties {
+			props[k] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (c *controller) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	if err := metadatacontroller.CheckPropertyKeys(keys...); err != nil {
+		return err
+	}
+	return c.updateRecord(user, pathSpec, func(rec *record) {
+		for _, k := range keys {
+			delete(rec.Properties, k)
+		}
+	})
+}
+
+// updateRecord applies fn to the record of the object at pathSpec.
+func (c *controller) updateRecord(user *entities.User, pathSpec string, fn func(rec *record)) error {
+	k := key(cleanPath(pathSpec))
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := getBucket(tx, user)
+		if err != nil {
+			return err
+		}
+		rec, err := getRecord(b, k)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return codes.NewErr(codes.NotFound, "object not found")
+		}
+		fn(rec)
+		return putRecord(b, k, rec)
+	})
+}
+
+// prepareTransfer checks that the object at source can be moved or copied
+// to target, removes the object being replaced at target if any and returns
+// the records of the source object and its descendants keyed by their path
+// relative to source.
+func (c *controller) prepareTransfer(b *bolt.Bucket, source, target string) (map[string]*record, error) {
+	rec, err := getRecord(b, key(source))
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, codes.NewErr(codes.NotFound, "source object not found")
+	}
+	if target == "/" {
+		return nil, codes.NewErr(codes.BadInputData, "root tree cannot be replaced")
+	}
+	if err := checkParent(b, target); err != nil {
+		return nil, err
+	}
+	objects := map[string]*record{"/": rec}
+	err = walk(b, source, func(p string, rec *record) error {
+		objects[strings.TrimPrefix(p, source)] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if source == target {
+		return objects, nil
+	}
+
+	targetRec, err := getRecord(b, key(target))
+	if err != nil {
+		return nil, err
+	}
+	if targetRec == nil {
+		return objects, nil
+	}
+	if targetRec.Type != rec.Type {
+		return nil, codes.NewErr(codes.BadInputData, "target object has a different type")
+	}
+	if targetRec.Type == entities.ObjectTypeTree {
+		cur := b.Cursor()
+		prefix := childrenPrefix(target)
+		if k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) {
+			return nil, codes.NewErr(codes.BadInputData, "target tree is not empty")
+		}
+	}
+	if err := b.Delete(key(target)); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// deleteObject removes the object at p and all its descendants.
+func deleteObject(b *bolt.Bucket, p string) error {
+	var keys [][]byte
+	err := walk(b, p, func(p string, rec *record) error {
+		keys = append(keys, key(p))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	keys = append(keys, key(p))
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCondition checks cond on the object at p, if cond is not nil,
+// before changing it.
+func checkCondition(b *bolt.Bucket, p string, cond *metadatacontroller.Condition) error {
+	if cond == nil {
+		return nil
+	}
+	rec, err := getRecord(b, key(p))
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return codes.NewErr(codes.NotFound, "object not found")
+	}
+	return cond.Check(rec.ETag, false)
+}
+
+// touchAncestors gives a new ETag to the trees from
+// the parent of p up to the home tree.
+func touchAncestors(b *bolt.Bucket, p string) error {
+	etag := metadatacontroller.NewETag()
+	for p != "/" {
+		p = path.Dir(p)
+		rec, err := getRecord(b, key(p))
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			continue
+		}
+		rec.ETag = etag
+		if err := putRecord(b, key(p), rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every descendant of the tree at p.
+// The children of p are stored under the prefix "p\x00" and
+// the rest of descendants under the prefix "p/".
+func walk(b *bolt.Bucket, p string, fn func(p string, rec *record) error) error {
+	prefixes := [][]byte{childrenPrefix(p), []byte(p + "/")}
+	if p == "/" {
+		prefixes = [][]byte{[]byte("/")}
+	}
+	for _, prefix := range prefixes {
+		cur := b.Cursor()
+		for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+			if bytes.Equal(k, rootKey) {
+				continue
+			}
+			rec := &record{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			if err := fn(keyPath(k), rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkParent checks that the parent of p exists and is a tree.
+func checkParent(b *bolt.Bucket, p string) error {
+	rec, err := getRecord(b, key(path.Dir(p)))
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return codes.NewErr(codes.NotFound, "parent tree not found")
+	}
+	if rec.Type != entities.ObjectTypeTree {
+		return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+	}
+	return nil
+}
+
+// readChildren returns, in name order, up to limit children of the tree
+// at pathSpec whose names are after the name given, or all of them
+// if limit is 0.
+func readChildren(b *bolt.Bucket, pathSpec, after string, limit int) ([]*entities.ObjectInfo, error) {
+	prefix := childrenPrefix(cleanPath(pathSpec))
+	cur := b.Cursor()
+	k, v := cur.Seek(append(append([]byte{}, prefix...), after...))
+	if k != nil && after != "" && string(k[len(prefix):]) == after {
+		k, v = cur.Next()
+	}
+	var oinfos []*entities.ObjectInfo
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+		if limit > 0 && len(oinfos) == limit {
+			break
+		}
+		rec := &record{}
+		if err := json.Unmarshal(v, rec); err != nil {
+			return nil, err
+		}
+		name := string(k[len(prefix):])
+		oinfos = append(oinfos, getObjectInfo(path.Join(pathSpec, name), rec))
+	}
+	return oinfos, nil
+}
+
+// errBatchFailed rolls back the transaction of a batch.
+var errBatchFailed = errors.New("batch failed")
+
+func (c *controller) ApplyBatch(ctx context.Context, user *entities.User, ops []*metadatacontroller.BatchOperation) ([]*metadatacontroller.BatchResult, error) {
+	var results []*metadatacontroller.BatchResult
+	err := c.update(func(tx *bolt.Tx) error {
+		batch := &controller{db: c.db, tx: tx}
+		results = metadatacontroller.ApplyBatch(ctx, metadatacontroller.WithContext(batch), user, ops)
+		if metadatacontroller.BatchFailed(results) {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && err != errBatchFailed {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *controller) update(fn func(tx *bolt.Tx) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+	return c.db.Update(fn)
+}
+
+func (c *controller) view(fn func(tx *bolt.Tx) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+	return c.db.View(fn)
+}
+
+func getBucket(tx *bolt.Tx, user *entities.User) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(user.Username))
+	if b == nil {
+		return nil, codes.NewErr(codes.NotFound, "user home tree not found")
+	}
+	return b, nil
+}
+
+func getRecord(b *bolt.Bucket, k []byte) (*record, error) {
+	v := b.Get(k)
+	if v == nil {
+		return nil, nil
+	}
+	rec := &record{}
+	if err := json.Unmarshal(v, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func putRecord(b *bolt.Bucket, k []byte, rec *record) error {
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, v)
+}
+
+func getObjectInfo(pathSpec string, rec *record) *entities.ObjectInfo {
+	oinfo := &entities.ObjectInfo{
+		PathSpec: pathSpec,
+		Size:     rec.Size,
+		Type:     rec.Type,
+		Checksum: rec.Checksum,
+		ModTime:  rec.ModTime,
+	}
+	if rec.Type == entities.ObjectTypeTree {
+		oinfo.MimeType = entities.ObjectTypeTreeMimeType
+	} else {
+		oinfo.MimeType = mime.TypeByExtension(path.Ext(pathSpec))
+	}
+	metadatacontroller.SetETag(oinfo, rec.ETag)
+	return oinfo
+}
+
+func newTree() *record {
+	return &record{Type: entities.ObjectTypeTree, ModTime: now(), ETag: metadatacontroller.NewETag()}
+}
+
+// key returns the key under which the object at p is stored.
+// Keys are made of the parent path and the base name separated by a zero
+// byte, so the children of a tree are stored next to each other and are
+// listed with a prefix scan without visiting deeper descendants.
+func key(p string) []byte {
+	if p == "/" {
+		return rootKey
+	}
+	return []byte(path.Dir(p) + "\x00" + path.Base(p))
+}
+
+// keyPath is the inverse of key.
+func keyPath(k []byte) string {
+	parts := strings.SplitN(string(k), "\x00", 2)
+	if len(parts) != 2 {
+		return "/"
+	}
+	return path.Join(parts[0], parts[1])
+}
+
+func childrenPrefix(p string) []byte {
+	return []byte(p + "\x00")
+}
+
+// cleanPath returns the absolute clean form of pathSpec, avoiding
+// path traversal outside of the user namespace.
+func cleanPath(pathSpec string) string {
+	return path.Join("/", pathSpec)
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
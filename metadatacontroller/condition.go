@@ -0,0 +1,61 @@
+package metadatacontroller
+
+import (
+	"context"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// AnyETag matches the ETag of any existing object in a Condition.
+const AnyETag = "*"
+
+// Condition is a precondition on the ETag of an object, like the
+// If-Match and If-None-Match headers of HTTP.
+type Condition struct {
+	// IfMatch, if not empty, are the ETags the object must have one of.
+	IfMatch []string
+	// IfNoneMatch, if not empty, are the ETags the object must not have.
+	IfNoneMatch []string
+}
+
+// Check returns a PreconditionFailed error if cond does not hold for an
+// object with the given ETag. Reads matching IfNoneMatch return a
+// NotModified error instead. A nil Condition always holds.
+func (cond *Condition) Check(etag string, read bool) error {
+	if cond == nil {
+		return nil
+	}
+	if len(cond.IfMatch) > 0 && !matchETag(cond.IfMatch, etag) {
+		return codes.NewErr(PreconditionFailed, "object does not have any of the ETags given")
+	}
+	if len(cond.IfNoneMatch) > 0 && matchETag(cond.IfNoneMatch, etag) {
+		if read {
+			return codes.NewErr(NotModified, "object has not been modified")
+		}
+		return codes.NewErr(PreconditionFailed, "object has one of the ETags given")
+	}
+	return nil
+}
+
+func matchETag(etags []string, etag string) bool {
+	for _, e := range etags {
+		if e == AnyETag || (e == etag && etag != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionalController is implemented by controllers that check a
+// Condition on the ETag of an object in the same step as the operation,
+// so no other change can happen in between. Objects that do not exist
+// are reported as not found before checking the condition.
+type ConditionalController interface {
+	ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *Condition) (*entities.ObjectInfo, error)
+	// ListTreeIf checks cond on the tree at pathSpec.
+	ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions, cond *Condition) ([]*entities.ObjectInfo, string, error)
+	DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *Condition) error
+	// MoveObjectIf checks cond on the source object.
+	MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *Condition) error
+}
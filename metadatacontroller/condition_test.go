@@ -0,0 +1,25 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCondition_Check(t *testing.T) {
+	var cond *Condition
+	require.Nil(t, cond.Check("a", false))
+
+	cond = &Condition{IfMatch: []string{"a", "b"}}
+	require.Nil(t, cond.Check("b", false))
+	requireCode(t, PreconditionFailed, cond.Check("c", false))
+	requireCode(t, PreconditionFailed, cond.Check("c", true))
+	require.Nil(t, (&Condition{IfMatch: []string{AnyETag}}).Check("c", false))
+	requireCode(t, PreconditionFailed, (&Condition{IfMatch: []string{""}}).Check("", false))
+
+	cond = &Condition{IfNoneMatch: []string{"a"}}
+	require.Nil(t, cond.Check("b", false))
+	requireCode(t, PreconditionFailed, cond.Check("a", false))
+	requireCode(t, NotModified, cond.Check("a", true))
+	requireCode(t, NotModified, (&Condition{IfNoneMatch: []string{AnyETag}}).Check("b", true))
+}
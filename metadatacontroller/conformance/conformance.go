@@ -0,0 +1,761 @@
+// Package conformance provides a test suite that checks the behaviour
+// every MetaDataController implementation must have.
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+// Backend is an instance of a MetaDataController under test.
+type Backend struct {
+	// Controller is a MetaDataController without any user initialized.
+	Controller metadatacontroller.MetaDataController
+
+	// PutBLOB creates or overwrites the BLOB at pathSpec with size bytes.
+	// If it is nil, Controller must implement metadatacontroller.BLOBPutter.
+	PutBLOB func(user *entities.User, pathSpec string, size int64) error
+
+	// Cleanup, if not nil, releases the resources of the backend
+	// once the test has finished.
+	Cleanup func()
+}
+
+// Factory returns a new Backend for every test of the suite.
+type Factory func(t *testing.T) *Backend
+
+var (
+	user      = &entities.User{Username: "test"}
+	otherUser = &entities.User{Username: "other"}
+)
+
+type test struct {
+	name string
+	fn   func(t *testing.T, b *Backend)
+}
+
+var tests = []test{
+	{"Init", testInit},
+	{"Init_isIdempotent", testInitIsIdempotent},
+	{"CreateTree", testCreateTree},
+	{"CreateTree_withAlreadyExists", testCreateTreeWithAlreadyExists},
+	{"CreateTree_withParentNotFound", testCreateTreeWithParentNotFound},
+	{"CreateTree_withParentBLOB", testCreateTreeWithParentBLOB},
+	{"CreateTree_recursive", testCreateTreeRecursive},
+	{"ExamineObject", testExamineObject},
+	{"ExamineObject_withNotFound", testExamineObjectWithNotFound},
+	{"ListTree", testListTree},
+	{"ListTree_withNotFound", testListTreeWithNotFound},
+	{"ListTree_withBLOB", testListTreeWithBLOB},
+	{"ListTree_paginated", testListTreePaginated},
+	{"ListTree_sortedBySize", testListTreeSortedBySize},
+	{"ListTree_sortedByType", testListTreeSortedByType},
+	{"ListTree_withUnknownSort", testListTreeWithUnknownSort},
+	{"ListTree_withInvalidCursor", testListTreeWithInvalidCursor},
+	{"ListTree_recursive", testListTreeRecursive},
+	{"ListTree_recursivePaginated", testListTreeRecursivePaginated},
+	{"ListTree_withInvalidDepth", testListTreeWithInvalidDepth},
+	{"DeleteObject", testDeleteObject},
+	{"DeleteObject_withNotFound", testDeleteObjectWithNotFound},
+	{"DeleteObject_withRoot", testDeleteObjectWithRoot},
+	{"MoveObject", testMoveObject},
+	{"MoveObject_withTree", testMoveObjectWithTree},
+	{"MoveObject_withSourceNotFound", testMoveObjectWithSourceNotFound},
+	{"MoveObject_withTargetParentNotFound", testMoveObjectWithTargetParentNotFound},
+	{"MoveObject_overExistingBLOB", testMoveObjectOverExistingBLOB},
+	{"MoveObject_BLOBOverExistingTree", testMoveObjectBLOBOverExistingTree},
+	{"MoveObject_treeOverExistingBLOB", testMoveObjectTreeOverExistingBLOB},
+	{"MoveObject_intoItself", testMoveObjectIntoItself},
+	{"MoveObject_withRoot", testMoveObjectWithRoot},
+	{"CopyObject", testCopyObject},
+	{"CopyObject_withSourceNotFound", testCopyObjectWithSourceNotFound},
+	{"CopyObject_withTargetParentNotFound", testCopyObjectWithTargetParentNotFound},
+	{"CopyObject_intoItself", testCopyObjectIntoItself},
+	{"SetProperties", testSetProperties},
+	{"SetProperties_withNotFound", testSetPropertiesWithNotFound},
+	{"SetProperties_withInvalidKey", testSetPropertiesWithInvalidKey},
+	{"RemoveProperties", testRemoveProperties},
+	{"Properties_movedWithObject", testPropertiesMovedWithObject},
+	{"Properties_copiedWithObject", testPropertiesCopiedWithObject},
+	{"Properties_deletedWithObject", testPropertiesDeletedWithObject},
+	{"ETag", testETag},
+	{"ETag_propagated", testETagPropagated},
+	{"ETag_propagatedByPutBLOB", testETagPropagatedByPutBLOB},
+	{"Condition_read", testConditionRead},
+	{"Condition_delete", testConditionDelete},
+	{"Condition_move", testConditionMove},
+	{"Batch", testBatch},
+	{"Batch_rolledBack", testBatchRolledBack},
+	{"UserIsolation", testUserIsolation},
+}
+
+// RunSuite runs the conformance tests against the backends returned by factory.
+func RunSuite(t *testing.T, factory Factory) {
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := factory(t)
+			if b.Cleanup != nil {
+				defer b.Cleanup()
+			}
+			if b.PutBLOB == nil {
+				putter, ok := b.Controller.(metadatacontroller.BLOBPutter)
+				require.True(t, ok, "controller does not implement BLOBPutter")
+				b.PutBLOB = func(user *entities.User, pathSpec string, size int64) error {
+					return putter.PutBLOB(user, pathSpec, size, "")
+				}
+			}
+			require.Nil(t, b.Controller.Init(user))
+			tt.fn(t, b)
+		})
+	}
+}
+
+// RequireCode checks that err is a *codes.Err with the given code.
+func RequireCode(t *testing.T, code codes.Code, err error) {
+	require.NotNil(t, err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(t, ok, "error is not a *codes.Err: %#v", err)
+	require.Equal(t, code, codeErr.Code, codeErr.Message)
+}
+
+func testInit(t *testing.T, b *Backend) {
+	info, err := b.Controller.ExamineObject(user, "/")
+	require.Nil(t, err)
+	require.Equal(t, entities.ObjectTypeTree, info.Type)
+	infos, _, err := b.Controller.ListTree(user, "/", nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(infos))
+}
+
+func testInitIsIdempotent(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.Init(user))
+	_, err := b.Controller.ExamineObject(user, "myblob")
+	require.Nil(t, err)
+}
+
+func testCreateTree(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	info, err := b.Controller.ExamineObject(user, "mytree")
+	require.Nil(t, err)
+	require.Equal(t, entities.ObjectTypeTree, info.Type)
+	require.Equal(t, entities.ObjectTypeTreeMimeType, info.MimeType)
+}
+
+func testCreateTreeWithAlreadyExists(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	RequireCode(t, metadatacontroller.AlreadyExists, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	RequireCode(t, metadatacontroller.AlreadyExists, b.Controller.CreateTree(user, "myblob", false))
+}
+
+func testCreateTreeWithParentNotFound(t *testing.T, b *Backend) {
+	RequireCode(t, codes.NotFound, b.Controller.CreateTree(user, "notexists/mytree", false))
+}
+
+func testCreateTreeWithParentBLOB(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	RequireCode(t, codes.BadInputData, b.Controller.CreateTree(user, "myblob/mytree", true))
+	RequireCode(t, codes.BadInputData, b.Controller.CreateTree(user, "myblob", true))
+}
+
+func testCreateTreeRecursive(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "a/b/c", true))
+	for _, p := range []string{"a", "a/b", "a/b/c"} {
+		info, err := b.Controller.ExamineObject(user, p)
+		require.Nil(t, err)
+		require.Equal(t, entities.ObjectTypeTree, info.Type)
+	}
+	require.Nil(t, b.Controller.CreateTree(user, "a/b/c", true))
+}
+
+func testExamineObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob.pdf", 1))
+	info, err := b.Controller.ExamineObject(user, "myblob.pdf")
+	require.Nil(t, err)
+	require.Equal(t, "myblob.pdf", info.PathSpec)
+	require.Equal(t, int64(1), info.Size)
+	require.Equal(t, entities.ObjectTypeBLOB, info.Type)
+	require.Equal(t, "application/pdf", info.MimeType)
+	require.NotEqual(t, int64(0), info.ModTime)
+}
+
+func testExamineObjectWithNotFound(t *testing.T, b *Backend) {
+	_, err := b.Controller.ExamineObject(user, "notexists")
+	RequireCode(t, codes.NotFound, err)
+}
+
+func testListTree(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree/deeptree", true))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	infos, _, err := b.Controller.ListTree(user, "mytree", nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(infos))
+	pathSpecs := []string{infos[0].PathSpec, infos[1].PathSpec}
+	require.Contains(t, pathSpecs, "mytree/myblob")
+	require.Contains(t, pathSpecs, "mytree/othertree")
+}
+
+func testListTreeWithNotFound(t *testing.T, b *Backend) {
+	_, _, err := b.Controller.ListTree(user, "notexists", nil)
+	RequireCode(t, codes.NotFound, err)
+}
+
+func testListTreeWithBLOB(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	_, _, err := b.Controller.ListTree(user, "myblob", nil)
+	RequireCode(t, codes.BadInputData, err)
+}
+
+func testListTreePaginated(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	for _, name := range []string{"e", "c", "a", "d"} {
+		require.Nil(t, b.PutBLOB(user, "mytree/"+name, 1))
+	}
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/b", false))
+	opts := &metadatacontroller.ListOptions{Limit: 2}
+	var pages [][]string
+	for {
+		infos, next, err := b.Controller.ListTree(user, "mytree", opts)
+		require.Nil(t, err)
+		pages = append(pages, pathSpecs(infos))
+		if next == "" {
+			break
+		}
+		require.True(t, len(pages) < 5, "too many pages")
+		opts.Cursor = next
+	}
+	require.Equal(t, [][]string{
+		{"mytree/a", "mytree/b"},
+		{"mytree/c", "mytree/d"},
+		{"mytree/e"},
+	}, pages)
+}
+
+func testListTreeSortedBySize(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	sizes := map[string]int64{"a": 3, "b": 1, "c": 2, "d": 1}
+	for name, size := range sizes {
+		require.Nil(t, b.PutBLOB(user, "mytree/"+name, size))
+	}
+	opts := &metadatacontroller.ListOptions{Limit: 3, Sort: metadatacontroller.SortBySize}
+	infos, next, err := b.Controller.ListTree(user, "mytree", opts)
+	require.Nil(t, err)
+	require.Equal(t, []string{"mytree/b", "mytree/d", "mytree/c"}, pathSpecs(infos))
+	require.NotEqual(t, "", next)
+	opts.Cursor = next
+	infos, last, err := b.Controller.ListTree(user, "mytree", opts)
+	require.Nil(t, err)
+	require.Equal(t, []string{"mytree/a"}, pathSpecs(infos))
+	require.Equal(t, "", last)
+
+	// a cursor cannot be used with a different sort order.
+	opts.Sort = metadatacontroller.SortByName
+	_, _, err = b.Controller.ListTree(user, "mytree", opts)
+	RequireCode(t, codes.BadInputData, err)
+}
+
+func testListTreeSortedByType(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/c", 1))
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/b", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/a", 1))
+	opts := &metadatacontroller.ListOptions{Sort: metadatacontroller.SortByType}
+	infos, next, err := b.Controller.ListTree(user, "mytree", opts)
+	require.Nil(t, err)
+	require.Equal(t, "", next)
+	blobs, trees := []string{"mytree/a", "mytree/c"}, []string{"mytree/b"}
+	if entities.ObjectTypeBLOB < entities.ObjectTypeTree {
+		require.Equal(t, append(blobs, trees...), pathSpecs(infos))
+	} else {
+		require.Equal(t, append(trees, blobs...), pathSpecs(infos))
+	}
+}
+
+func testListTreeWithUnknownSort(t *testing.T, b *Backend) {
+	opts := &metadatacontroller.ListOptions{Sort: "color"}
+	_, _, err := b.Controller.ListTree(user, "/", opts)
+	RequireCode(t, codes.BadInputData, err)
+}
+
+func testListTreeWithInvalidCursor(t *testing.T, b *Backend) {
+	opts := &metadatacontroller.ListOptions{Cursor: "not a cursor"}
+	_, _, err := b.Controller.ListTree(user, "/", opts)
+	RequireCode(t, codes.BadInputData, err)
+}
+
+// createNestedTree creates the following tree:
+// mytree/a/, mytree/a/x, mytree/a/y/, mytree/a/y/z, mytree/b, mytree/c/.
+func createNestedTree(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/a/y", true))
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/c", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/a/x", 1))
+	require.Nil(t, b.PutBLOB(user, "mytree/a/y/z", 1))
+	require.Nil(t, b.PutBLOB(user, "mytree/b", 1))
+}
+
+func testListTreeRecursive(t *testing.T, b *Backend) {
+	createNestedTree(t, b)
+	opts := &metadatacontroller.ListOptions{Depth: metadatacontroller.DepthInfinity}
+	infos, next, err := b.Controller.ListTree(user, "mytree", opts)
+	require.Nil(t, err)
+	require.Equal(t, "", next)
+	require.Equal(t, []string{
+		"mytree/a", "mytree/a/x", "mytree/a/y", "mytree/a/y/z", "mytree/b", "mytree/c",
+	}, pathSpecs(infos))
+
+	opts.Depth = 2
+	infos, next, err = b.Controller.ListTree(user, "mytree", opts)
+	require.Nil(t, err)
+	require.Equal(t, "", next)
+	require.Equal(t, []string{
+		"mytree/a", "mytree/a/x", "mytree/a/y", "mytree/b", "mytree/c",
+	}, pathSpecs(infos))
+}
+
+func testListTreeRecursivePaginated(t *testing.T, b *Backend) {
+	createNestedTree(t, b)
+	for limit := 1; limit <= 6; limit++ {
+		opts := &metadatacontroller.ListOptions{Limit: limit, Depth: metadatacontroller.DepthInfinity}
+		var specs []string
+		for {
+			infos, next, err := b.Controller.ListTree(user, "mytree", opts)
+			require.Nil(t, err)
+			require.True(t, len(infos) <= limit)
+			specs = append(specs, pathSpecs(infos)...)
+			if next == "" {
+				break
+			}
+			require.True(t, len(specs) <= 6, "too many entries")
+			opts.Cursor = next
+		}
+		require.Equal(t, []string{
+			"mytree/a", "mytree/a/x", "mytree/a/y", "mytree/a/y/z", "mytree/b", "mytree/c",
+		}, specs, "limit %d", limit)
+	}
+}
+
+func testListTreeWithInvalidDepth(t *testing.T, b *Backend) {
+	opts := &metadatacontroller.ListOptions{Depth: -2}
+	_, _, err := b.Controller.ListTree(user, "/", opts)
+	RequireCode(t, codes.BadInputData, err)
+}
+
+func testDeleteObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, b.PutBLOB(user, "mytree/othertree/myblob", 1))
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.DeleteObject(user, "mytree"))
+	require.Nil(t, b.Controller.DeleteObject(user, "myblob"))
+	_, err := b.Controller.ExamineObject(user, "mytree/othertree/myblob")
+	RequireCode(t, codes.NotFound, err)
+	infos, _, err := b.Controller.ListTree(user, "/", nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(infos))
+}
+
+func testDeleteObjectWithNotFound(t *testing.T, b *Backend) {
+	RequireCode(t, codes.NotFound, b.Controller.DeleteObject(user, "notexists"))
+}
+
+func testDeleteObjectWithRoot(t *testing.T, b *Backend) {
+	RequireCode(t, codes.BadInputData, b.Controller.DeleteObject(user, "/"))
+	_, err := b.Controller.ExamineObject(user, "/")
+	require.Nil(t, err)
+}
+
+func testMoveObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.MoveObject(user, "myblob", "otherblob"))
+	_, err := b.Controller.ExamineObject(user, "myblob")
+	RequireCode(t, codes.NotFound, err)
+	info, err := b.Controller.ExamineObject(user, "otherblob")
+	require.Nil(t, err)
+	require.Equal(t, int64(1), info.Size)
+}
+
+func testMoveObjectWithTree(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, b.PutBLOB(user, "mytree/othertree/myblob", 1))
+	require.Nil(t, b.Controller.MoveObject(user, "mytree", "movedtree"))
+	_, err := b.Controller.ExamineObject(user, "mytree")
+	RequireCode(t, codes.NotFound, err)
+	_, err = b.Controller.ExamineObject(user, "movedtree/othertree/myblob")
+	require.Nil(t, err)
+}
+
+func testMoveObjectWithSourceNotFound(t *testing.T, b *Backend) {
+	RequireCode(t, codes.NotFound, b.Controller.MoveObject(user, "notexists", "otherblob"))
+}
+
+func testMoveObjectWithTargetParentNotFound(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	RequireCode(t, codes.NotFound, b.Controller.MoveObject(user, "myblob", "notexists/otherblob"))
+	_, err := b.Controller.ExamineObject(user, "myblob")
+	require.Nil(t, err)
+}
+
+func testMoveObjectOverExistingBLOB(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.PutBLOB(user, "otherblob", 2))
+	require.Nil(t, b.Controller.MoveObject(user, "myblob", "otherblob"))
+	info, err := b.Controller.ExamineObject(user, "otherblob")
+	require.Nil(t, err)
+	require.Equal(t, int64(1), info.Size)
+}
+
+func testMoveObjectBLOBOverExistingTree(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	RequireCode(t, codes.BadInputData, b.Controller.MoveObject(user, "myblob", "mytree"))
+}
+
+func testMoveObjectTreeOverExistingBLOB(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	RequireCode(t, codes.BadInputData, b.Controller.MoveObject(user, "mytree", "myblob"))
+}
+
+func testMoveObjectIntoItself(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	RequireCode(t, codes.BadInputData, b.Controller.MoveObject(user, "mytree", "mytree/othertree"))
+}
+
+func testMoveObjectWithRoot(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	RequireCode(t, codes.BadInputData, b.Controller.MoveObject(user, "/", "mytree/othertree"))
+}
+
+func testCopyObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, b.PutBLOB(user, "mytree/othertree/myblob", 1))
+	require.Nil(t, b.Controller.CopyObject(user, "mytree", "copiedtree"))
+	_, err := b.Controller.ExamineObject(user, "mytree/othertree/myblob")
+	require.Nil(t, err)
+	info, err := b.Controller.ExamineObject(user, "copiedtree/othertree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, int64(1), info.Size)
+
+	// the copy is independent of the source.
+	require.Nil(t, b.Controller.DeleteObject(user, "mytree/othertree/myblob"))
+	_, err = b.Controller.ExamineObject(user, "copiedtree/othertree/myblob")
+	require.Nil(t, err)
+}
+
+func testCopyObjectWithSourceNotFound(t *testing.T, b *Backend) {
+	RequireCode(t, codes.NotFound, b.Controller.CopyObject(user, "notexists", "otherblob"))
+}
+
+func testCopyObjectWithTargetParentNotFound(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	RequireCode(t, codes.NotFound, b.Controller.CopyObject(user, "myblob", "notexists/otherblob"))
+}
+
+func testCopyObjectIntoItself(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	require.Nil(t, b.Controller.CopyObject(user, "mytree", "mytree/copy"))
+	infos, _, err := b.Controller.ListTree(user, "mytree/copy", nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(infos))
+	require.Equal(t, "mytree/copy/myblob", infos[0].PathSpec)
+}
+
+func testSetProperties(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	props, err := b.Controller.GetProperties(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{}, props)
+	require.Nil(t, b.Controller.SetProperties(user, "myblob", map[string]string{"tag": "red", "description": "a blob"}))
+	require.Nil(t, b.Controller.SetProperties(user, "myblob", map[string]string{"tag": "blue"}))
+	props, err = b.Controller.GetProperties(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"tag": "blue", "description": "a blob"}, props)
+}
+
+func testSetPropertiesWithNotFound(t *testing.T, b *Backend) {
+	RequireCode(t, codes.NotFound, b.Controller.SetProperties(user, "notexists", map[string]string{"tag": "red"}))
+	_, err := b.Controller.GetProperties(user, "notexists")
+	RequireCode(t, codes.NotFound, err)
+	RequireCode(t, codes.NotFound, b.Controller.RemoveProperties(user, "notexists", []string{"tag"}))
+}
+
+func testSetPropertiesWithInvalidKey(t *testing.T, b *Backend) {
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	RequireCode(t, codes.BadInputData, b.Controller.SetProperties(user, "myblob", map[string]string{"": "red"}))
+	RequireCode(t, codes.BadInputData, b.Controller.RemoveProperties(user, "myblob", []string{""}))
+}
+
+func testRemoveProperties(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree", map[string]string{"tag": "red", "description": "a tree"}))
+	require.Nil(t, b.Controller.RemoveProperties(user, "mytree", []string{"tag", "notexists"}))
+	props, err := b.Controller.GetProperties(user, "mytree")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"description": "a tree"}, props)
+}
+
+func testPropertiesMovedWithObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree", map[string]string{"tag": "red"}))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree/myblob", map[string]string{"tag": "blue"}))
+	require.Nil(t, b.Controller.MoveObject(user, "mytree", "movedtree"))
+	props, err := b.Controller.GetProperties(user, "movedtree")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"tag": "red"}, props)
+	props, err = b.Controller.GetProperties(user, "movedtree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"tag": "blue"}, props)
+}
+
+func testPropertiesCopiedWithObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree/myblob", map[string]string{"tag": "blue"}))
+	require.Nil(t, b.Controller.CopyObject(user, "mytree", "copiedtree"))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree/myblob", map[string]string{"tag": "red"}))
+	props, err := b.Controller.GetProperties(user, "copiedtree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"tag": "blue"}, props)
+}
+
+func testPropertiesDeletedWithObject(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree", map[string]string{"tag": "red"}))
+	require.Nil(t, b.Controller.SetProperties(user, "mytree/myblob", map[string]string{"tag": "blue"}))
+	require.Nil(t, b.Controller.DeleteObject(user, "mytree"))
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	props, err := b.Controller.GetProperties(user, "mytree")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(props))
+	props, err = b.Controller.GetProperties(user, "mytree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(props))
+}
+
+func testETag(t *testing.T, b *Backend) {
+	require.NotEqual(t, "", getETag(t, b, "/"))
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	etag := getETag(t, b, "myblob")
+	require.NotEqual(t, "", etag)
+	require.Nil(t, b.PutBLOB(user, "myblob", 2))
+	require.NotEqual(t, etag, getETag(t, b, "myblob"))
+	infos, _, err := b.Controller.ListTree(user, "/", nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(infos))
+	require.Equal(t, getETag(t, b, "myblob"), metadatacontroller.GetETag(infos[0]))
+}
+
+func testETagPropagated(t *testing.T, b *Backend) {
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, b.Controller.CreateTree(user, "sibling", false))
+	etags := getETags(t, b, "/", "mytree", "mytree/othertree", "sibling")
+
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree/newtree", false))
+	requireETagsChanged(t, b, etags, "/", "mytree", "mytree/othertree")
+	require.Equal(t, etags["sibling"], getETag(t, b, "sibling"))
+
+	etags = getETags(t, b, "/", "mytree", "mytree/othertree", "sibling")
+	require.Nil(t, b.Controller.MoveObject(user, "mytree/othertree/newtree", "sibling/newtree"))
+	requireETagsChanged(t, b, etags, "/", "mytree", "mytree/othertree", "sibling")
+
+	etags = getETags(t, b, "/", "mytree", "sibling")
+	require.Nil(t, b.Controller.DeleteObject(user, "sibling/newtree"))
+	requireETagsChanged(t, b, etags, "/", "sibling")
+	require.Equal(t, etags["mytree"], getETag(t, b, "mytree"))
+
+	etags = getETags(t, b, "/", "mytree")
+	require.Nil(t, b.Controller.CopyObject(user, "mytree", "copiedtree"))
+	requireETagsChanged(t, b, etags, "/")
+	require.Equal(t, etags["mytree"], getETag(t, b, "mytree"))
+}
+
+func testETagPropagatedByPutBLOB(t *testing.T, b *Backend) {
+	if _, ok := b.Controller.(metadatacontroller.BLOBPutter); !ok {
+		t.Skip("BLOBs are not written through the controller")
+	}
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	etags := getETags(t, b, "/", "mytree")
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 1))
+	requireETagsChanged(t, b, etags, "/", "mytree")
+	etags = getETags(t, b, "/", "mytree")
+	require.Nil(t, b.PutBLOB(user, "mytree/myblob", 2))
+	requireETagsChanged(t, b, etags, "/", "mytree")
+}
+
+// conditionalController returns the controller of b as a
+// ConditionalController or skips the test.
+func conditionalController(t *testing.T, b *Backend) metadatacontroller.ConditionalController {
+	cc, ok := b.Controller.(metadatacontroller.ConditionalController)
+	if !ok {
+		t.Skip("controller does not implement ConditionalController")
+	}
+	return cc
+}
+
+func testConditionRead(t *testing.T, b *Backend) {
+	cc := conditionalController(t, b)
+	ctx := context.Background()
+	require.Nil(t, b.Controller.CreateTree(user, "mytree", false))
+	etag := getETag(t, b, "mytree")
+
+	_, err := cc.ExamineObjectIf(ctx, user, "mytree", &metadatacontroller.Condition{IfNoneMatch: []string{etag}})
+	RequireCode(t, metadatacontroller.NotModified, err)
+	_, err = cc.ExamineObjectIf(ctx, user, "mytree", &metadatacontroller.Condition{IfMatch: []string{"other"}})
+	RequireCode(t, metadatacontroller.PreconditionFailed, err)
+	info, err := cc.ExamineObjectIf(ctx, user, "mytree", &metadatacontroller.Condition{IfMatch: []string{etag}})
+	require.Nil(t, err)
+	require.Equal(t, etag, metadatacontroller.GetETag(info))
+	_, err = cc.ExamineObjectIf(ctx, user, "othertree", &metadatacontroller.Condition{IfMatch: []string{etag}})
+	RequireCode(t, codes.NotFound, err)
+
+	_, _, err = cc.ListTreeIf(ctx, user, "mytree", nil, &metadatacontroller.Condition{IfNoneMatch: []string{etag}})
+	RequireCode(t, metadatacontroller.NotModified, err)
+	require.Nil(t, b.Controller.CreateTree(user, "mytree/othertree", false))
+	infos, _, err := cc.ListTreeIf(ctx, user, "mytree", nil, &metadatacontroller.Condition{IfNoneMatch: []string{etag}})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(infos))
+}
+
+func testConditionDelete(t *testing.T, b *Backend) {
+	cc := conditionalController(t, b)
+	ctx := context.Background()
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	etag := getETag(t, b, "myblob")
+
+	err := cc.DeleteObjectIf(ctx, user, "myblob", &metadatacontroller.Condition{IfMatch: []string{"other"}})
+	RequireCode(t, metadatacontroller.PreconditionFailed, err)
+	err = cc.DeleteObjectIf(ctx, user, "myblob", &metadatacontroller.Condition{IfNoneMatch: []string{metadatacontroller.AnyETag}})
+	RequireCode(t, metadatacontroller.PreconditionFailed, err)
+	_, err = b.Controller.ExamineObject(user, "myblob")
+	require.Nil(t, err)
+	require.Nil(t, cc.DeleteObjectIf(ctx, user, "myblob", &metadatacontroller.Condition{IfMatch: []string{etag}}))
+	_, err = b.Controller.ExamineObject(user, "myblob")
+	RequireCode(t, codes.NotFound, err)
+}
+
+func testConditionMove(t *testing.T, b *Backend) {
+	cc := conditionalController(t, b)
+	ctx := context.Background()
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.PutBLOB(user, "otherblob", 2))
+	etag := getETag(t, b, "myblob")
+
+	// the condition is checked on the source, not on the replaced target.
+	err := cc.MoveObjectIf(ctx, user, "myblob", "otherblob", &metadatacontroller.Condition{IfMatch: []string{getETag(t, b, "otherblob")}})
+	RequireCode(t, metadatacontroller.PreconditionFailed, err)
+	info, err := b.Controller.ExamineObject(user, "otherblob")
+	require.Nil(t, err)
+	require.Equal(t, int64(2), info.Size)
+	require.Nil(t, cc.MoveObjectIf(ctx, user, "myblob", "otherblob", &metadatacontroller.Condition{IfMatch: []string{etag}}))
+	info, err = b.Controller.ExamineObject(user, "otherblob")
+	require.Nil(t, err)
+	require.Equal(t, int64(1), info.Size)
+}
+
+// batcher returns the controller of b as a Batcher or skips the test.
+func batcher(t *testing.T, b *Backend) metadatacontroller.Batcher {
+	bc, ok := b.Controller.(metadatacontroller.Batcher)
+	if !ok {
+		t.Skip("controller does not implement Batcher")
+	}
+	return bc
+}
+
+func testBatch(t *testing.T, b *Backend) {
+	bc := batcher(t, b)
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	results, err := bc.ApplyBatch(context.Background(), user, []*metadatacontroller.BatchOperation{
+		{Op: metadatacontroller.BatchCreateTree, PathSpec: "mytree"},
+		{Op: metadatacontroller.BatchMove, PathSpec: "myblob", TargetPathSpec: "mytree/myblob"},
+		{Op: metadatacontroller.BatchCopy, PathSpec: "mytree", TargetPathSpec: "othertree"},
+		{Op: metadatacontroller.BatchDelete, PathSpec: "mytree/myblob"},
+		{Op: metadatacontroller.BatchExamine, PathSpec: "othertree/myblob"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 5, len(results))
+	for _, res := range results {
+		require.Nil(t, res.Err)
+	}
+	require.Equal(t, int64(1), results[4].ObjectInfo.Size)
+	_, err = b.Controller.ExamineObject(user, "mytree/myblob")
+	RequireCode(t, codes.NotFound, err)
+}
+
+func testBatchRolledBack(t *testing.T, b *Backend) {
+	bc := batcher(t, b)
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	results, err := bc.ApplyBatch(context.Background(), user, []*metadatacontroller.BatchOperation{
+		{Op: metadatacontroller.BatchCreateTree, PathSpec: "mytree"},
+		{Op: metadatacontroller.BatchDelete, PathSpec: "myblob"},
+		{Op: metadatacontroller.BatchMove, PathSpec: "notexists", TargetPathSpec: "mytree/notexists"},
+		{Op: metadatacontroller.BatchDelete, PathSpec: "mytree"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(results))
+	require.True(t, metadatacontroller.BatchFailed(results))
+	RequireCode(t, codes.NotFound, results[2].Err)
+
+	// none of the operations is applied.
+	_, err = b.Controller.ExamineObject(user, "mytree")
+	RequireCode(t, codes.NotFound, err)
+	_, err = b.Controller.ExamineObject(user, "myblob")
+	require.Nil(t, err)
+}
+
+func getETag(t *testing.T, b *Backend, pathSpec string) string {
+	info, err := b.Controller.ExamineObject(user, pathSpec)
+	require.Nil(t, err)
+	return metadatacontroller.GetETag(info)
+}
+
+// getETags returns the ETags of the objects at pathSpecs keyed by path.
+func getETags(t *testing.T, b *Backend, pathSpecs ...string) map[string]string {
+	etags := map[string]string{}
+	for _, pathSpec := range pathSpecs {
+		etags[pathSpec] = getETag(t, b, pathSpec)
+	}
+	return etags
+}
+
+// requireETagsChanged checks that the ETags of the objects at pathSpecs
+// are different from the ones in etags.
+func requireETagsChanged(t *testing.T, b *Backend, etags map[string]string, pathSpecs ...string) {
+	for _, pathSpec := range pathSpecs {
+		require.NotEqual(t, etags[pathSpec], getETag(t, b, pathSpec), pathSpec)
+	}
+}
+
+func testUserIsolation(t *testing.T, b *Backend) {
+	_, err := b.Controller.ExamineObject(otherUser, "/")
+	RequireCode(t, codes.NotFound, err)
+
+	require.Nil(t, b.PutBLOB(user, "myblob", 1))
+	require.Nil(t, b.Controller.Init(otherUser))
+	_, err = b.Controller.ExamineObject(otherUser, "myblob")
+	RequireCode(t, codes.NotFound, err)
+	infos, _, err := b.Controller.ListTree(otherUser, "/", nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(infos))
+	RequireCode(t, codes.NotFound, b.Controller.DeleteObject(otherUser, "myblob"))
+	_, err = b.Controller.ExamineObject(user, "myblob")
+	require.Nil(t, err)
+}
+
+// pathSpecs returns the PathSpec of every entry of infos.
+func pathSpecs(infos []*entities.ObjectInfo) []string {
+	var specs []string
+	for _, info := range infos {
+		specs = append(specs, info.PathSpec)
+	}
+	return specs
+}
@@ -0,0 +1,84 @@
+package metadatacontroller
+
+import (
+	"context"
+
+	"github.com/clawio/entities"
+)
+
+// ContextMetaDataController is implemented by controllers that accept
+// a context.Context in every operation, so long running operations are
+// aborted when the context is cancelled or its deadline expires.
+type ContextMetaDataController interface {
+	MetaDataController
+	InitContext(ctx context.Context, user *entities.User) error
+	CreateTreeContext(ctx context.Context, user *entities.User, pathSpec string, recursive bool) error
+	ExamineObjectContext(ctx context.Context, user *entities.User, pathSpec string) (*entities.ObjectInfo, error)
+	ListTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error)
+	DeleteObjectContext(ctx context.Context, user *entities.User, pathSpec string) error
+	MoveObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error
+	CopyObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error
+}
+
+// WithContext returns c as a ContextMetaDataController. Controllers that
+// do not implement it are wrapped so the context is checked before
+// every operation.
+func WithContext(c MetaDataController) ContextMetaDataController {
+	if cc, ok := c.(ContextMetaDataController); ok {
+		return cc
+	}
+	return &contextController{c}
+}
+
+type contextController struct {
+	MetaDataController
+}
+
+func (c *contextController) InitContext(ctx context.Context, user *entities.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Init(user)
+}
+
+func (c *contextController) CreateTreeContext(ctx context.Context, user *entities.User, pathSpec string, recursive bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.CreateTree(user, pathSpec, recursive)
+}
+
+func (c *contextController) ExamineObjectContext(ctx context.Context, user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.ExamineObject(user, pathSpec)
+}
+
+func (c *contextController) ListTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return c.ListTree(user, pathSpec, opts)
+}
+
+func (c *contextController) DeleteObjectContext(ctx context.Context, user *entities.User, pathSpec string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.DeleteObject(user, pathSpec)
+}
+
+func (c *contextController) MoveObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.MoveObject(user, sourcePathSpec, targetPathSpec)
+}
+
+func (c *contextController) CopyObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.CopyObject(user, sourcePathSpec, targetPathSpec)
+}
@@ -0,0 +1,91 @@
+package metadatacontroller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+// nopController is a MetaDataController without context support.
+type nopController struct {
+	calls int
+}
+
+func (c *nopController) Init(user *entities.User) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	c.calls++
+	return &entities.ObjectInfo{}, nil
+}
+func (c *nopController) ListTree(user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error) {
+	c.calls++
+	return nil, "", nil
+}
+func (c *nopController) DeleteObject(user *entities.User, pathSpec string) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	c.calls++
+	return nil
+}
+func (c *nopController) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	c.calls++
+	return map[string]string{}, nil
+}
+func (c *nopController) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	c.calls++
+	return nil
+}
+
+func TestWithContext(t *testing.T) {
+	c := &nopController{}
+	cc := WithContext(c)
+	ctx := context.Background()
+	user := &entities.User{Username: "test"}
+	require.Nil(t, cc.InitContext(ctx, user))
+	require.Nil(t, cc.CreateTreeContext(ctx, user, "mytree", false))
+	_, err := cc.ExamineObjectContext(ctx, user, "mytree")
+	require.Nil(t, err)
+	_, _, err = cc.ListTreeContext(ctx, user, "mytree", nil)
+	require.Nil(t, err)
+	require.Nil(t, cc.MoveObjectContext(ctx, user, "mytree", "othertree"))
+	require.Nil(t, cc.CopyObjectContext(ctx, user, "othertree", "mytree"))
+	require.Nil(t, cc.DeleteObjectContext(ctx, user, "mytree"))
+	require.Equal(t, 7, c.calls)
+	require.Equal(t, cc, WithContext(cc))
+}
+
+func TestWithContext_withCancelledContext(t *testing.T) {
+	c := &nopController{}
+	cc := WithContext(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	user := &entities.User{Username: "test"}
+	require.Equal(t, context.Canceled, cc.InitContext(ctx, user))
+	require.Equal(t, context.Canceled, cc.CreateTreeContext(ctx, user, "mytree", false))
+	_, err := cc.ExamineObjectContext(ctx, user, "mytree")
+	require.Equal(t, context.Canceled, err)
+	_, _, err = cc.ListTreeContext(ctx, user, "mytree", nil)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, context.Canceled, cc.MoveObjectContext(ctx, user, "mytree", "othertree"))
+	require.Equal(t, context.Canceled, cc.CopyObjectContext(ctx, user, "othertree", "mytree"))
+	require.Equal(t, context.Canceled, cc.DeleteObjectContext(ctx, user, "mytree"))
+	require.Equal(t, 0, c.calls)
+}
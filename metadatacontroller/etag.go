@@ -0,0 +1,56 @@
+package metadatacontroller
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/clawio/entities"
+)
+
+// ObjectExtra is the information set by the controllers as the Extra
+// of the ObjectInfo they return.
+type ObjectExtra struct {
+	// ETag changes when a BLOB changes. The ETag of a tree changes
+	// when any object under it is created, changed, moved or deleted,
+	// so clients only need to descend into the trees whose ETag changed
+	// to find the changes under them.
+	ETag string `json:"etag"`
+}
+
+var (
+	etagMu   sync.Mutex
+	lastETag int64
+)
+
+// NewETag returns an ETag different from the ones returned before,
+// also by previous runs of the process as long as the clock does
+// not go back.
+func NewETag() string {
+	etagMu.Lock()
+	defer etagMu.Unlock()
+	n := time.Now().UnixNano()
+	if n <= lastETag {
+		n = lastETag + 1
+	}
+	lastETag = n
+	return strconv.FormatInt(n, 36)
+}
+
+// SetETag sets the ETag of oinfo.
+func SetETag(oinfo *entities.ObjectInfo, etag string) {
+	extra, ok := oinfo.Extra.(*ObjectExtra)
+	if !ok {
+		extra = &ObjectExtra{}
+		oinfo.Extra = extra
+	}
+	extra.ETag = etag
+}
+
+// GetETag returns the ETag of oinfo or an empty string if it has none.
+func GetETag(oinfo *entities.ObjectInfo) string {
+	if extra, ok := oinfo.Extra.(*ObjectExtra); ok {
+		return extra.ETag
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewETag(t *testing.T) {
+	etags := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		etag := NewETag()
+		require.False(t, etags[etag], etag)
+		etags[etag] = true
+	}
+}
+
+func TestSetETag(t *testing.T) {
+	oinfo := &entities.ObjectInfo{}
+	require.Equal(t, "", GetETag(oinfo))
+	SetETag(oinfo, "abc")
+	require.Equal(t, "abc", GetETag(oinfo))
+	require.Equal(t, &ObjectExtra{ETag: "abc"}, oinfo.Extra)
+}
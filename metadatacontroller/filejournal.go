@@ -0,0 +1,235 @@
+package metadatacontroller
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/clawio/entities"
+)
+
+// NewFileJournal returns a Journal keeping the changes of every user
+// in a file of dir, one JSON encoded change per line. At least the last
+// max changes of every user are kept, all of them if max is 0.
+func NewFileJournal(dir string, max int) Journal {
+	return &fileJournal{dir: dir, max: max, users: map[string]*userJournal{}}
+}
+
+type fileJournal struct {
+	dir string
+	max int
+	// mu guards users, the files of the users already read.
+	mu    sync.Mutex
+	users map[string]*userJournal
+}
+
+// userJournal is the index of the file of an user, read once, so the
+// changes after a sequence number are read from their offset.
+type userJournal struct {
+	// mu is held for writing by appends and for reading by reads,
+	// so only the changes of the same user wait for each other.
+	mu sync.RWMutex
+	// loaded is false until the file is read.
+	loaded bool
+	// last is the sequence number of the last change and first the
+	// one of the first change kept, at offsets[0] in the file.
+	first, last int64
+	offsets     []int64
+	// size is the size of the changes in the file, which can be
+	// followed by a partial line left by a failed append.
+	size int64
+}
+
+func (j *fileJournal) Append(user *entities.User, change *Change) error {
+	uj, err := j.open(user)
+	if err != nil {
+		return err
+	}
+	uj.mu.Lock()
+	defer uj.mu.Unlock()
+	journalPath := j.getJournalPath(user)
+	if err := os.MkdirAll(filepath.Dir(journalPath), 0755); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	change.Seq = uj.last + 1
+	change.Time = time.Now().Unix()
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	// the change is written after the last one, over the partial
+	// line left by a failed append if any.
+	if _, err := fd.WriteAt(append(data, '\n'), uj.size); err != nil {
+		return err
+	}
+	if len(uj.offsets) == 0 {
+		uj.first = change.Seq
+	}
+	uj.offsets = append(uj.offsets, uj.size)
+	uj.last = change.Seq
+	uj.size += int64(len(data)) + 1
+	if j.max > 0 && len(uj.offsets) >= 2*j.max {
+		// the changes expired are dropped once they double the
+		// ones kept, so files are rewritten once every max changes.
+		j.expire(user, uj)
+	}
+	return nil
+}
+
+func (j *fileJournal) Since(user *entities.User, seq int64, limit int) ([]*Change, error) {
+	uj, err := j.open(user)
+	if err != nil {
+		return nil, err
+	}
+	uj.mu.RLock()
+	defer uj.mu.RUnlock()
+	if seq > uj.last || (len(uj.offsets) > 0 && seq < uj.first-1) {
+		return nil, errChangesExpired(seq)
+	}
+	changes := []*Change{}
+	next := int(seq - uj.first + 1)
+	if len(uj.offsets) == 0 || next >= len(uj.offsets) {
+		return changes, nil
+	}
+	fd, err := os.Open(j.getJournalPath(user))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	offset := uj.offsets[next]
+	reader := bufio.NewReader(io.NewSectionReader(fd, offset, uj.size-offset))
+	for limit == 0 || len(changes) < limit {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		change := &Change{}
+		if err := json.Unmarshal(line, change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// open returns the index of the file of the user, reading the file
+// the first time.
+func (j *fileJournal) open(user *entities.User) (*userJournal, error) {
+	j.mu.Lock()
+	uj, ok := j.users[user.Username]
+	if !ok {
+		uj = &userJournal{}
+		j.users[user.Username] = uj
+	}
+	j.mu.Unlock()
+
+	uj.mu.Lock()
+	defer uj.mu.Unlock()
+	if uj.loaded {
+		return uj, nil
+	}
+	var first, last int64
+	var offsets []int64
+	size, err := j.read(user, func(c *Change, offset int64) error {
+		if len(offsets) == 0 {
+			first = c.Seq
+		}
+		offsets = append(offsets, offset)
+		last = c.Seq
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	uj.first, uj.last, uj.offsets, uj.size = first, last, offsets, size
+	uj.loaded = true
+	return uj, nil
+}
+
+// expire rewrites the file of the user with its last max changes.
+// The changes are expired by the next append if it fails.
+func (j *fileJournal) expire(user *entities.User, uj *userJournal) {
+	journalPath := j.getJournalPath(user)
+	drop := len(uj.offsets) - j.max
+	base := uj.offsets[drop]
+	fd, err := os.Open(journalPath)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(journalPath), ".expire-")
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(tmp, io.NewSectionReader(fd, base, uj.size-base))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), journalPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	offsets := make([]int64, 0, 2*j.max)
+	for _, offset := range uj.offsets[drop:] {
+		offsets = append(offsets, offset-base)
+	}
+	uj.offsets = offsets
+	uj.first += int64(drop)
+	uj.size -= base
+}
+
+// read calls fn for every change of the user, oldest first, with its
+// offset, and returns the size of the lines read. A line without
+// newline is a change whose append failed and is ignored.
+func (j *fileJournal) read(user *entities.User, fn func(*Change, int64) error) (int64, error) {
+	fd, err := os.Open(j.getJournalPath(user))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer fd.Close()
+	reader := bufio.NewReader(fd)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		change := &Change{}
+		if err := json.Unmarshal(line, change); err != nil {
+			return 0, err
+		}
+		if err := fn(change, size); err != nil {
+			return 0, err
+		}
+		size += int64(len(line))
+	}
+}
+
+func (j *fileJournal) getJournalPath(user *entities.User) string {
+	name := url.QueryEscape(user.Username)
+	return filepath.Join(j.dir, name[:1], name+".ndjson")
+}
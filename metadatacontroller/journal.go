@@ -0,0 +1,496 @@
+package metadatacontroller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// ChangeOp is the kind of a change of the namespace.
+type ChangeOp string
+
+// Changes recorded in the journal.
+const (
+	ChangeCreate     ChangeOp = "create"
+	ChangePut        ChangeOp = "put"
+	ChangeDelete     ChangeOp = "delete"
+	ChangeMove       ChangeOp = "move"
+	ChangeCopy       ChangeOp = "copy"
+	ChangeProperties ChangeOp = "properties"
+	ChangeRestore    ChangeOp = "restore"
+	// ChangePurge is recorded when an item is purged from the trash,
+	// with the path the object had.
+	ChangePurge ChangeOp = "purge"
+	// ChangeDeleteVersion is recorded when a version of the BLOB
+	// at PathSpec is deleted.
+	ChangeDeleteVersion ChangeOp = "deleteversion"
+)
+
+// Change is a change of the namespace of an user.
+type Change struct {
+	// Seq is the sequence number of the change, increasing with
+	// every change of the user.
+	Seq int64
+	// Time is the Unix time of the change.
+	Time     int64
+	Op       ChangeOp
+	PathSpec string
+	// TargetPathSpec is the path the object was moved or copied to.
+	TargetPathSpec string `json:",omitempty"`
+	// ETag is the ETag of the object changed, the one at TargetPathSpec
+	// for moves and copies, after the change. It is empty for deletions.
+	ETag string `json:",omitempty"`
+	// ID is the ID of the trash item purged or of the version deleted.
+	ID string `json:",omitempty"`
+}
+
+// Journal keeps the changes of the namespace of every user.
+type Journal interface {
+	// Append records change with the next sequence number of the
+	// user, setting its Seq and Time.
+	Append(user *entities.User, change *Change) error
+	// Since returns, oldest first, at most limit changes of the user
+	// with a sequence number greater than seq, or all of them if
+	// limit is 0. It returns a ChangesExpired error if the changes
+	// right after seq are no longer kept or seq is after the last one.
+	Since(user *entities.User, seq int64, limit int) ([]*Change, error)
+}
+
+// ChangeController is implemented by controllers journaling
+// the changes of the namespace.
+type ChangeController interface {
+	// Changes returns the changes of the user after the sequence number
+	// given like Journal.Since.
+	Changes(user *entities.User, since int64, limit int) ([]*Change, error)
+	// SubscribeChanges returns a subscription receiving the changes
+	// of the user journaled from now on, in order.
+	SubscribeChanges(user *entities.User) *Subscription
+}
+
+// Wrapper is implemented by controllers adding behaviour to another one.
+type Wrapper interface {
+	Unwrap() MetaDataController
+}
+
+// Unwrap returns the controller wrapped by c, recursively, or c itself if
+// it does not wrap any, to reach the interfaces not implemented by the
+// wrappers, like io.Closer.
+func Unwrap(c MetaDataController) MetaDataController {
+	for {
+		w, ok := c.(Wrapper)
+		if !ok {
+			return c
+		}
+		c = w.Unwrap()
+	}
+}
+
+// WithJournal returns a MetaDataController recording in j the changes
+// done by every successful operation of c and publishing them to the
+// subscribers of the user. The returned controller implements the
+// optional interfaces implemented by c. The changes of an user are
+// applied one at a time, so they are numbered in the order they are
+// done. Only the changes made through the returned controller are
+// recorded, not the ones made to the backend by other components, like
+// the BLOBs written by the data service.
+//
+// The changes are recorded after the operations, so a change is lost if
+// the process stops in between or it cannot be appended to j. In the
+// latter case onError, if not nil, is called, the subscriptions of the
+// user are dropped and, until the process stops, Changes reports the
+// changes before the one lost as expired, so clients read the namespace
+// again instead of missing the change.
+func WithJournal(c MetaDataController, j Journal, onError func(user *entities.User, change *Change, err error)) MetaDataController {
+	jc := &journaledController{
+		MetaDataController: c,
+		journal:            j,
+		onError:            onError,
+		broker:             newBroker(),
+		locks:              map[string]*userLock{},
+		lost:               map[string]int64{},
+	}
+	i := 0
+	for bit, implements := range journaledInterfaces {
+		if implements(c) {
+			i |= 1 << uint(bit)
+		}
+	}
+	return journaledTypes[i](jc)
+}
+
+//go:generate go run journal_gen.go
+
+// journaledInterfaces report whether a controller implements each of the
+// optional interfaces implemented by the parts of the journaled controller
+// listed in journal_gen.go, in the same order. journaledTypes is indexed
+// by the bits of the interfaces implemented.
+var journaledInterfaces = []func(c MetaDataController) bool{
+	func(c MetaDataController) bool { _, ok := c.(BLOBPutter); return ok },
+	func(c MetaDataController) bool { _, ok := c.(ConditionalController); return ok },
+	func(c MetaDataController) bool { _, ok := c.(TrashController); return ok },
+	func(c MetaDataController) bool { _, ok := c.(VersionController); return ok },
+	func(c MetaDataController) bool { _, ok := c.(QuotaController); return ok },
+	func(c MetaDataController) bool { _, ok := c.(Batcher); return ok },
+}
+
+type journaledController struct {
+	MetaDataController
+	journal Journal
+	onError func(user *entities.User, change *Change, err error)
+	broker  *broker
+	// mu guards locks, which holds the lock of every user with
+	// changes in progress, and lost, which holds the users with a
+	// change not journaled and the sequence number of the first
+	// change journaled after it, or 0 until there is one.
+	mu    sync.Mutex
+	locks map[string]*userLock
+	lost  map[string]int64
+}
+
+// userLock is held across every change of an user and its recording.
+type userLock struct {
+	sync.Mutex
+	// refs is the number of changes holding or waiting for the lock.
+	refs int
+}
+
+// lock locks the changes of the user and returns the function
+// unlocking them.
+func (c *journaledController) lock(user *entities.User) func() {
+	c.mu.Lock()
+	l, ok := c.locks[user.Username]
+	if !ok {
+		l = &userLock{}
+		c.locks[user.Username] = l
+	}
+	l.refs++
+	c.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(c.locks, user.Username)
+		}
+	}
+}
+
+func (c *journaledController) Unwrap() MetaDataController {
+	return c.MetaDataController
+}
+
+func (c *journaledController) Changes(user *entities.User, since int64, limit int) ([]*Change, error) {
+	c.mu.Lock()
+	next, lost := c.lost[user.Username]
+	c.mu.Unlock()
+	if lost && (next == 0 || since < next) {
+		return nil, codes.NewErr(ChangesExpired, "a change after the sequence number was not journaled")
+	}
+	return c.journal.Since(user, since, limit)
+}
+
+func (c *journaledController) SubscribeChanges(user *entities.User) *Subscription {
+	return c.broker.subscribe(user)
+}
+
+// record appends the change to the journal if err is nil and returns err.
+// It is called holding the lock of the user taken before the operation,
+// so the ETag examined is the one left by the operation.
+func (c *journaledController) record(err error, user *entities.User, op ChangeOp, pathSpec, targetPathSpec string) error {
+	if err != nil {
+		return err
+	}
+	change := &Change{Op: op, PathSpec: pathSpec, TargetPathSpec: targetPathSpec}
+	if op != ChangeDelete {
+		changed := pathSpec
+		if targetPathSpec != "" {
+			changed = targetPathSpec
+		}
+		if oinfo, err := c.MetaDataController.ExamineObject(user, changed); err == nil {
+			change.ETag = GetETag(oinfo)
+		}
+	}
+	c.append(user, change)
+	return nil
+}
+
+// append appends the change to the journal and publishes it. Errors are
+// not returned, as the operation is done anyway, but make the clients
+// read the namespace again as explained in WithJournal.
+func (c *journaledController) append(user *entities.User, change *Change) {
+	if err := c.journal.Append(user, change); err != nil {
+		c.mu.Lock()
+		c.lost[user.Username] = 0
+		c.mu.Unlock()
+		c.broker.drop(user)
+		if c.onError != nil {
+			c.onError(user, change, err)
+		}
+		return
+	}
+	c.mu.Lock()
+	if next, lost := c.lost[user.Username]; lost && next == 0 {
+		c.lost[user.Username] = change.Seq
+	}
+	c.mu.Unlock()
+	c.broker.publish(user, change)
+}
+
+func (c *journaledController) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.CreateTree(user, pathSpec, recursive)
+	return c.record(err, user, ChangeCreate, pathSpec, "")
+}
+
+func (c *journaledController) DeleteObject(user *entities.User, pathSpec string) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.DeleteObject(user, pathSpec)
+	return c.record(err, user, ChangeDelete, pathSpec, "")
+}
+
+func (c *journaledController) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.MoveObject(user, sourcePathSpec, targetPathSpec)
+	return c.record(err, user, ChangeMove, sourcePathSpec, targetPathSpec)
+}
+
+func (c *journaledController) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.CopyObject(user, sourcePathSpec, targetPathSpec)
+	return c.record(err, user, ChangeCopy, sourcePathSpec, targetPathSpec)
+}
+
+func (c *journaledController) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.SetProperties(user, pathSpec, props)
+	return c.record(err, user, ChangeProperties, pathSpec, "")
+}
+
+func (c *journaledController) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	defer c.lock(user)()
+	err := c.MetaDataController.RemoveProperties(user, pathSpec, keys)
+	return c.record(err, user, ChangeProperties, pathSpec, "")
+}
+
+func (c *journaledController) context() ContextMetaDataController {
+	return WithContext(c.MetaDataController)
+}
+
+func (c *journaledController) InitContext(ctx context.Context, user *entities.User) error {
+	return c.context().InitContext(ctx, user)
+}
+
+func (c *journaledController) CreateTreeContext(ctx context.Context, user *entities.User, pathSpec string, recursive bool) error {
+	defer c.lock(user)()
+	err := c.context().CreateTreeContext(ctx, user, pathSpec, recursive)
+	return c.record(err, user, ChangeCreate, pathSpec, "")
+}
+
+func (c *journaledController) ExamineObjectContext(ctx context.Context, user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	return c.context().ExamineObjectContext(ctx, user, pathSpec)
+}
+
+func (c *journaledController) ListTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.context().ListTreeContext(ctx, user, pathSpec, opts)
+}
+
+func (c *journaledController) DeleteObjectContext(ctx context.Context, user *entities.User, pathSpec string) error {
+	defer c.lock(user)()
+	err := c.context().DeleteObjectContext(ctx, user, pathSpec)
+	return c.record(err, user, ChangeDelete, pathSpec, "")
+}
+
+func (c *journaledController) MoveObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	defer c.lock(user)()
+	err := c.context().MoveObjectContext(ctx, user, sourcePathSpec, targetPathSpec)
+	return c.record(err, user, ChangeMove, sourcePathSpec, targetPathSpec)
+}
+
+func (c *journaledController) CopyObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	defer c.lock(user)()
+	err := c.context().CopyObjectContext(ctx, user, sourcePathSpec, targetPathSpec)
+	return c.record(err, user, ChangeCopy, sourcePathSpec, targetPathSpec)
+}
+
+func (c *journaledController) StreamTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions, fn ListFunc) (string, error) {
+	return StreamTree(ctx, c.context(), user, pathSpec, opts, fn)
+}
+
+// The optional interfaces of the journaled controller are implemented
+// by the following parts, embedded with the journaledController by the
+// types of journaledTypes. Every part is only used when the controller
+// journaled implements the interface.
+
+type journaledPutter struct {
+	c *journaledController
+}
+
+func (p journaledPutter) PutBLOB(user *entities.User, pathSpec string, size int64, checksum string) error {
+	defer p.c.lock(user)()
+	err := p.c.MetaDataController.(BLOBPutter).PutBLOB(user, pathSpec, size, checksum)
+	return p.c.record(err, user, ChangePut, pathSpec, "")
+}
+
+type journaledConditional struct {
+	c *journaledController
+}
+
+func (p journaledConditional) cc() ConditionalController {
+	return p.c.MetaDataController.(ConditionalController)
+}
+
+func (p journaledConditional) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *Condition) (*entities.ObjectInfo, error) {
+	return p.cc().ExamineObjectIf(ctx, user, pathSpec, cond)
+}
+
+func (p journaledConditional) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions, cond *Condition) ([]*entities.ObjectInfo, string, error) {
+	return p.cc().ListTreeIf(ctx, user, pathSpec, opts, cond)
+}
+
+func (p journaledConditional) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *Condition) error {
+	defer p.c.lock(user)()
+	err := p.cc().DeleteObjectIf(ctx, user, pathSpec, cond)
+	return p.c.record(err, user, ChangeDelete, pathSpec, "")
+}
+
+func (p journaledConditional) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *Condition) error {
+	defer p.c.lock(user)()
+	err := p.cc().MoveObjectIf(ctx, user, sourcePathSpec, targetPathSpec, cond)
+	return p.c.record(err, user, ChangeMove, sourcePathSpec, targetPathSpec)
+}
+
+type journaledTrash struct {
+	c *journaledController
+}
+
+func (p journaledTrash) tc() TrashController {
+	return p.c.MetaDataController.(TrashController)
+}
+
+// item returns the trash item of the user with the given id,
+// or nil if it cannot be listed.
+func (p journaledTrash) item(user *entities.User, id string) *TrashItem {
+	items, _ := p.tc().ListTrash(user)
+	for _, item := range items {
+		if item.ID == id {
+			return item
+		}
+	}
+	return nil
+}
+
+func (p journaledTrash) ListTrash(user *entities.User) ([]*TrashItem, error) {
+	return p.tc().ListTrash(user)
+}
+
+func (p journaledTrash) RestoreTrashItem(user *entities.User, id, targetPathSpec string) error {
+	defer p.c.lock(user)()
+	if targetPathSpec == "" {
+		// the item is restored to the path it had.
+		if item := p.item(user, id); item != nil {
+			targetPathSpec = item.PathSpec
+		}
+	}
+	err := p.tc().RestoreTrashItem(user, id, targetPathSpec)
+	return p.c.record(err, user, ChangeRestore, targetPathSpec, "")
+}
+
+func (p journaledTrash) PurgeTrashItem(user *entities.User, id string) error {
+	defer p.c.lock(user)()
+	change := &Change{Op: ChangePurge, ID: id}
+	if item := p.item(user, id); item != nil {
+		change.PathSpec = item.PathSpec
+	}
+	if err := p.tc().PurgeTrashItem(user, id); err != nil {
+		return err
+	}
+	p.c.append(user, change)
+	return nil
+}
+
+func (p journaledTrash) PurgeTrash(user *entities.User, before int64) (int, error) {
+	defer p.c.lock(user)()
+	items, _ := p.tc().ListTrash(user)
+	purged, err := p.tc().PurgeTrash(user, before)
+	if purged == 0 {
+		return purged, err
+	}
+	// the items purged are the ones old enough no longer listed.
+	left := map[string]bool{}
+	leftItems, _ := p.tc().ListTrash(user)
+	for _, item := range leftItems {
+		left[item.ID] = true
+	}
+	for _, item := range items {
+		if item.DeletedAt <= before && !left[item.ID] {
+			p.c.append(user, &Change{Op: ChangePurge, PathSpec: item.PathSpec, ID: item.ID})
+		}
+	}
+	return purged, err
+}
+
+type journaledVersions struct {
+	c *journaledController
+}
+
+func (p journaledVersions) vc() VersionController {
+	return p.c.MetaDataController.(VersionController)
+}
+
+func (p journaledVersions) ListVersions(user *entities.User, pathSpec string) ([]*Version, error) {
+	return p.vc().ListVersions(user, pathSpec)
+}
+
+func (p journaledVersions) ExamineVersion(user *entities.User, pathSpec, id string) (*Version, error) {
+	return p.vc().ExamineVersion(user, pathSpec, id)
+}
+
+func (p journaledVersions) RestoreVersion(user *entities.User, pathSpec, id string) error {
+	defer p.c.lock(user)()
+	err := p.vc().RestoreVersion(user, pathSpec, id)
+	return p.c.record(err, user, ChangeRestore, pathSpec, "")
+}
+
+func (p journaledVersions) DeleteVersion(user *entities.User, pathSpec, id string) error {
+	defer p.c.lock(user)()
+	if err := p.vc().DeleteVersion(user, pathSpec, id); err != nil {
+		return err
+	}
+	p.c.append(user, &Change{Op: ChangeDeleteVersion, PathSpec: pathSpec, ID: id})
+	return nil
+}
+
+type journaledQuota struct {
+	c *journaledController
+}
+
+func (p journaledQuota) GetQuota(user *entities.User) (*Quota, error) {
+	return p.c.MetaDataController.(QuotaController).GetQuota(user)
+}
+
+type journaledBatcher struct {
+	c *journaledController
+}
+
+func (p journaledBatcher) ApplyBatch(ctx context.Context, user *entities.User, ops []*BatchOperation) ([]*BatchResult, error) {
+	defer p.c.lock(user)()
+	results, err := p.c.MetaDataController.(Batcher).ApplyBatch(ctx, user, ops)
+	if err != nil || BatchFailed(results) {
+		return results, err
+	}
+	for _, op := range ops {
+		changeOp, ok := batchChanges[op.Op]
+		if !ok {
+			continue
+		}
+		target := ""
+		if changeOp == ChangeMove || changeOp == ChangeCopy {
+			target = op.TargetPathSpec
+		}
+		p.c.record(nil, user, changeOp, op.PathSpec, target)
+	}
+	return results, nil
+}
@@ -0,0 +1,64 @@
+//go:build ignore
+// +build ignore
+
+// This program generates journal_types.go, run it with go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+)
+
+// parts are the parts of the journaled controller implementing the
+// optional interfaces, in the order of journaledInterfaces.
+var parts = []string{
+	"journaledPutter",
+	"journaledConditional",
+	"journaledTrash",
+	"journaledVersions",
+	"journaledQuota",
+	"journaledBatcher",
+}
+
+func main() {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by go run journal_gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package metadatacontroller\n\n")
+	fmt.Fprintf(buf, "// journaledTypes return the journaled controller as a type implementing\n")
+	fmt.Fprintf(buf, "// the optional interfaces given by the bits of their index.\n")
+	fmt.Fprintf(buf, "var journaledTypes = [...]func(c *journaledController) MetaDataController{\n")
+	for i := 0; i < 1<<uint(len(parts)); i++ {
+		var embedded, values []string
+		for bit, part := range parts {
+			if i&(1<<uint(bit)) != 0 {
+				embedded = append(embedded, part)
+				values = append(values, part+"{c}")
+			}
+		}
+		fmt.Fprintf(buf, "func(c *journaledController) MetaDataController {\n")
+		if len(embedded) == 0 {
+			fmt.Fprintf(buf, "return c\n},\n")
+			continue
+		}
+		fmt.Fprintf(buf, "return struct {\n*journaledController\n")
+		for _, part := range embedded {
+			fmt.Fprintf(buf, "%s\n", part)
+		}
+		fmt.Fprintf(buf, "}{c")
+		for _, value := range values {
+			fmt.Fprintf(buf, ", %s", value)
+		}
+		fmt.Fprintf(buf, "}\n},\n")
+	}
+	fmt.Fprintf(buf, "}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("journal_types.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,385 @@
+package metadatacontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+var journalUser = &entities.User{Username: "test"}
+
+func newFileJournal(t *testing.T) (Journal, func()) {
+	dir, err := ioutil.TempDir("", "clawio-journal-")
+	require.Nil(t, err)
+	return NewFileJournal(dir, 0), func() { os.RemoveAll(dir) }
+}
+
+func TestFileJournal(t *testing.T) {
+	j, cleanup := newFileJournal(t)
+	defer cleanup()
+	changes, err := j.Since(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+
+	for _, op := range []ChangeOp{ChangeCreate, ChangeMove, ChangeDelete} {
+		require.Nil(t, j.Append(journalUser, &Change{Op: op, PathSpec: "mytree"}))
+	}
+	changes, err = j.Since(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(changes))
+	for i, change := range changes {
+		require.Equal(t, int64(i+1), change.Seq)
+	}
+	require.Equal(t, ChangeMove, changes[1].Op)
+
+	changes, err = j.Since(journalUser, 1, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(changes))
+	require.Equal(t, int64(2), changes[0].Seq)
+
+	// the changes of other users are kept apart.
+	changes, err = j.Since(&entities.User{Username: "other"}, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+
+	changes, err = j.Since(journalUser, 3, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+	_, err = j.Since(journalUser, 4, 0)
+	requireChangesExpired(t, err)
+}
+
+func TestFileJournal_expired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clawio-journal-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	j := NewFileJournal(dir, 2)
+	for i := 0; i < 5; i++ {
+		require.Nil(t, j.Append(journalUser, &Change{Op: ChangeCreate, PathSpec: fmt.Sprintf("mytree%d", i)}))
+	}
+
+	// the first two changes are dropped once four are kept, and the
+	// same changes are kept when the journal is opened again.
+	for _, j := range []Journal{j, NewFileJournal(dir, 2)} {
+		_, err = j.Since(journalUser, 1, 0)
+		requireChangesExpired(t, err)
+		changes, err := j.Since(journalUser, 2, 0)
+		require.Nil(t, err)
+		require.Equal(t, 3, len(changes))
+		require.Equal(t, int64(3), changes[0].Seq)
+		require.Equal(t, "mytree2", changes[0].PathSpec)
+		changes, err = j.Since(journalUser, 3, 1)
+		require.Nil(t, err)
+		require.Equal(t, 1, len(changes))
+		require.Equal(t, "mytree3", changes[0].PathSpec)
+	}
+}
+
+func TestMemoryJournal(t *testing.T) {
+	j := NewMemoryJournal(2)
+	for _, op := range []ChangeOp{ChangeCreate, ChangeMove, ChangeDelete} {
+		require.Nil(t, j.Append(journalUser, &Change{Op: op, PathSpec: "mytree"}))
+	}
+	changes, err := j.Since(journalUser, 1, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(changes))
+	require.Equal(t, int64(2), changes[0].Seq)
+	require.Equal(t, ChangeDelete, changes[1].Op)
+
+	// the first change is no longer kept.
+	_, err = j.Since(journalUser, 0, 0)
+	requireChangesExpired(t, err)
+	_, err = j.Since(journalUser, 4, 0)
+	requireChangesExpired(t, err)
+	changes, err = j.Since(&entities.User{Username: "other"}, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+}
+
+func requireChangesExpired(t *testing.T, err error) {
+	codeErr, ok := err.(*codes.Err)
+	require.True(t, ok, "error %v has no code", err)
+	require.Equal(t, ChangesExpired, codeErr.Code)
+}
+
+func TestFileJournal_reopened(t *testing.T) {
+	j, cleanup := newFileJournal(t)
+	defer cleanup()
+	require.Nil(t, j.Append(journalUser, &Change{Op: ChangeCreate, PathSpec: "mytree"}))
+
+	// a partial line left by a failed append is dropped.
+	journalPath := j.(*fileJournal).getJournalPath(journalUser)
+	fd, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0644)
+	require.Nil(t, err)
+	_, err = fd.Write([]byte(`{"Seq":2,`))
+	require.Nil(t, err)
+	require.Nil(t, fd.Close())
+
+	j = NewFileJournal(filepath.Dir(filepath.Dir(journalPath)), 0)
+	require.Nil(t, j.Append(journalUser, &Change{Op: ChangeDelete, PathSpec: "mytree"}))
+	changes, err := j.Since(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(changes))
+	require.Equal(t, int64(2), changes[1].Seq)
+	require.Equal(t, ChangeDelete, changes[1].Op)
+}
+
+func TestWithJournal(t *testing.T) {
+	j, cleanup := newFileJournal(t)
+	defer cleanup()
+	inner := &nopController{}
+	c := WithJournal(inner, j, nil)
+	require.Equal(t, inner, Unwrap(c))
+
+	require.Nil(t, c.Init(journalUser))
+	_, err := c.ExamineObject(journalUser, "mytree")
+	require.Nil(t, err)
+	require.Nil(t, c.CreateTree(journalUser, "mytree", false))
+	require.Nil(t, c.MoveObject(journalUser, "mytree", "othertree"))
+	require.Nil(t, c.SetProperties(journalUser, "othertree", map[string]string{"color": "red"}))
+	require.Nil(t, c.DeleteObject(journalUser, "othertree"))
+
+	changes, err := c.(ChangeController).Changes(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 4, len(changes))
+	require.Equal(t, ChangeCreate, changes[0].Op)
+	require.Equal(t, ChangeMove, changes[1].Op)
+	require.Equal(t, "mytree", changes[1].PathSpec)
+	require.Equal(t, "othertree", changes[1].TargetPathSpec)
+	require.Equal(t, ChangeProperties, changes[2].Op)
+	require.Equal(t, ChangeDelete, changes[3].Op)
+
+	// the optional interfaces are only implemented
+	// when the controller implements them.
+	_, ok := c.(TrashController)
+	require.False(t, ok)
+	_, ok = c.(BLOBPutter)
+	require.False(t, ok)
+	_, ok = WithJournal(&batchController{}, j, nil).(Batcher)
+	require.True(t, ok)
+}
+
+// trashController keeps the items of its trash in memory.
+type trashController struct {
+	nopController
+	items []*TrashItem
+}
+
+func (c *trashController) ListTrash(user *entities.User) ([]*TrashItem, error) {
+	return c.items, nil
+}
+
+func (c *trashController) RestoreTrashItem(user *entities.User, id, targetPathSpec string) error {
+	return c.PurgeTrashItem(user, id)
+}
+
+func (c *trashController) PurgeTrashItem(user *entities.User, id string) error {
+	for i, item := range c.items {
+		if item.ID == id {
+			c.items = append(c.items[:i], c.items[i+1:]...)
+			return nil
+		}
+	}
+	return codes.NewErr(codes.NotFound, "trash item not found")
+}
+
+func (c *trashController) PurgeTrash(user *entities.User, before int64) (int, error) {
+	var left []*TrashItem
+	for _, item := range c.items {
+		if item.DeletedAt > before {
+			left = append(left, item)
+		}
+	}
+	purged := len(c.items) - len(left)
+	c.items = left
+	return purged, nil
+}
+
+func TestWithJournal_trash(t *testing.T) {
+	inner := &trashController{items: []*TrashItem{
+		{ID: "1", PathSpec: "myblob", DeletedAt: 10},
+		{ID: "2", PathSpec: "mytree", DeletedAt: 20},
+		{ID: "3", PathSpec: "otherblob", DeletedAt: 30},
+	}}
+	c := WithJournal(inner, NewMemoryJournal(10), nil)
+	tc := c.(TrashController)
+	require.Nil(t, tc.RestoreTrashItem(journalUser, "1", ""))
+	require.Nil(t, tc.PurgeTrashItem(journalUser, "3"))
+	require.NotNil(t, tc.PurgeTrashItem(journalUser, "3"))
+	purged, err := tc.PurgeTrash(journalUser, 20)
+	require.Nil(t, err)
+	require.Equal(t, 1, purged)
+
+	changes, err := c.(ChangeController).Changes(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(changes))
+	require.Equal(t, ChangeRestore, changes[0].Op)
+	require.Equal(t, "myblob", changes[0].PathSpec)
+	require.Equal(t, &Change{Seq: 2, Time: changes[1].Time, Op: ChangePurge, PathSpec: "otherblob", ID: "3"}, changes[1])
+	require.Equal(t, &Change{Seq: 3, Time: changes[2].Time, Op: ChangePurge, PathSpec: "mytree", ID: "2"}, changes[2])
+}
+
+func TestWithJournal_subscribed(t *testing.T) {
+	c := WithJournal(&nopController{}, NewMemoryJournal(10), nil)
+	sub := c.(ChangeController).SubscribeChanges(journalUser)
+	other := c.(ChangeController).SubscribeChanges(&entities.User{Username: "other"})
+	defer other.Close()
+	require.Nil(t, c.CreateTree(journalUser, "mytree", false))
+	require.Nil(t, c.DeleteObject(journalUser, "mytree"))
+	change := <-sub.C
+	require.Equal(t, int64(1), change.Seq)
+	require.Equal(t, ChangeCreate, change.Op)
+	change = <-sub.C
+	require.Equal(t, ChangeDelete, change.Op)
+	require.Equal(t, 0, len(other.C))
+
+	sub.Close()
+	_, ok := <-sub.C
+	require.False(t, ok)
+	require.False(t, sub.Dropped())
+	// closing twice is harmless.
+	sub.Close()
+}
+
+func TestWithJournal_slowSubscriber(t *testing.T) {
+	c := WithJournal(&nopController{}, NewMemoryJournal(10), nil)
+	sub := c.(ChangeController).SubscribeChanges(journalUser)
+	for i := 0; i <= SubscriptionBuffer; i++ {
+		require.Nil(t, c.CreateTree(journalUser, "mytree", false))
+	}
+	received := 0
+	for range sub.C {
+		received++
+	}
+	require.Equal(t, SubscriptionBuffer, received)
+	require.True(t, sub.Dropped())
+}
+
+// batchController applies batches without a transaction.
+type batchController struct {
+	nopController
+}
+
+func (c *batchController) ApplyBatch(ctx context.Context, user *entities.User, ops []*BatchOperation) ([]*BatchResult, error) {
+	return ApplyBatch(ctx, WithContext(&c.nopController), user, ops), nil
+}
+
+func TestWithJournal_batch(t *testing.T) {
+	c := WithJournal(&batchController{}, NewMemoryJournal(10), nil)
+	results, err := c.(Batcher).ApplyBatch(context.Background(), journalUser, []*BatchOperation{
+		{Op: BatchExamine, PathSpec: "mytree"},
+		{Op: BatchMove, PathSpec: "mytree", TargetPathSpec: "othertree"},
+		{Op: BatchDelete, PathSpec: "othertree", TargetPathSpec: "ignored"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(results))
+	changes, err := c.(ChangeController).Changes(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(changes))
+	require.Equal(t, ChangeMove, changes[0].Op)
+	require.Equal(t, "othertree", changes[0].TargetPathSpec)
+	require.Equal(t, ChangeDelete, changes[1].Op)
+	require.Equal(t, "", changes[1].TargetPathSpec)
+
+	// failed batches are not applied, so nothing is recorded.
+	results, err = c.(Batcher).ApplyBatch(context.Background(), journalUser, []*BatchOperation{
+		{Op: BatchCreateTree, PathSpec: "mytree"},
+		{Op: "unknown"},
+	})
+	require.Nil(t, err)
+	require.True(t, BatchFailed(results))
+	changes, err = c.(ChangeController).Changes(journalUser, 2, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+}
+
+// failingJournal fails to append changes while failing is set.
+type failingJournal struct {
+	Journal
+	failing bool
+}
+
+func (j *failingJournal) Append(user *entities.User, change *Change) error {
+	if j.failing {
+		return errors.New("journal is full")
+	}
+	return j.Journal.Append(user, change)
+}
+
+func TestWithJournal_failingJournal(t *testing.T) {
+	j := &failingJournal{Journal: NewMemoryJournal(10)}
+	var lost []*Change
+	c := WithJournal(&nopController{}, j, func(user *entities.User, change *Change, err error) {
+		lost = append(lost, change)
+	})
+	require.Nil(t, c.CreateTree(journalUser, "mytree", false))
+	sub := c.(ChangeController).SubscribeChanges(journalUser)
+	defer sub.Close()
+
+	// the operation is done, so it succeeds even if not journaled,
+	// but the clients have to read the namespace again.
+	j.failing = true
+	require.Nil(t, c.DeleteObject(journalUser, "mytree"))
+	require.Equal(t, 1, len(lost))
+	require.Equal(t, ChangeDelete, lost[0].Op)
+	_, ok := <-sub.C
+	require.False(t, ok)
+	require.True(t, sub.Dropped())
+	_, err := c.(ChangeController).Changes(journalUser, 1, 0)
+	requireChangesExpired(t, err)
+
+	// the changes journaled after the one lost can be read.
+	j.failing = false
+	require.Nil(t, c.CreateTree(journalUser, "othertree", false))
+	_, err = c.(ChangeController).Changes(journalUser, 1, 0)
+	requireChangesExpired(t, err)
+	changes, err := c.(ChangeController).Changes(journalUser, 2, 0)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(changes))
+	_, err = c.(ChangeController).Changes(&entities.User{Username: "other"}, 0, 0)
+	require.Nil(t, err)
+}
+
+// orderedController records the order in which trees are created.
+type orderedController struct {
+	nopController
+	mu      sync.Mutex
+	created []string
+}
+
+func (c *orderedController) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created = append(c.created, pathSpec)
+	return nil
+}
+
+func TestWithJournal_concurrently(t *testing.T) {
+	inner := &orderedController{}
+	c := WithJournal(inner, NewMemoryJournal(100), nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.Nil(t, c.CreateTree(journalUser, fmt.Sprintf("mytree%d", i), false))
+		}(i)
+	}
+	wg.Wait()
+	// the changes are numbered in the order they are done.
+	changes, err := c.(ChangeController).Changes(journalUser, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, len(inner.created), len(changes))
+	for i, change := range changes {
+		require.Equal(t, inner.created[i], change.PathSpec)
+	}
+}
@@ -0,0 +1,518 @@
+// Code generated by go run journal_gen.go; DO NOT EDIT.
+
+package metadatacontroller
+
+// journaledTypes return the journaled controller as a type implementing
+// the optional interfaces given by the bits of their index.
+var journaledTypes = [...]func(c *journaledController) MetaDataController{
+	func(c *journaledController) MetaDataController {
+		return c
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+		}{c, journaledPutter{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+		}{c, journaledConditional{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+		}{c, journaledPutter{c}, journaledConditional{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+		}{c, journaledTrash{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+		}{c, journaledPutter{c}, journaledTrash{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+		}{c, journaledConditional{c}, journaledTrash{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledVersions
+		}{c, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledVersions
+		}{c, journaledPutter{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledVersions
+		}{c, journaledConditional{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledVersions
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledVersions
+		}{c, journaledTrash{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledVersions
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledVersions
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledVersions
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledQuota
+		}{c, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledQuota
+		}{c, journaledPutter{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledQuota
+		}{c, journaledConditional{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledQuota
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledQuota
+		}{c, journaledTrash{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledQuota
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledQuota
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledQuota
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledVersions
+			journaledQuota
+		}{c, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledVersions
+			journaledQuota
+		}{c, journaledPutter{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledVersions
+			journaledQuota
+		}{c, journaledConditional{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledVersions
+			journaledQuota
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledVersions
+			journaledQuota
+		}{c, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledVersions
+			journaledQuota
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledQuota
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledQuota
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledBatcher
+		}{c, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledBatcher
+		}{c, journaledTrash{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledVersions
+			journaledBatcher
+		}{c, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledVersions
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledVersions
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledVersions
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledVersions
+			journaledBatcher
+		}{c, journaledTrash{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledVersions
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledQuota
+			journaledBatcher
+		}{c, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledQuota
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledQuota
+			journaledBatcher
+		}{c, journaledTrash{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledQuota
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledTrash
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledTrash
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+	func(c *journaledController) MetaDataController {
+		return struct {
+			*journaledController
+			journaledPutter
+			journaledConditional
+			journaledTrash
+			journaledVersions
+			journaledQuota
+			journaledBatcher
+		}{c, journaledPutter{c}, journaledConditional{c}, journaledTrash{c}, journaledVersions{c}, journaledQuota{c}, journaledBatcher{c}}
+	},
+}
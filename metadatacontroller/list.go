@@ -0,0 +1,335 @@
+package metadatacontroller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path"
+	"sort"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// SortOrder is the order in which the children of a tree are listed.
+// Entries with the same sort key are sorted by name, so every order is stable.
+type SortOrder string
+
+const (
+	// SortByName sorts the entries by name.
+	SortByName SortOrder = "name"
+	// SortBySize sorts the entries by size.
+	SortBySize SortOrder = "size"
+	// SortByModTime sorts the entries by modification time.
+	SortByModTime SortOrder = "mtime"
+	// SortByType sorts the entries by type.
+	SortByType SortOrder = "type"
+)
+
+// DepthInfinity lists all the descendants of a tree.
+const DepthInfinity = -1
+
+// ListOptions controls which entries ListTree returns.
+type ListOptions struct {
+	// Limit is the maximum number of entries returned.
+	// A value of 0 means no limit.
+	Limit int
+	// Cursor is the opaque cursor returned by a previous call,
+	// used to obtain the next page of entries.
+	Cursor string
+	// Sort is the order of the entries, SortByName if empty.
+	Sort SortOrder
+	// Depth is the number of levels of the tree listed, 1 if 0.
+	// With a depth greater than 1 or DepthInfinity the tree is walked
+	// depth-first: every subtree is followed by its own entries, and
+	// siblings are listed in the given sort order.
+	Depth int
+}
+
+// key is the sort key of an entry among its siblings.
+type key struct {
+	Name  string `json:"n"`
+	Value string `json:"v,omitempty"`
+	Num   int64  `json:"i,omitempty"`
+}
+
+// cursor is the position of the last entry of a page, given by the
+// sort keys of the entry and of its ancestors below the listed tree.
+type cursor struct {
+	Sort SortOrder `json:"s"`
+	Keys []key     `json:"k"`
+}
+
+// GetSort returns the sort order of opts, or an error
+// if the sort order is unknown.
+func (opts *ListOptions) GetSort() (SortOrder, error) {
+	if opts == nil || opts.Sort == "" {
+		return SortByName, nil
+	}
+	switch opts.Sort {
+	case SortByName, SortBySize, SortByModTime, SortByType:
+		return opts.Sort, nil
+	}
+	return "", codes.NewErr(codes.BadInputData, "unknown sort order "+string(opts.Sort))
+}
+
+// GetDepth returns the depth of opts, or an error if the depth is not valid.
+func (opts *ListOptions) GetDepth() (int, error) {
+	if opts == nil || opts.Depth == 0 {
+		return 1, nil
+	}
+	if opts.Depth < 0 && opts.Depth != DepthInfinity {
+		return 0, codes.NewErr(codes.BadInputData, "depth must be positive")
+	}
+	return opts.Depth, nil
+}
+
+// Paginate sorts oinfos and returns the page of entries selected by opts
+// and the cursor of the next page, empty when there are no more entries.
+// It is meant for controllers that cannot paginate natively.
+func Paginate(oinfos []*entities.ObjectInfo, opts *ListOptions) ([]*entities.ObjectInfo, string, error) {
+	pos, err := opts.Position()
+	if err != nil {
+		return nil, "", err
+	}
+	sorted := make([]*entities.ObjectInfo, len(oinfos))
+	copy(sorted, oinfos)
+	sort.Sort(&byOrder{sorted, pos.order})
+
+	start := sort.Search(len(sorted), func(i int) bool {
+		return pos.After(sorted[i])
+	})
+	page := sorted[start:]
+	if pos.limit == 0 || len(page) <= pos.limit {
+		return page, "", nil
+	}
+	page = page[:pos.limit]
+	return page, pos.NextCursor(page[len(page)-1]), nil
+}
+
+// ChildrenFunc returns the children of the tree at pathSpec, in any order.
+// The PathSpec of every child must be pathSpec joined with its name.
+type ChildrenFunc func(pathSpec string) ([]*entities.ObjectInfo, error)
+
+// ListFunc is called for every entry listed, in order.
+// The listing stops when it returns an error.
+type ListFunc func(oinfo *entities.ObjectInfo) error
+
+// Walk lists the tree at pathSpec up to the depth given by opts, obtaining
+// the children of every tree visited from children, and returns the page of
+// entries selected by opts and the cursor of the next page. Subtrees placed
+// before the cursor are not visited and the walk stops once the page is full.
+func Walk(pathSpec string, opts *ListOptions, children ChildrenFunc) ([]*entities.ObjectInfo, string, error) {
+	var oinfos []*entities.ObjectInfo
+	next, err := WalkFunc(pathSpec, opts, children, func(oinfo *entities.ObjectInfo) error {
+		oinfos = append(oinfos, oinfo)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return oinfos, next, nil
+}
+
+// WalkFunc is like Walk but calls fn for every entry of the page
+// instead of returning them, so only the children of the trees being
+// visited are kept in memory.
+func WalkFunc(pathSpec string, opts *ListOptions, children ChildrenFunc, fn ListFunc) (string, error) {
+	pos, err := opts.Position()
+	if err != nil {
+		return "", err
+	}
+	depth, err := opts.GetDepth()
+	if err != nil {
+		return "", err
+	}
+	w := &walker{pos: pos, depth: depth, children: children, fn: fn}
+	if err := w.walk(pathSpec, nil, 1); err != nil {
+		return "", err
+	}
+	return w.next, nil
+}
+
+type walker struct {
+	pos      *Position
+	depth    int
+	children ChildrenFunc
+	fn       ListFunc
+	count    int
+	lastKeys []key
+	next     string
+}
+
+// walk visits the children of the tree at pathSpec, whose sort keys
+// are parentKeys, at the given level. It sets w.next and returns
+// when the page is full.
+func (w *walker) walk(pathSpec string, parentKeys []key, level int) error {
+	oinfos, err := w.children(pathSpec)
+	if err != nil {
+		return err
+	}
+	sort.Sort(&byOrder{oinfos, w.pos.order})
+	for _, oinfo := range oinfos {
+		keys := append(parentKeys[:len(parentKeys):len(parentKeys)], newKey(oinfo, w.pos.order))
+		if last := w.pos.last; last == nil || compareKeys(keys, last.Keys) > 0 {
+			if w.pos.limit > 0 && w.count == w.pos.limit {
+				w.next = encodeCursor(&cursor{Sort: w.pos.order, Keys: w.lastKeys})
+				return nil
+			}
+			if err := w.fn(oinfo); err != nil {
+				return err
+			}
+			w.count++
+			w.lastKeys = keys
+		} else if len(keys) > len(last.Keys) || compareKeys(keys, last.Keys[:len(keys)]) != 0 {
+			// neither the entry nor its subtree are after the cursor.
+			continue
+		}
+		if oinfo.Type != entities.ObjectTypeTree || (w.depth != DepthInfinity && level >= w.depth) {
+			continue
+		}
+		if err := w.walk(oinfo.PathSpec, keys, level+1); err != nil {
+			return err
+		}
+		if w.next != "" {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Position is the position in a listing where a page starts.
+type Position struct {
+	order SortOrder
+	limit int
+	last  *cursor
+}
+
+// Position returns the position where the page requested by opts starts,
+// or an error if the sort order, the limit or the cursor are not valid.
+// It is meant for controllers able to paginate natively.
+func (opts *ListOptions) Position() (*Position, error) {
+	order, err := opts.GetSort()
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return &Position{order: order}, nil
+	}
+	if opts.Limit < 0 {
+		return nil, codes.NewErr(codes.BadInputData, "limit must not be negative")
+	}
+	last, err := decodeCursor(opts.Cursor, order)
+	if err != nil {
+		return nil, err
+	}
+	return &Position{order: order, limit: opts.Limit, last: last}, nil
+}
+
+// Order returns the sort order of the listing.
+func (p *Position) Order() SortOrder {
+	return p.order
+}
+
+// Name returns the name of the last child of the listed tree
+// placed before the page, or an empty string for the first page.
+func (p *Position) Name() string {
+	if p.last == nil {
+		return ""
+	}
+	return p.last.Keys[0].Name
+}
+
+// After reports whether the child oinfo of the listed tree belongs to
+// the page starting at p, that is, whether it is sorted after the last
+// entry of the previous page.
+func (p *Position) After(oinfo *entities.ObjectInfo) bool {
+	return p.last == nil || compareKeys([]key{newKey(oinfo, p.order)}, p.last.Keys) > 0
+}
+
+// NextCursor returns the cursor of the page following the page
+// ending with the child oinfo of the listed tree.
+func (p *Position) NextCursor(oinfo *entities.ObjectInfo) string {
+	return encodeCursor(&cursor{Sort: p.order, Keys: []key{newKey(oinfo, p.order)}})
+}
+
+func newKey(oinfo *entities.ObjectInfo, order SortOrder) key {
+	k := key{Name: path.Base(oinfo.PathSpec)}
+	switch order {
+	case SortBySize:
+		k.Num = oinfo.Size
+	case SortByModTime:
+		k.Num = oinfo.ModTime
+	case SortByType:
+		k.Value = string(oinfo.Type)
+	}
+	return k
+}
+
+func compareKey(a, b key) int {
+	switch {
+	case a.Num < b.Num:
+		return -1
+	case a.Num > b.Num:
+		return 1
+	case a.Value < b.Value:
+		return -1
+	case a.Value > b.Value:
+		return 1
+	case a.Name < b.Name:
+		return -1
+	case a.Name > b.Name:
+		return 1
+	}
+	return 0
+}
+
+// compareKeys compares the positions of two entries, given by their
+// sort keys, in a depth-first walk where a tree precedes its descendants.
+func compareKeys(a, b []key) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp := compareKey(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func encodeCursor(c *cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string, order SortOrder) (*cursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, codes.NewErr(codes.BadInputData, "invalid cursor")
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil || len(c.Keys) == 0 {
+		return nil, codes.NewErr(codes.BadInputData, "invalid cursor")
+	}
+	if c.Sort != order {
+		return nil, codes.NewErr(codes.BadInputData, "cursor does not match the sort order")
+	}
+	return c, nil
+}
+
+type byOrder struct {
+	oinfos []*entities.ObjectInfo
+	order  SortOrder
+}
+
+func (s *byOrder) Len() int      { return len(s.oinfos) }
+func (s *byOrder) Swap(i, j int) { s.oinfos[i], s.oinfos[j] = s.oinfos[j], s.oinfos[i] }
+func (s *byOrder) Less(i, j int) bool {
+	return compareKey(newKey(s.oinfos[i], s.order), newKey(s.oinfos[j], s.order)) < 0
+}
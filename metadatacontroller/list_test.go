@@ -0,0 +1,65 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	oinfos := []*entities.ObjectInfo{
+		{PathSpec: "mytree/c", ModTime: 1},
+		{PathSpec: "mytree/a", ModTime: 2},
+		{PathSpec: "mytree/b", ModTime: 1},
+	}
+	opts := &ListOptions{Limit: 2, Sort: SortByModTime}
+	page, next, err := Paginate(oinfos, opts)
+	require.Nil(t, err)
+	require.Equal(t, []*entities.ObjectInfo{oinfos[2], oinfos[0]}, page)
+	require.NotEqual(t, "", next)
+	opts.Cursor = next
+	page, next, err = Paginate(oinfos, opts)
+	require.Nil(t, err)
+	require.Equal(t, []*entities.ObjectInfo{oinfos[1]}, page)
+	require.Equal(t, "", next)
+	require.Equal(t, "mytree/c", oinfos[0].PathSpec, "oinfos must not be sorted in place")
+}
+
+func TestPaginate_withNilOptions(t *testing.T) {
+	oinfos := []*entities.ObjectInfo{{PathSpec: "b"}, {PathSpec: "a"}}
+	page, next, err := Paginate(oinfos, nil)
+	require.Nil(t, err)
+	require.Equal(t, []*entities.ObjectInfo{oinfos[1], oinfos[0]}, page)
+	require.Equal(t, "", next)
+}
+
+func TestPaginate_withNegativeLimit(t *testing.T) {
+	_, _, err := Paginate(nil, &ListOptions{Limit: -1})
+	require.NotNil(t, err)
+}
+
+func TestWalk(t *testing.T) {
+	tree := map[string][]*entities.ObjectInfo{
+		"/": {
+			{PathSpec: "/b", Type: entities.ObjectTypeBLOB, Size: 1},
+			{PathSpec: "/a", Type: entities.ObjectTypeTree, Size: 2},
+		},
+		"/a": {
+			{PathSpec: "/a/y", Type: entities.ObjectTypeBLOB, Size: 1},
+			{PathSpec: "/a/x", Type: entities.ObjectTypeBLOB, Size: 5},
+		},
+	}
+	children := func(pathSpec string) ([]*entities.ObjectInfo, error) {
+		return tree[pathSpec], nil
+	}
+	opts := &ListOptions{Limit: 2, Sort: SortBySize, Depth: DepthInfinity}
+	page, next, err := Walk("/", opts, children)
+	require.Nil(t, err)
+	require.Equal(t, []*entities.ObjectInfo{tree["/"][0], tree["/"][1]}, page)
+	opts.Cursor = next
+	page, next, err = Walk("/", opts, children)
+	require.Nil(t, err)
+	require.Equal(t, []*entities.ObjectInfo{tree["/a"][0], tree["/a"][1]}, page)
+	require.Equal(t, "", next)
+}
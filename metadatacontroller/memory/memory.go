@@ -0,0 +1,456 @@
+package memory
+
+import (
+	"context"
+	"mime"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+func init() {
+	metadatacontroller.Register("memory", func(opts map[string]string) (metadatacontroller.MetaDataController, error) {
+		return New(), nil
+	})
+}
+
+type controller struct {
+	mu    sync.RWMutex
+	homes map[string]*node
+}
+
+// node is an object of the namespace.
+type node struct {
+	otype    entities.ObjectType
+	size     int64
+	checksum string
+	modTime  int64
+	etag     string
+	children map[string]*node
+	props    map[string]string
+}
+
+// New returns an implementation of MetaDataController that keeps
+// the namespace in memory. It is safe for concurrent use and is
+// meant for tests and ephemeral deployments.
+func New() metadatacontroller.MetaDataController {
+	return &controller{homes: map[string]*node{}}
+}
+
+func (c *controller) Init(user *entities.User) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.homes[user.Username]; !ok {
+		c.homes[user.Username] = newTree()
+	}
+	return nil
+}
+
+func (c *controller) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.getHome(user)
+	if err != nil {
+		return err
+	}
+	names := split(pathSpec)
+	created := false
+	for i, name := range names {
+		child, ok := n.children[name]
+		last := i == len(names)-1
+		if !ok {
+			if !recursive && !last {
+				return codes.NewErr(codes.NotFound, "parent tree not found")
+			}
+			child = newTree()
+			n.children[name] = child
+			created = true
+		} else if last && !recursive {
+			return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+		} else if child.otype != entities.ObjectTypeTree {
+			return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+		}
+		n = child
+	}
+	if len(names) == 0 && !recursive {
+		return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+	}
+	if created {
+		c.touchAncestors(user, pathSpec)
+	}
+	return nil
+}
+
+func (c *controller) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	return c.ExamineObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) (*entities.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, err := c.getNode(user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := cond.Check(n.etag, true); err != nil {
+		return nil, err
+	}
+	return getObjectInfo(pathSpec, n), nil
+}
+
+func (c *controller) ListTree(user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.ListTreeIf(context.Background(), user, pathSpec, opts, nil)
+}
+
+func (c *controller) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, cond *metadatacontroller.Condition) ([]*entities.ObjectInfo, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, err := c.getNode(user, pathSpec)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cond.Check(n.etag, true); err != nil {
+		return nil, "", err
+	}
+	if n.otype != entities.ObjectTypeTree {
+		return nil, "", codes.NewErr(codes.BadInputData, "object is not a tree")
+	}
+	return metadatacontroller.Walk(pathSpec, opts, func(pathSpec string) ([]*entities.ObjectInfo, error) {
+		n, err := c.getNode(user, pathSpec)
+		if err != nil {
+			return nil, err
+		}
+		var oinfos []*entities.ObjectInfo
+		for name, child := range n.children {
+			oinfos = append(oinfos, getObjectInfo(path.Join(pathSpec, name), child))
+		}
+		return oinfos, nil
+	})
+}
+
+func (c *controller) DeleteObject(user *entities.User, pathSpec string) error {
+	return c.DeleteObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(split(pathSpec)) == 0 {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be deleted")
+	}
+	parent, name, err := c.getParent(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	n, ok := parent.children[name]
+	if !ok {
+		return codes.NewErr(codes.NotFound, "object not found")
+	}
+	if err := cond.Check(n.etag, false); err != nil {
+		return err
+	}
+	delete(parent.children, name)
+	c.touchAncestors(user, pathSpec)
+	return nil
+}
+
+func (c *controller) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.MoveObjectIf(context.Background(), user, sourcePathSpec, targetPathSpec, nil)
+}
+
+func (c *controller) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	if source == "/" {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be moved")
+	}
+	if strings.HasPrefix(target, source+"/") {
+		return codes.NewErr(codes.BadInputData, "object cannot be moved inside itself")
+	}
+	if cond != nil {
+		n, err := c.getNode(user, source)
+		if err != nil {
+			return err
+		}
+		if err := cond.Check(n.etag, false); err != nil {
+			return err
+		}
+	}
+	n, targetParent, err := c.prepareTransfer(user, source, target)
+	if err != nil {
+		return err
+	}
+	if source == target {
+		return nil
+	}
+	sourceParent, sourceName, err := c.getParent(user, source)
+	if err != nil {
+		return err
+	}
+	delete(sourceParent.children, sourceName)
+	targetParent.children[path.Base(target)] = n
+	c.touchAncestors(user, source)
+	c.touchAncestors(user, target)
+	return nil
+}
+
+func (c *controller) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	n, targetParent, err := c.prepareTransfer(user, source, target)
+	if err != nil {
+		return err
+	}
+	if source == target {
+		return nil
+	}
+	targetParent.children[path.Base(target)] = n.clone(now(), metadatacontroller.NewETag())
+	c.touchAncestors(user, target)
+	return nil
+}
+
+func (c *controller) PutBLOB(user *entities.User, pathSpec string, size int64, checksum string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(split(pathSpec)) == 0 {
+		return codes.NewErr(codes.BadInputData, "object is a tree")
+	}
+	parent, name, err := c.getParent(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	n, ok := parent.children[name]
+	if ok && n.otype == entities.ObjectTypeTree {
+		return codes.NewErr(codes.BadInputData, "object is a tree")
+	}
+	blob := &node{
+		otype:    entities.ObjectTypeBLOB,
+		size:     size,
+		checksum: checksum,
+		modTime:  now(),
+		etag:     metadatacontroller.NewETag(),
+	}
+	if ok {
+		blob.props = n.props
+	}
+	parent.children[name] = blob
+	c.touchAncestors(user, pathSpec)
+	return nil
+}
+
+func (c *controller) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	if err := metadatacontroller.CheckProperties(props); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.getNode(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	if n.props == nil {
+		n.props = map[string]string{}
+	}
+	for k, v := range props {
+		n.props[k] = v
+	}
+	return nil
+}
+
+func (c *controller) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, err := c.getNode(user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(n.props))
+	for k, v := range n.props {
+		props[k] = v
+	}
+	return props, nil
+}
+
+func (c *controller) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	if err := metadatacontroller.CheckPropertyKeys(keys...); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.getNode(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		delete(n.props, k)
+	}
+	return nil
+}
+
+// prepareTransfer checks that the object at source can be moved or copied
+// to target and removes the object being replaced at target if any.
+// It returns the source node and the parent tree of target.
+func (c *controller) prepareTransfer(user *entities.User, source, target string) (*node, *node, error) {
+	n, err := c.getNode(user, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if target == "/" {
+		return nil, nil, codes.NewErr(codes.BadInputData, "root tree cannot be replaced")
+	}
+	targetParent, targetName, err := c.getParent(user, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source == target {
+		return n, targetParent, nil
+	}
+	targetNode, ok := targetParent.children[targetName]
+	if !ok {
+		return n, targetParent, nil
+	}
+	if targetNode.otype != n.otype {
+		return nil, nil, codes.NewErr(codes.BadInputData, "target object has a different type")
+	}
+	if len(targetNode.children) > 0 {
+		return nil, nil, codes.NewErr(codes.BadInputData, "target tree is not empty")
+	}
+	delete(targetParent.children, targetName)
+	return n, targetParent, nil
+}
+
+// touchAncestors gives a new ETag to the trees from the parent
+// of pathSpec up to the home tree of the user.
+func (c *controller) touchAncestors(user *entities.User, pathSpec string) {
+	n, err := c.getHome(user)
+	if err != nil {
+		return
+	}
+	etag := metadatacontroller.NewETag()
+	n.etag = etag
+	names := split(pathSpec)
+	for i := 0; i < len(names)-1 && n.children[names[i]] != nil; i++ {
+		n = n.children[names[i]]
+		n.etag = etag
+	}
+}
+
+func (c *controller) getHome(user *entities.User) (*node, error) {
+	home, ok := c.homes[user.Username]
+	if !ok {
+		return nil, codes.NewErr(codes.NotFound, "user home tree not found")
+	}
+	return home, nil
+}
+
+func (c *controller) getNode(user *entities.User, pathSpec string) (*node, error) {
+	n, err := c.getHome(user)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range split(pathSpec) {
+		child, ok := n.children[name]
+		if !ok {
+			return nil, codes.NewErr(codes.NotFound, "object not found")
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// getParent returns the parent tree of pathSpec and the base name of pathSpec.
+func (c *controller) getParent(user *entities.User, pathSpec string) (*node, string, error) {
+	p := cleanPath(pathSpec)
+	parent, err := c.getNode(user, path.Dir(p))
+	if err != nil {
+		return nil, "", codes.NewErr(codes.NotFound, "parent tree not found")
+	}
+	if parent.otype != entities.ObjectTypeTree {
+		return nil, "", codes.NewErr(codes.BadInputData, "parent object is not a tree")
+	}
+	return parent, path.Base(p), nil
+}
+
+func newTree() *node {
+	return &node{
+		otype:    entities.ObjectTypeTree,
+		modTime:  now(),
+		etag:     metadatacontroller.NewETag(),
+		children: map[string]*node{},
+	}
+}
+
+// clone returns a deep copy of n with the given modification time and ETag.
+func (n *node) clone(modTime int64, etag string) *node {
+	cloned := *n
+	cloned.modTime = modTime
+	cloned.etag = etag
+	if n.children != nil {
+		cloned.children = make(map[string]*node, len(n.children))
+		for name, child := range n.children {
+			cloned.children[name] = child.clone(modTime, etag)
+		}
+	}
+	if n.props != nil {
+		cloned.props = make(map[string]string, len(n.props))
+		for k, v := range n.props {
+			cloned.props[k] = v
+		}
+	}
+	return &cloned
+}
+
+func getObjectInfo(pathSpec string, n *node) *entities.ObjectInfo {
+	oinfo := &entities.ObjectInfo{
+		PathSpec: pathSpec,
+		Size:     n.size,
+		Type:     n.otype,
+		Checksum: n.checksum,
+		ModTime:  n.modTime,
+	}
+	if n.otype == entities.ObjectTypeTree {
+		oinfo.MimeType = entities.ObjectTypeTreeMimeType
+	} else {
+		oinfo.MimeType = mime.TypeByExtension(path.Ext(pathSpec))
+	}
+	metadatacontroller.SetETag(oinfo, n.etag)
+	return oinfo
+}
+
+// split returns the names of the path components of pathSpec.
+func split(pathSpec string) []string {
+	p := strings.Trim(cleanPath(pathSpec), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// cleanPath returns the absolute clean form of pathSpec, avoiding
+// path traversal outside of the user namespace.
+func cleanPath(pathSpec string) string {
+	return path.Join("/", pathSpec)
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
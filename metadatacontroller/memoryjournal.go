@@ -0,0 +1,59 @@
+package metadatacontroller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// NewMemoryJournal returns a Journal keeping in memory the last max
+// changes of every user. The sequence numbers start again from 1 when
+// the process restarts, so the cursors of the clients expire.
+func NewMemoryJournal(max int) Journal {
+	return &memoryJournal{max: max, changes: map[string][]*Change{}, last: map[string]int64{}}
+}
+
+type memoryJournal struct {
+	max     int
+	mu      sync.Mutex
+	changes map[string][]*Change
+	last    map[string]int64
+}
+
+func (j *memoryJournal) Append(user *entities.User, change *Change) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.last[user.Username]++
+	change.Seq = j.last[user.Username]
+	change.Time = time.Now().Unix()
+	changes := append(j.changes[user.Username], change)
+	if len(changes) > j.max {
+		changes = changes[len(changes)-j.max:]
+	}
+	j.changes[user.Username] = changes
+	return nil
+}
+
+func (j *memoryJournal) Since(user *entities.User, seq int64, limit int) ([]*Change, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	kept := j.changes[user.Username]
+	last := j.last[user.Username]
+	if seq > last || (len(kept) > 0 && seq < kept[0].Seq-1) || (len(kept) == 0 && seq < last) {
+		return nil, errChangesExpired(seq)
+	}
+	changes := []*Change{}
+	for _, change := range kept {
+		if change.Seq > seq && (limit == 0 || len(changes) < limit) {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func errChangesExpired(seq int64) error {
+	return codes.NewErr(ChangesExpired, fmt.Sprintf("changes after %d are not kept", seq))
+}
@@ -1,14 +1,58 @@
 package metadatacontroller
 
 import (
+	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 )
 
+// Codes returned by metadata controllers for conditions not covered
+// by the general purpose codes defined in github.com/clawio/codes.
+const (
+	// AlreadyExists is returned when the object to be created
+	// is already present.
+	AlreadyExists codes.Code = 100 + iota
+	// NotSupported is returned by the operations of a feature the
+	// controller implements but that is not enabled in its options.
+	NotSupported
+	// QuotaExceeded is returned when the operation would make
+	// the user exceed its quota.
+	QuotaExceeded
+	// PreconditionFailed is returned when the condition given
+	// to a conditional operation does not hold.
+	PreconditionFailed
+	// NotModified is returned by conditional reads when the object
+	// still has one of the ETags the client already knows.
+	NotModified
+	// ChangesExpired is returned when the changes after a sequence
+	// number are no longer kept or the sequence number is unknown,
+	// and the client has to read the namespace again.
+	ChangesExpired
+)
+
 // MetaDataController is an interface to perform metadata operations.
+// Objects can have properties, user defined key/values that are carried
+// along when the object is moved or copied and removed with it.
+// The objects returned carry an ObjectExtra with their ETag.
 type MetaDataController interface {
 	Init(user *entities.User) error
+	CreateTree(user *entities.User, pathSpec string, recursive bool) error
 	ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error)
-	ListTree(user *entities.User, pathSpec string) ([]*entities.ObjectInfo, error)
+	ListTree(user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error)
 	DeleteObject(user *entities.User, pathSpec string) error
 	MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error
+	CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error
+	// SetProperties adds props to the properties of the object at pathSpec,
+	// replacing the values of the keys already present.
+	SetProperties(user *entities.User, pathSpec string, props map[string]string) error
+	GetProperties(user *entities.User, pathSpec string) (map[string]string, error)
+	// RemoveProperties removes the properties with the given keys from
+	// the object at pathSpec. Keys not present are ignored.
+	RemoveProperties(user *entities.User, pathSpec string, keys []string) error
+}
+
+// BLOBPutter is implemented by controllers that keep the namespace apart
+// from the BLOB data, so the component storing the data can register
+// new or overwritten BLOBs in the namespace.
+type BLOBPutter interface {
+	PutBLOB(user *entities.User, pathSpec string, size int64, checksum string) error
 }
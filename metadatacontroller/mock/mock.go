@@ -1,7 +1,10 @@
 package mock
 
 import (
+	"context"
+
 	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -16,6 +19,12 @@ func (m *MetaDataController) Init(user *entities.User) error {
 	return args.Error(0)
 }
 
+// CreateTree mocks the CreateTree call.
+func (m *MetaDataController) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 // ExamineObject mocks the ExamineObject call.
 func (m *MetaDataController) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
 	args := m.Called()
@@ -23,9 +32,9 @@ func (m *MetaDataController) ExamineObject(user *entities.User, pathSpec string)
 }
 
 // ListTree mocks the ListTree call.
-func (m *MetaDataController) ListTree(user *entities.User, pathSpec string) ([]*entities.ObjectInfo, error) {
+func (m *MetaDataController) ListTree(user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
 	args := m.Called()
-	return args.Get(0).([]*entities.ObjectInfo), args.Error(1)
+	return args.Get(0).([]*entities.ObjectInfo), args.String(1), args.Error(2)
 }
 
 // DeleteObject mocks the Delete call.
@@ -39,3 +48,123 @@ func (m *MetaDataController) MoveObject(user *entities.User, sourcePathSpec, tar
 	args := m.Called()
 	return args.Error(0)
 }
+
+// CopyObject mocks the CopyObject call.
+func (m *MetaDataController) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// SetProperties mocks the SetProperties call.
+func (m *MetaDataController) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// GetProperties mocks the GetProperties call.
+func (m *MetaDataController) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	args := m.Called()
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+// RemoveProperties mocks the RemoveProperties call.
+func (m *MetaDataController) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// ListTrash mocks the ListTrash call.
+func (m *MetaDataController) ListTrash(user *entities.User) ([]*metadatacontroller.TrashItem, error) {
+	args := m.Called()
+	return args.Get(0).([]*metadatacontroller.TrashItem), args.Error(1)
+}
+
+// RestoreTrashItem mocks the RestoreTrashItem call.
+func (m *MetaDataController) RestoreTrashItem(user *entities.User, id, targetPathSpec string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// PurgeTrashItem mocks the PurgeTrashItem call.
+func (m *MetaDataController) PurgeTrashItem(user *entities.User, id string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// PurgeTrash mocks the PurgeTrash call.
+func (m *MetaDataController) PurgeTrash(user *entities.User, before int64) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+// ListVersions mocks the ListVersions call.
+func (m *MetaDataController) ListVersions(user *entities.User, pathSpec string) ([]*metadatacontroller.Version, error) {
+	args := m.Called()
+	return args.Get(0).([]*metadatacontroller.Version), args.Error(1)
+}
+
+// ExamineVersion mocks the ExamineVersion call.
+func (m *MetaDataController) ExamineVersion(user *entities.User, pathSpec, id string) (*metadatacontroller.Version, error) {
+	args := m.Called()
+	return args.Get(0).(*metadatacontroller.Version), args.Error(1)
+}
+
+// RestoreVersion mocks the RestoreVersion call.
+func (m *MetaDataController) RestoreVersion(user *entities.User, pathSpec, id string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// DeleteVersion mocks the DeleteVersion call.
+func (m *MetaDataController) DeleteVersion(user *entities.User, pathSpec, id string) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// GetQuota mocks the GetQuota call.
+func (m *MetaDataController) GetQuota(user *entities.User) (*metadatacontroller.Quota, error) {
+	args := m.Called()
+	return args.Get(0).(*metadatacontroller.Quota), args.Error(1)
+}
+
+// Changes mocks the Changes call.
+func (m *MetaDataController) Changes(user *entities.User, since int64, limit int) ([]*metadatacontroller.Change, error) {
+	args := m.Called()
+	return args.Get(0).([]*metadatacontroller.Change), args.Error(1)
+}
+
+// SubscribeChanges mocks the SubscribeChanges call.
+func (m *MetaDataController) SubscribeChanges(user *entities.User) *metadatacontroller.Subscription {
+	args := m.Called()
+	return args.Get(0).(*metadatacontroller.Subscription)
+}
+
+// ExamineObjectIf mocks the ExamineObjectIf call.
+func (m *MetaDataController) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) (*entities.ObjectInfo, error) {
+	args := m.Called()
+	return args.Get(0).(*entities.ObjectInfo), args.Error(1)
+}
+
+// ListTreeIf mocks the ListTreeIf call.
+func (m *MetaDataController) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, cond *metadatacontroller.Condition) ([]*entities.ObjectInfo, string, error) {
+	args := m.Called()
+	return args.Get(0).([]*entities.ObjectInfo), args.String(1), args.Error(2)
+}
+
+// DeleteObjectIf mocks the DeleteObjectIf call.
+func (m *MetaDataController) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// MoveObjectIf mocks the MoveObjectIf call.
+func (m *MetaDataController) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *metadatacontroller.Condition) error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// ApplyBatch mocks the ApplyBatch call.
+func (m *MetaDataController) ApplyBatch(ctx context.Context, user *entities.User, ops []*metadatacontroller.BatchOperation) ([]*metadatacontroller.BatchResult, error) {
+	args := m.Called()
+	return args.Get(0).([]*metadatacontroller.BatchResult), args.Error(1)
+}
@@ -0,0 +1,45 @@
+package metadatacontroller
+
+import (
+	"strings"
+
+	"github.com/clawio/codes"
+)
+
+// Limits on the size of properties, so they can be stored
+// by every controller, like in the extended attributes of a file.
+const (
+	MaxPropertyKeyLen   = 200
+	MaxPropertyValueLen = 1024
+)
+
+// CheckProperties returns a BadInputData error if any of
+// the properties cannot be set.
+func CheckProperties(props map[string]string) error {
+	for k, v := range props {
+		if err := CheckPropertyKeys(k); err != nil {
+			return err
+		}
+		if len(v) > MaxPropertyValueLen {
+			return codes.NewErr(codes.BadInputData, "value of property "+k+" is too long")
+		}
+	}
+	return nil
+}
+
+// CheckPropertyKeys returns a BadInputData error if any of
+// the keys is not a valid property key.
+func CheckPropertyKeys(keys ...string) error {
+	for _, k := range keys {
+		if k == "" {
+			return codes.NewErr(codes.BadInputData, "property key is empty")
+		}
+		if len(k) > MaxPropertyKeyLen {
+			return codes.NewErr(codes.BadInputData, "property key is too long")
+		}
+		if strings.ContainsRune(k, 0) {
+			return codes.NewErr(codes.BadInputData, "property key contains a zero byte")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package metadatacontroller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	require.NotNil(t, err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(t, ok)
+	require.Equal(t, code, codeErr.Code)
+}
+
+func TestCheckProperties(t *testing.T) {
+	require.Nil(t, CheckProperties(map[string]string{"tag": "red", "description": ""}))
+	requireCode(t, codes.BadInputData, CheckProperties(map[string]string{"": "red"}))
+	requireCode(t, codes.BadInputData, CheckProperties(map[string]string{"tag": strings.Repeat("a", MaxPropertyValueLen+1)}))
+}
+
+func TestCheckPropertyKeys(t *testing.T) {
+	require.Nil(t, CheckPropertyKeys("tag", "description"))
+	requireCode(t, codes.BadInputData, CheckPropertyKeys("tag", ""))
+	requireCode(t, codes.BadInputData, CheckPropertyKeys(strings.Repeat("a", MaxPropertyKeyLen+1)))
+	requireCode(t, codes.BadInputData, CheckPropertyKeys("a\x00b"))
+}
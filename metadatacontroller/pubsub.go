@@ -0,0 +1,102 @@
+package metadatacontroller
+
+import (
+	"sync"
+
+	"github.com/clawio/entities"
+)
+
+// SubscriptionBuffer is the number of changes a subscriber can fall
+// behind before its subscription is dropped.
+const SubscriptionBuffer = 256
+
+// Subscription receives the changes of the namespace of an user.
+type Subscription struct {
+	// C receives the changes. It is closed when the subscription is
+	// closed or dropped because the subscriber fell behind, then
+	// the subscriber has to read the changes missed from the journal.
+	C <-chan *Change
+
+	c       chan *Change
+	user    string
+	broker  *broker
+	dropped bool
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s, false)
+}
+
+// Dropped reports whether the subscription was dropped because the
+// subscriber fell behind. It is only meaningful once C is closed.
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// broker publishes the changes of every user to its subscribers
+// without blocking on slow ones.
+type broker struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: map[string]map[*Subscription]struct{}{}}
+}
+
+func (b *broker) subscribe(user *entities.User) *Subscription {
+	c := make(chan *Change, SubscriptionBuffer)
+	s := &Subscription{C: c, c: c, user: user.Username, broker: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[s.user] == nil {
+		b.subs[s.user] = map[*Subscription]struct{}{}
+	}
+	b.subs[s.user][s] = struct{}{}
+	return s
+}
+
+func (b *broker) unsubscribe(s *Subscription, dropped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s, dropped)
+}
+
+// remove closes the subscription if still subscribed, b.mu must be held.
+func (b *broker) remove(s *Subscription, dropped bool) {
+	subs := b.subs[s.user]
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(b.subs, s.user)
+	}
+	s.dropped = dropped
+	close(s.c)
+}
+
+func (b *broker) publish(user *entities.User, change *Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[user.Username] {
+		select {
+		case s.c <- change:
+		default:
+			b.remove(s, true)
+		}
+	}
+}
+
+// drop drops the subscriptions of the user, which have to read
+// the changes missed from the journal.
+func (b *broker) drop(user *entities.User) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[user.Username] {
+		b.remove(s, true)
+	}
+}
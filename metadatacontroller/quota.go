@@ -0,0 +1,87 @@
+package metadatacontroller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+)
+
+// Usage is the space used by the BLOBs of an user and the number
+// of objects, BLOBs and trees, in its namespace.
+type Usage struct {
+	Bytes   int64
+	Objects int64
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{Bytes: u.Bytes + other.Bytes, Objects: u.Objects + other.Objects}
+}
+
+// Sub returns the difference of u and other.
+func (u Usage) Sub(other Usage) Usage {
+	return Usage{Bytes: u.Bytes - other.Bytes, Objects: u.Objects - other.Objects}
+}
+
+// QuotaLimit is the maximum usage allowed to an user.
+// A zero field means no limit.
+type QuotaLimit struct {
+	Bytes   int64
+	Objects int64
+}
+
+// Check returns a QuotaExceeded error if used plus delta goes over
+// the limit. Operations that do not increase the usage always pass.
+func (l QuotaLimit) Check(used, delta Usage) error {
+	after := used.Add(delta)
+	if l.Bytes > 0 && delta.Bytes > 0 && after.Bytes > l.Bytes {
+		return codes.NewErr(QuotaExceeded, fmt.Sprintf("quota of %d bytes exceeded", l.Bytes))
+	}
+	if l.Objects > 0 && delta.Objects > 0 && after.Objects > l.Objects {
+		return codes.NewErr(QuotaExceeded, fmt.Sprintf("quota of %d objects exceeded", l.Objects))
+	}
+	return nil
+}
+
+// QuotaLimits are the limits of every user: the embedded QuotaLimit
+// applies to all the users but the ones present in Users.
+type QuotaLimits struct {
+	QuotaLimit
+	Users map[string]QuotaLimit
+}
+
+// Get returns the limit of the user.
+func (l *QuotaLimits) Get(user *entities.User) QuotaLimit {
+	if limit, ok := l.Users[user.Username]; ok {
+		return limit
+	}
+	return l.QuotaLimit
+}
+
+// NewQuotaLimits returns the limits given by the Quota option of
+// a controller, encoded as JSON, or nil if the option is not set.
+func NewQuotaLimits(opts map[string]string) (*QuotaLimits, error) {
+	v := opts["Quota"]
+	if v == "" {
+		return nil, nil
+	}
+	limits := &QuotaLimits{}
+	if err := json.Unmarshal([]byte(v), limits); err != nil {
+		return nil, fmt.Errorf("invalid quota option: %s", err)
+	}
+	return limits, nil
+}
+
+// Quota is the usage and the limit of an user.
+type Quota struct {
+	Used  Usage
+	Limit QuotaLimit
+}
+
+// QuotaController is implemented by controllers that account
+// the usage of every user and enforce a quota on it.
+type QuotaController interface {
+	GetQuota(user *entities.User) (*Quota, error)
+}
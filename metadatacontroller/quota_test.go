@@ -0,0 +1,32 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaLimit_Check(t *testing.T) {
+	limit := QuotaLimit{Bytes: 100, Objects: 10}
+	require.Nil(t, limit.Check(Usage{Bytes: 50, Objects: 5}, Usage{Bytes: 50, Objects: 5}))
+	requireCode(t, QuotaExceeded, limit.Check(Usage{Bytes: 50, Objects: 5}, Usage{Bytes: 51}))
+	requireCode(t, QuotaExceeded, limit.Check(Usage{Bytes: 50, Objects: 10}, Usage{Objects: 1}))
+	// operations releasing space pass even over the limit.
+	require.Nil(t, limit.Check(Usage{Bytes: 200, Objects: 20}, Usage{Bytes: -10, Objects: -1}))
+	require.Nil(t, QuotaLimit{}.Check(Usage{Bytes: 200, Objects: 20}, Usage{Bytes: 10, Objects: 1}))
+}
+
+func TestNewQuotaLimits(t *testing.T) {
+	limits, err := NewQuotaLimits(map[string]string{})
+	require.Nil(t, err)
+	require.Nil(t, limits)
+
+	limits, err = NewQuotaLimits(map[string]string{"Quota": `{"Bytes": 100, "Users": {"admin": {"Objects": 5}}}`})
+	require.Nil(t, err)
+	require.Equal(t, QuotaLimit{Bytes: 100}, limits.Get(&entities.User{Username: "test"}))
+	require.Equal(t, QuotaLimit{Objects: 5}, limits.Get(&entities.User{Username: "admin"}))
+
+	_, err = NewQuotaLimits(map[string]string{"Quota": "100"})
+	require.NotNil(t, err)
+}
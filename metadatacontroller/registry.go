@@ -0,0 +1,54 @@
+package metadatacontroller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a MetaDataController from backend specific options.
+type Factory func(opts map[string]string) (MetaDataController, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a MetaDataController backend available under the given name.
+// It is meant to be called from the init function of the backend package.
+// If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("metadatacontroller: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("metadatacontroller: Register called twice for backend " + name)
+	}
+	factories[name] = factory
+}
+
+// Backends returns a sorted list of the names of the registered backends.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the MetaDataController created by the backend registered
+// under the given name.
+func New(name string, opts map[string]string) (MetaDataController, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("metadatacontroller: unknown backend %q (forgotten import?)", name)
+	}
+	return factory(opts)
+}
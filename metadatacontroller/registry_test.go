@@ -0,0 +1,33 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	Register("testregister", func(opts map[string]string) (MetaDataController, error) {
+		return nil, nil
+	})
+	require.Contains(t, Backends(), "testregister")
+	_, err := New("testregister", nil)
+	require.Nil(t, err)
+}
+
+func TestRegister_twice(t *testing.T) {
+	factory := func(opts map[string]string) (MetaDataController, error) {
+		return nil, nil
+	}
+	Register("testregistertwice", factory)
+	require.Panics(t, func() { Register("testregistertwice", factory) })
+}
+
+func TestRegister_withNilFactory(t *testing.T) {
+	require.Panics(t, func() { Register("testregisternil", nil) })
+}
+
+func TestNew_withUnknownBackend(t *testing.T) {
+	_, err := New("notexists", nil)
+	require.NotNil(t, err)
+}
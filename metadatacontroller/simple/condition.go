@@ -0,0 +1,54 @@
+package simple
+
+import (
+	"context"
+	"os"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+func (c *controller) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) (*entities.ObjectInfo, error) {
+	defer c.lockChanges(false)()
+	oinfo, err := c.ExamineObjectContext(ctx, user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := cond.Check(metadatacontroller.GetETag(oinfo), true); err != nil {
+		return nil, err
+	}
+	return oinfo, nil
+}
+
+func (c *controller) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, cond *metadatacontroller.Condition) ([]*entities.ObjectInfo, string, error) {
+	defer c.lockChanges(false)()
+	if cond != nil {
+		storagePath := c.getStoragePath(user, pathSpec)
+		finfo, err := os.Stat(storagePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, "", codes.NewErr(codes.NotFound, err.Error())
+			}
+			return nil, "", err
+		}
+		if err := cond.Check(getETag(storagePath, finfo), true); err != nil {
+			return nil, "", err
+		}
+	}
+	return c.ListTreeContext(ctx, user, pathSpec, opts)
+}
+
+// lockChanges locks the namespace for a change, exclusively if the change
+// depends on a check of the namespace, like a condition, and returns the
+// function unlocking it. Reads checking a condition lock it too, so no
+// conditional change happens between the check and the read. BLOBs
+// written directly to the metadata directory are not covered by the lock.
+func (c *controller) lockChanges(exclusive bool) func() {
+	if exclusive {
+		c.changesMu.Lock()
+		return c.changesMu.Unlock
+	}
+	c.changesMu.RLock()
+	return c.changesMu.RUnlock
+}
@@ -0,0 +1,73 @@
+package simple
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// The ETag of a BLOB is made of its modification time and size, so it
+// changes whenever the BLOB is written. Trees keep in an extended
+// attribute a tag renewed up to the home tree by every change made
+// through the controller, and their ETag is made of the tag and their
+// modification time, so it also changes when other components, like
+// the data service, create or remove objects in them. The ancestors of
+// such trees keep their ETag.
+const etagXattr = "user.clawio-etag"
+
+// getETag returns the ETag of the object at storagePath, described by finfo.
+func getETag(storagePath string, finfo os.FileInfo) string {
+	etag := strconv.FormatInt(finfo.ModTime().UnixNano(), 16)
+	if finfo.IsDir() {
+		if value, err := getXattr(storagePath, etagXattr); err == nil && len(value) > 0 {
+			return string(value) + "-" + etag
+		}
+		return etag
+	}
+	return etag + "-" + strconv.FormatInt(finfo.Size(), 16)
+}
+
+// propagateChange updates the trees from the parent of storagePath up to
+// the home tree of the user after the object at storagePath changed,
+// adding delta to their usage.
+func (c *controller) propagateChange(user *entities.User, storagePath string, delta metadatacontroller.Usage) error {
+	c.propagateUsage(user, storagePath, delta)
+	return c.propagateETag(user, storagePath)
+}
+
+// propagateETag gives a new ETag to the trees from the parent of
+// storagePath up to the home tree of the user. It returns the first
+// error found, after trying all the trees, as the change is already
+// done but clients syncing the trees would miss it.
+func (c *controller) propagateETag(user *entities.User, storagePath string) error {
+	etag := []byte(metadatacontroller.NewETag())
+	homePath := c.getStoragePath(user, "/")
+	var firstErr error
+	for p := path.Dir(storagePath); len(p) >= len(homePath); p = path.Dir(p) {
+		if err := setXattr(p, etagXattr, etag); err != nil {
+			// the tree falls back to its modification time,
+			// so at least it does not keep its old ETag.
+			removeXattr(p, etagXattr)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("ETag of tree not renewed: %v", err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// checkXattrs returns an error if the file system of dir, created if
+// missing, does not support extended attributes.
+func checkXattrs(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := setXattr(dir, etagXattr, []byte(metadatacontroller.NewETag())); err != nil {
+		return fmt.Errorf("MetaDataDir must support extended attributes: %v", err)
+	}
+	return removeXattr(dir, etagXattr)
+}
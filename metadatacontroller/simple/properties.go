@@ -0,0 +1,113 @@
+package simple
+
+import (
+	"os"
+	"strings"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// Properties are stored as extended attributes of the files, so the
+// file system carries them along when objects are renamed or deleted.
+const propertyXattrPrefix = "user.clawio."
+
+func (c *controller) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	if err := metadatacontroller.CheckProperties(props); err != nil {
+		return err
+	}
+	storagePath, err := c.getPropertiesPath(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	for k, v := range props {
+		if err := setXattr(storagePath, propertyXattrPrefix+k, []byte(v)); err != nil {
+			return propertiesError(err)
+		}
+	}
+	return nil
+}
+
+func (c *controller) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	storagePath, err := c.getPropertiesPath(user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	props, err := readProperties(storagePath)
+	if err != nil {
+		return nil, propertiesError(err)
+	}
+	return props, nil
+}
+
+func (c *controller) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	if err := metadatacontroller.CheckPropertyKeys(keys...); err != nil {
+		return err
+	}
+	storagePath, err := c.getPropertiesPath(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := removeXattr(storagePath, propertyXattrPrefix+k); err != nil {
+			return propertiesError(err)
+		}
+	}
+	return nil
+}
+
+// getPropertiesPath returns the storage path of the object
+// at pathSpec after checking that it exists.
+func (c *controller) getPropertiesPath(user *entities.User, pathSpec string) (string, error) {
+	storagePath := c.getStoragePath(user, pathSpec)
+	if _, err := os.Lstat(storagePath); err != nil {
+		return "", propertiesError(err)
+	}
+	return storagePath, nil
+}
+
+func readProperties(storagePath string) (map[string]string, error) {
+	names, err := listXattrs(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]string{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, propertyXattrPrefix) {
+			continue
+		}
+		value, err := getXattr(storagePath, name)
+		if err != nil {
+			return nil, err
+		}
+		props[strings.TrimPrefix(name, propertyXattrPrefix)] = string(value)
+	}
+	return props, nil
+}
+
+// copyProperties copies the properties of the file at source
+// to the file at target.
+func copyProperties(source, target string) error {
+	props, err := readProperties(source)
+	if err != nil || len(props) == 0 {
+		return err
+	}
+	for k, v := range props {
+		if err := setXattr(target, propertyXattrPrefix+k, []byte(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func propertiesError(err error) error {
+	if os.IsNotExist(err) {
+		return codes.NewErr(codes.NotFound, err.Error())
+	} else if isNotDir(err) {
+		return codes.NewErr(codes.NotFound, "object not found")
+	} else if isXattrSpaceError(err) {
+		return codes.NewErr(codes.BadInputData, "properties are too large")
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package simple
+
+import (
+	"os"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// The usage of every user is the usage kept by its home tree, as the
+// home tree itself is not accounted. The operations increasing the
+// usage reserve it before starting, so concurrent operations cannot go
+// over the quota together, and release the reservation when they fail
+// or in the same step as they update the usage of the trees.
+
+func (c *controller) GetQuota(user *entities.User) (*metadatacontroller.Quota, error) {
+	if c.quota == nil {
+		return nil, errQuotaDisabled()
+	}
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	used, err := c.getHomeUsage(user)
+	if err != nil {
+		return nil, err
+	}
+	return &metadatacontroller.Quota{Used: used, Limit: c.quota.Get(user)}, nil
+}
+
+// reservation is an increase of the usage of an user reserved
+// by an operation in progress.
+type reservation struct {
+	c     *controller
+	user  *entities.User
+	delta metadatacontroller.Usage
+}
+
+// reserveUsage reserves the increase of the usage of the user given by
+// delta if the quota allows it. The reservation must be released after
+// the operation.
+func (c *controller) reserveUsage(user *entities.User, delta metadatacontroller.Usage) (*reservation, error) {
+	r := &reservation{c: c, user: user}
+	if c.quota == nil {
+		return r, nil
+	}
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	used, err := c.getHomeUsage(user)
+	if err != nil {
+		return nil, err
+	}
+	reserved := c.reserved[user.Username]
+	if err := c.quota.Get(user).Check(used.Add(reserved), delta); err != nil {
+		return nil, err
+	}
+	// decreases are not reserved, they count once they are done.
+	if delta.Bytes > 0 {
+		r.delta.Bytes = delta.Bytes
+	}
+	if delta.Objects > 0 {
+		r.delta.Objects = delta.Objects
+	}
+	if r.delta != (metadatacontroller.Usage{}) {
+		c.reserved[user.Username] = reserved.Add(r.delta)
+	}
+	return r, nil
+}
+
+// release releases the reservation if it is still held.
+func (r *reservation) release() {
+	if r.c.quota == nil {
+		return
+	}
+	r.c.quotaMu.Lock()
+	defer r.c.quotaMu.Unlock()
+	r.releaseLocked()
+}
+
+// propagateChange is like controller.propagateChange, releasing the
+// reservation in the same step so the usage is never counted twice.
+func (r *reservation) propagateChange(storagePath string, delta metadatacontroller.Usage) error {
+	if r.c.quota != nil {
+		r.c.quotaMu.Lock()
+		defer r.c.quotaMu.Unlock()
+	}
+	defer r.releaseLocked()
+	return r.c.propagateChange(r.user, storagePath, delta)
+}
+
+func (r *reservation) releaseLocked() {
+	if r.delta == (metadatacontroller.Usage{}) {
+		return
+	}
+	if reserved := r.c.reserved[r.user.Username].Sub(r.delta); reserved == (metadatacontroller.Usage{}) {
+		delete(r.c.reserved, r.user.Username)
+	} else {
+		r.c.reserved[r.user.Username] = reserved
+	}
+	r.delta = metadatacontroller.Usage{}
+}
+
+// getHomeUsage returns the usage of the user.
+func (c *controller) getHomeUsage(user *entities.User) (metadatacontroller.Usage, error) {
+	homePath := c.getStoragePath(user, "/")
+	if _, err := os.Stat(homePath); err != nil {
+		if os.IsNotExist(err) {
+			return metadatacontroller.Usage{}, codes.NewErr(codes.NotFound, "user home tree not found")
+		}
+		return metadatacontroller.Usage{}, err
+	}
+	return c.readTreeUsage(homePath)
+}
+
+func errQuotaDisabled() error {
+	return codes.NewErr(metadatacontroller.NotSupported, "quota is not enabled")
+}
@@ -0,0 +1,129 @@
+package simple
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+// newQuotaController returns a controller enforcing limit
+// and the function removing its directories.
+func newQuotaController(t *testing.T, limit metadatacontroller.QuotaLimit) (*controller, func()) {
+	dir, err := ioutil.TempDir("", "clawio-simple-quota-")
+	require.Nil(t, err)
+	c := New(&Options{
+		MetaDataDir: path.Join(dir, "data"),
+		TrashDir:    path.Join(dir, "trash"),
+		Quota:       &metadatacontroller.QuotaLimits{QuotaLimit: limit},
+	}).(*controller)
+	require.Nil(t, c.Init(user))
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func requireUsage(t *testing.T, c *controller, bytes, objects int64) {
+	quota, err := c.GetQuota(user)
+	require.Nil(t, err)
+	require.Equal(t, metadatacontroller.Usage{Bytes: bytes, Objects: objects}, quota.Used)
+}
+
+func TestGetQuota(t *testing.T) {
+	c, cleanup := newQuotaController(t, metadatacontroller.QuotaLimit{Bytes: 100})
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree/othertree", true))
+	quota, err := c.GetQuota(user)
+	require.Nil(t, err)
+	require.Equal(t, metadatacontroller.QuotaLimit{Bytes: 100}, quota.Limit)
+	require.Equal(t, metadatacontroller.Usage{Objects: 2}, quota.Used)
+	// the BLOB written directly is not accounted by the home tree
+	// until its usage is rebuilt.
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/myblob"), []byte("12345"), 0644))
+	requireUsage(t, c, 0, 2)
+
+	require.Nil(t, removeXattr(c.getStoragePath(user, "/"), treeUsageXattr))
+	requireUsage(t, c, 5, 3)
+	require.Nil(t, c.CopyObject(user, "mytree", "copiedtree"))
+	requireUsage(t, c, 10, 6)
+	require.Nil(t, c.MoveObject(user, "copiedtree/myblob", "mytree/myblob"))
+	requireUsage(t, c, 5, 5)
+	require.Nil(t, c.DeleteObject(user, "copiedtree"))
+	requireUsage(t, c, 5, 3)
+
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Nil(t, c.RestoreTrashItem(user, items[0].ID, ""))
+	requireUsage(t, c, 5, 5)
+}
+
+func TestCreateTree_withQuotaExceeded(t *testing.T) {
+	c, cleanup := newQuotaController(t, metadatacontroller.QuotaLimit{Objects: 2})
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	err := c.CreateTree(user, "othertree/nested", true)
+	conformance.RequireCode(t, metadatacontroller.QuotaExceeded, err)
+	_, err = c.ExamineObject(user, "othertree")
+	conformance.RequireCode(t, codes.NotFound, err)
+	require.Nil(t, c.CreateTree(user, "othertree", false))
+	requireUsage(t, c, 0, 2)
+
+	// failed operations do not change the usage.
+	require.Nil(t, c.DeleteObject(user, "othertree"))
+	err = c.CreateTree(user, "mytree", false)
+	conformance.RequireCode(t, metadatacontroller.AlreadyExists, err)
+	requireUsage(t, c, 0, 1)
+}
+
+func TestCopyObject_withQuotaExceeded(t *testing.T) {
+	c, cleanup := newQuotaController(t, metadatacontroller.QuotaLimit{Bytes: 8})
+	defer cleanup()
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "myblob"), []byte("12345"), 0644))
+	err := c.CopyObject(user, "myblob", "otherblob")
+	conformance.RequireCode(t, metadatacontroller.QuotaExceeded, err)
+	_, err = c.ExamineObject(user, "otherblob")
+	conformance.RequireCode(t, codes.NotFound, err)
+	requireUsage(t, c, 5, 1)
+}
+
+func TestCopyObject_concurrentlyWithQuota(t *testing.T) {
+	c, cleanup := newQuotaController(t, metadatacontroller.QuotaLimit{Bytes: 20})
+	defer cleanup()
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "myblob"), []byte("12345"), 0644))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.CopyObject(user, "myblob", fmt.Sprintf("copiedblob%d", i))
+		}(i)
+	}
+	wg.Wait()
+	// only three copies fit in the quota, whatever their order.
+	requireUsage(t, c, 20, 4)
+}
+
+func TestGetQuota_withQuotaDisabled(t *testing.T) {
+	c := New(&Options{MetaDataDir: "/tmp/t"}).(*controller)
+	_, err := c.GetQuota(user)
+	conformance.RequireCode(t, metadatacontroller.NotSupported, err)
+}
+
+func TestConformance_withQuota(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) *conformance.Backend {
+		c, cleanup := newQuotaController(t, metadatacontroller.QuotaLimit{})
+		return &conformance.Backend{
+			Controller: c,
+			PutBLOB: func(user *entities.User, pathSpec string, size int64) error {
+				return ioutil.WriteFile(c.getStoragePath(user, pathSpec), make([]byte, size), 0644)
+			},
+			Cleanup: cleanup,
+		}
+	})
+}
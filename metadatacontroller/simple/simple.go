@@ -1,18 +1,84 @@
 package simple
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
 	"mime"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/metadata/metadatacontroller"
 )
 
+func init() {
+	metadatacontroller.Register("simple", func(opts map[string]string) (metadatacontroller.MetaDataController, error) {
+		retention, err := metadatacontroller.NewVersionRetention(opts)
+		if err != nil {
+			return nil, err
+		}
+		quota, err := metadatacontroller.NewQuotaLimits(opts)
+		if err != nil {
+			return nil, err
+		}
+		options := &Options{
+			MetaDataDir:       opts["MetaDataDir"],
+			Checksum:          opts["Checksum"],
+			TrashDir:          opts["TrashDir"],
+			VersionsDir:       opts["VersionsDir"],
+			VersionsRetention: *retention,
+			Quota:             quota,
+			TreeSizes:         opts["TreeSizes"] == "true",
+		}
+		// without extended attributes the trees could not keep
+		// their ETags and their usage.
+		if err := checkXattrs(options.MetaDataDir); err != nil {
+			return nil, err
+		}
+		return New(options), nil
+	})
+}
+
+// stagingDirName is the directory of MetaDataDir where copies are built
+// before being renamed into place and deleted objects are renamed to
+// before being removed, so they are in the same file system as the home
+// trees. The homes of the users are MetaDataDir/<letter>/<username>, or
+// MetaDataDir/<username> for usernames starting with a dot, so a name
+// longer than one letter not starting with a dot cannot clash with them.
+const stagingDirName = "_staging"
+
 type controller struct {
-	tempDir     string
 	metaDataDir string
+	checksum    string
+	trashDir    string
+	versionsDir string
+	retention   *metadatacontroller.VersionRetention
+	quota       *metadatacontroller.QuotaLimits
+	// quotaMu serializes the reservations of usage of the users.
+	quotaMu   sync.Mutex
+	reserved  map[string]metadatacontroller.Usage
+	treeSizes bool
+	// treeUsage makes the trees keep the usage of their descendants,
+	// needed by the tree sizes and the quota.
+	treeUsage bool
+	// treeUsageMu serializes the updates of the usages of the trees
+	// and treeUsageGen counts them.
+	treeUsageMu  sync.Mutex
+	treeUsageGen uint64
+	// changesMu is held for reading by the changes of the namespace
+	// and for writing by the conditional ones, so nothing changes
+	// between checking their condition and applying them.
+	changesMu sync.RWMutex
 }
 
 // New returns an implementation of MetaDataController.
@@ -22,18 +88,53 @@ func New(opts *Options) metadatacontroller.MetaDataController {
 	}
 	return &controller{
 		metaDataDir: opts.MetaDataDir,
-		tempDir:     opts.TempDir,
+		checksum:    opts.Checksum,
+		trashDir:    opts.TrashDir,
+		versionsDir: opts.VersionsDir,
+		retention:   &opts.VersionsRetention,
+		quota:       opts.Quota,
+		reserved:    map[string]metadatacontroller.Usage{},
+		treeSizes:   opts.TreeSizes,
+		treeUsage:   opts.TreeSizes || opts.Quota != nil,
 	}
 }
 
 // Options hold the configuration options for the
 // SimpleMetaDataController.
 type Options struct {
+	// MetaDataDir is the directory of the home trees. Its file system
+	// must support extended attributes.
 	MetaDataDir string
-	TempDir     string
+	// Checksum is the algorithm used to compute the checksum
+	// of BLOBs (md5, sha1 or sha256). Checksums are not
+	// computed if empty.
+	Checksum string
+	// TrashDir is the directory where deleted objects are kept until
+	// they are restored or purged. It must be in the same file system
+	// as MetaDataDir. Objects are removed right away if empty.
+	TrashDir string
+	// VersionsDir is the directory where the previous versions of BLOBs
+	// are kept when they are replaced. Versions are not kept if empty.
+	VersionsDir       string
+	VersionsRetention metadatacontroller.VersionRetention
+	// Quota are the limits enforced on the usage of the users.
+	// The usage is not accounted if nil.
+	Quota *metadatacontroller.QuotaLimits
+	// TreeSizes makes trees report the recursive size of their BLOBs
+	// instead of the size of the directory entry. Like the usage of
+	// the quota, the sizes only follow the changes made through the
+	// controller and the BLOBs created in a tree by other components.
+	TreeSizes bool
 }
 
 func (c *controller) Init(user *entities.User) error {
+	return c.InitContext(context.Background(), user)
+}
+
+func (c *controller) InitContext(ctx context.Context, user *entities.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	storagePath := c.getStoragePath(user, "/")
 	if err := os.MkdirAll(storagePath, 0755); err != nil {
 		return err
@@ -41,20 +142,58 @@ func (c *controller) Init(user *entities.User) error {
 	return nil
 }
 
-func (c *controller) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+func (c *controller) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	return c.CreateTreeContext(context.Background(), user, pathSpec, recursive)
+}
+
+func (c *controller) CreateTreeContext(ctx context.Context, user *entities.User, pathSpec string, recursive bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer c.lockChanges(false)()
 	storagePath := c.getStoragePath(user, pathSpec)
-	finfo, err := os.Stat(storagePath)
+	// the trees created are accounted as descendants of the topmost
+	// one, the only one changing an existing tree.
+	created, top := metadatacontroller.Usage{Objects: 1}, storagePath
+	if recursive {
+		missing, topMissing := countMissing(storagePath, c.getStoragePath(user, "/"))
+		created.Objects, top = int64(missing), topMissing
+	}
+	reserved, err := c.reserveUsage(user, created)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, codes.NewErr(codes.NotFound, err.Error())
+		return err
+	}
+	defer reserved.release()
+	c.dropStaleTreeUsage(top)
+	if recursive {
+		err = os.MkdirAll(storagePath, 0755)
+	} else {
+		err = os.Mkdir(storagePath, 0755)
+	}
+	if err != nil {
+		if os.IsExist(err) {
+			return codes.NewErr(metadatacontroller.AlreadyExists, err.Error())
+		} else if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		} else if isNotDir(err) {
+			return codes.NewErr(codes.BadInputData, err.Error())
 		}
-		return nil, err
+		return err
 	}
-	oinfo := c.getObjectInfo(pathSpec, finfo)
-	return oinfo, nil
+	if created.Objects > 0 {
+		return reserved.propagateChange(top, created)
+	}
+	return nil
+}
+
+func (c *controller) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	return c.ExamineObjectContext(context.Background(), user, pathSpec)
 }
 
-func (c *controller) ListTree(user *entities.User, pathSpec string) ([]*entities.ObjectInfo, error) {
+func (c *controller) ExamineObjectContext(ctx context.Context, user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	storagePath := c.getStoragePath(user, pathSpec)
 	finfo, err := os.Stat(storagePath)
 	if err != nil {
@@ -63,42 +202,238 @@ func (c *controller) ListTree(user *entities.User, pathSpec string) ([]*entities
 		}
 		return nil, err
 	}
-	if !finfo.IsDir() {
-		return nil, codes.NewErr(codes.BadInputData, "object is not a tree")
+	return c.getObjectInfo(pathSpec, storagePath, finfo)
+}
+
+func (c *controller) ListTree(user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.ListTreeContext(context.Background(), user, pathSpec, opts)
+}
+
+func (c *controller) ListTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
+	var oinfos []*entities.ObjectInfo
+	next, err := c.StreamTreeContext(ctx, user, pathSpec, opts, func(oinfo *entities.ObjectInfo) error {
+		oinfos = append(oinfos, oinfo)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	fd, err := os.Open(storagePath)
+	return oinfos, next, nil
+}
+
+func (c *controller) StreamTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, fn metadatacontroller.ListFunc) (string, error) {
+	order, err := opts.GetSort()
+	if err != nil {
+		return "", err
+	}
+	depth, err := opts.GetDepth()
+	if err != nil {
+		return "", err
+	}
+	finfo, err := os.Stat(c.getStoragePath(user, pathSpec))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, codes.NewErr(codes.NotFound, err.Error())
+			return "", codes.NewErr(codes.NotFound, err.Error())
 		}
-		return nil, err
+		return "", err
+	}
+	if !finfo.IsDir() {
+		return "", codes.NewErr(codes.BadInputData, "object is not a tree")
 	}
-	finfos, err := fd.Readdir(-1) // read all files inside the directory.
+
+	// the entries are read with the information needed to sort them and
+	// only the entries of the requested page are completed with their
+	// mime type and checksum. Sorting by name in a single level does not
+	// even need to stat the entries.
+	finfos := map[string]os.FileInfo{}
+	readChildren := func(pathSpec string, stat bool) ([]*entities.ObjectInfo, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fd, err := os.Open(c.getStoragePath(user, pathSpec))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, codes.NewErr(codes.NotFound, err.Error())
+			}
+			return nil, err
+		}
+		defer fd.Close()
+		var entries []*entities.ObjectInfo
+		if !stat {
+			names, err := fd.Readdirnames(-1)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range names {
+				entries = append(entries, &entities.ObjectInfo{PathSpec: path.Join(pathSpec, name)})
+			}
+			return entries, nil
+		}
+		fis, err := fd.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			p := path.Join(pathSpec, fi.Name())
+			finfos[p] = fi
+			entry := newObjectInfo(p, fi)
+			size, err := c.getObjectSize(c.getStoragePath(user, p), fi)
+			if err != nil {
+				return nil, err
+			}
+			entry.Size = size
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+
+	emit := func(entry *entities.ObjectInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		storagePath := c.getStoragePath(user, entry.PathSpec)
+		fi, ok := finfos[entry.PathSpec]
+		if ok {
+			delete(finfos, entry.PathSpec)
+		} else {
+			var err error
+			fi, err = os.Lstat(storagePath)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil // removed while listing.
+				}
+				return err
+			}
+		}
+		oinfo, err := c.getObjectInfo(entry.PathSpec, storagePath, fi)
+		if err != nil {
+			return err
+		}
+		return fn(oinfo)
+	}
+
+	if depth != 1 {
+		return metadatacontroller.WalkFunc(pathSpec, opts, func(pathSpec string) ([]*entities.ObjectInfo, error) {
+			return readChildren(pathSpec, true)
+		}, emit)
+	}
+	entries, err := readChildren(pathSpec, order != metadatacontroller.SortByName)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	var oinfos []*entities.ObjectInfo
-	for _, fi := range finfos {
-		p := path.Join(pathSpec, path.Base(fi.Name()))
-		oinfos = append(oinfos, c.getObjectInfo(p, fi))
+	page, next, err := metadatacontroller.Paginate(entries, opts)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range page {
+		if err := emit(entry); err != nil {
+			return "", err
+		}
 	}
-	return oinfos, nil
+	return next, nil
 }
 
 func (c *controller) DeleteObject(user *entities.User, pathSpec string) error {
+	return c.DeleteObjectContext(context.Background(), user, pathSpec)
+}
+
+func (c *controller) DeleteObjectContext(ctx context.Context, user *entities.User, pathSpec string) error {
+	return c.DeleteObjectIf(ctx, user, pathSpec, nil)
+}
+
+func (c *controller) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) error {
+	if isRoot(pathSpec) {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be deleted")
+	}
+	defer c.lockChanges(cond != nil)()
 	storagePath := c.getStoragePath(user, pathSpec)
-	err := os.RemoveAll(storagePath)
+	finfo, err := os.Lstat(storagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		}
+		return err
+	}
+	if err := cond.Check(getETag(storagePath, finfo), false); err != nil {
+		return err
+	}
+	deleted, err := c.getUsage(storagePath)
 	if err != nil {
 		return err
 	}
-	return nil
+	size, err := c.getObjectSize(storagePath, finfo)
+	if err != nil {
+		return err
+	}
+	// the object is moved away at once, so the deletion is not
+	// cancelled once it starts.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.dropStaleTreeUsage(storagePath)
+	if c.trashDir != "" {
+		err = c.moveToTrash(user, pathSpec, finfo, size)
+	} else {
+		err = c.removeObject(storagePath)
+	}
+	if err != nil {
+		return err
+	}
+	if c.trashDir == "" {
+		c.removeVersionsDir(c.getObjectVersionsPath(user, pathSpec))
+	}
+	return c.propagateChange(user, storagePath, metadatacontroller.Usage{}.Sub(deleted))
 }
 
 func (c *controller) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.MoveObjectContext(context.Background(), user, sourcePathSpec, targetPathSpec)
+}
+
+func (c *controller) MoveObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.MoveObjectIf(ctx, user, sourcePathSpec, targetPathSpec, nil)
+}
+
+func (c *controller) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if isRoot(sourcePathSpec) {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be moved")
+	}
+	defer c.lockChanges(cond != nil)()
 	sourceStoragePath := c.getStoragePath(user, sourcePathSpec)
 	targetStoragePath := c.getStoragePath(user, targetPathSpec)
-	err := os.Rename(sourceStoragePath, targetStoragePath)
+	if cond != nil {
+		finfo, err := os.Lstat(sourceStoragePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return codes.NewErr(codes.NotFound, err.Error())
+			}
+			return err
+		}
+		if err := cond.Check(getETag(sourceStoragePath, finfo), false); err != nil {
+			return err
+		}
+	}
+	var moved, replaced metadatacontroller.Usage
+	if sourceStoragePath != targetStoragePath {
+		var err error
+		if moved, err = c.getUsage(sourceStoragePath); err != nil {
+			return err
+		}
+		if replaced, err = c.getUsage(targetStoragePath); err != nil {
+			return err
+		}
+	}
+	undo, err := c.keepReplacedVersion(user, sourceStoragePath, targetPathSpec)
 	if err != nil {
+		return err
+	}
+	c.dropStaleTreeUsage(sourceStoragePath)
+	c.dropStaleTreeUsage(targetStoragePath)
+	err = os.Rename(sourceStoragePath, targetStoragePath)
+	if err != nil {
+		undo()
 		if os.IsNotExist(err) {
 			return codes.NewErr(codes.NotFound, err.Error())
 		} else if _, ok := err.(*os.LinkError); ok {
@@ -106,22 +441,275 @@ func (c *controller) MoveObject(user *entities.User, sourcePathSpec, targetPathS
 		}
 		return err
 	}
-	return nil
+	err = c.propagateChange(user, sourceStoragePath, metadatacontroller.Usage{}.Sub(moved))
+	if targetErr := c.propagateChange(user, targetStoragePath, moved.Sub(replaced)); err == nil {
+		err = targetErr
+	}
+	c.moveVersions(user, sourcePathSpec, targetPathSpec)
+	c.pruneVersions(user, targetPathSpec)
+	return err
 }
+
+func (c *controller) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.CopyObjectContext(context.Background(), user, sourcePathSpec, targetPathSpec)
+}
+
+func (c *controller) CopyObjectContext(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	defer c.lockChanges(false)()
+	sourceStoragePath := c.getStoragePath(user, sourcePathSpec)
+	targetStoragePath := c.getStoragePath(user, targetPathSpec)
+	if _, err := os.Stat(path.Dir(targetStoragePath)); err != nil {
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		}
+		return err
+	}
+
+	copied, err := c.getUsage(sourceStoragePath)
+	if err != nil {
+		return err
+	}
+	replaced, err := c.getUsage(targetStoragePath)
+	if err != nil {
+		return err
+	}
+	reserved, err := c.reserveUsage(user, copied.Sub(replaced))
+	if err != nil {
+		return err
+	}
+	defer reserved.release()
+
+	// the copy is staged in the staging directory and renamed
+	// into place at the end so a half-finished copy never
+	// becomes visible.
+	stageDir, err := c.newStagingDir("copy-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	stageStoragePath := path.Join(stageDir, "object")
+	if err := copyObject(ctx, sourceStoragePath, stageStoragePath); err != nil {
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		}
+		return err
+	}
+	undo, err := c.keepReplacedVersion(user, sourceStoragePath, targetPathSpec)
+	if err != nil {
+		return err
+	}
+	c.dropStaleTreeUsage(targetStoragePath)
+	if err := os.Rename(stageStoragePath, targetStoragePath); err != nil {
+		undo()
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		} else if _, ok := err.(*os.LinkError); ok {
+			return codes.NewErr(codes.BadInputData, err.Error())
+		}
+		return err
+	}
+	if sourceStoragePath != targetStoragePath {
+		err = reserved.propagateChange(targetStoragePath, copied.Sub(replaced))
+	}
+	c.pruneVersions(user, targetPathSpec)
+	return err
+}
+
 func (c *controller) getStoragePath(user *entities.User, path string) string {
 	homeDir := secureJoin("/", string(user.Username[0]), user.Username)
 	userPath := secureJoin(homeDir, path)
 	return secureJoin(c.metaDataDir, userPath)
 }
 
-func (c *controller) getObjectInfo(pathSpec string, finfo os.FileInfo) *entities.ObjectInfo {
-	oinfo := &entities.ObjectInfo{PathSpec: pathSpec, Size: finfo.Size(), Type: entities.ObjectTypeBLOB}
+func (c *controller) getObjectInfo(pathSpec, storagePath string, finfo os.FileInfo) (*entities.ObjectInfo, error) {
+	oinfo := newObjectInfo(pathSpec, finfo)
+	size, err := c.getObjectSize(storagePath, finfo)
+	if err != nil {
+		return nil, err
+	}
+	oinfo.Size = size
+	oinfo.MimeType = c.getMimeType(pathSpec, oinfo.Type)
+	metadatacontroller.SetETag(oinfo, getETag(storagePath, finfo))
+	if oinfo.Type == entities.ObjectTypeBLOB && c.checksum != "" {
+		checksum, err := c.getChecksum(storagePath, finfo)
+		if err != nil {
+			return nil, err
+		}
+		oinfo.Checksum = checksum
+	}
+	return oinfo, nil
+}
+
+// newObjectInfo returns the information of finfo that is cheap to obtain,
+// leaving out the mime type and the checksum.
+func newObjectInfo(pathSpec string, finfo os.FileInfo) *entities.ObjectInfo {
+	oinfo := &entities.ObjectInfo{
+		PathSpec: pathSpec,
+		Size:     finfo.Size(),
+		Type:     entities.ObjectTypeBLOB,
+		ModTime:  finfo.ModTime().Unix(),
+	}
 	if finfo.IsDir() {
 		oinfo.Type = entities.ObjectTypeTree
 	}
 	return oinfo
 }
 
+// checksumXattr is the extended attribute keeping the checksum of a
+// BLOB after the modification time and size it was computed for,
+// separated by a space, so it is computed again when they change.
+const checksumXattr = "user.clawio-checksum"
+
+// getChecksum returns the checksum of the BLOB at storagePath, described
+// by finfo, prefixed by the name of the algorithm, like
+// md5:d41d8cd98f00b204e9800998ecf8427e.
+func (c *controller) getChecksum(storagePath string, finfo os.FileInfo) (string, error) {
+	key := getETag(storagePath, finfo) + " "
+	if value, err := getXattr(storagePath, checksumXattr); err == nil {
+		if checksum := strings.TrimPrefix(string(value), key); len(checksum) < len(value) && strings.HasPrefix(checksum, c.checksum+":") {
+			return checksum, nil
+		}
+	}
+	checksum, err := c.computeChecksum(storagePath)
+	if err != nil {
+		return "", err
+	}
+	// the checksum is computed on every read if it cannot be kept.
+	setXattr(storagePath, checksumXattr, []byte(key+checksum))
+	return checksum, nil
+}
+
+// computeChecksum computes the checksum of the BLOB at storagePath.
+func (c *controller) computeChecksum(storagePath string) (string, error) {
+	var h hash.Hash
+	switch c.checksum {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return "", fmt.Errorf("checksum %q is not supported", c.checksum)
+	}
+	fd, err := os.Open(storagePath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%x", c.checksum, h.Sum(nil)), nil
+}
+
+// copyObject copies recursively the object at source to target,
+// with its properties.
+// It stops when ctx is done.
+func copyObject(ctx context.Context, source, target string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	finfo, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !finfo.IsDir() {
+		if err := copyBLOB(source, target, finfo.Mode().Perm()); err != nil {
+			return err
+		}
+		return copyProperties(source, target)
+	}
+	if err := os.Mkdir(target, finfo.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyProperties(source, target); err != nil {
+		return err
+	}
+	fd, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	names, err := fd.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := copyObject(ctx, path.Join(source, name), path.Join(target, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countMissing returns the number of directories missing in the path
+// from storagePath up to homePath, that must exist, and the path of the
+// topmost one.
+func countMissing(storagePath, homePath string) (int, string) {
+	missing, top := 0, storagePath
+	for p := storagePath; p != homePath && p != "/" && p != "."; p = path.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		missing, top = missing+1, p
+	}
+	return missing, top
+}
+
+// newStagingDir creates a new directory in the staging directory, with
+// a name starting with prefix, and returns its path.
+func (c *controller) newStagingDir(prefix string) (string, error) {
+	stagingPath := path.Join(c.metaDataDir, stagingDirName)
+	if err := os.MkdirAll(stagingPath, 0755); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(stagingPath, prefix)
+}
+
+// removeObject removes recursively the object at storagePath. The object
+// is renamed into the staging directory first, so it disappears at once
+// and is never left half removed in the home tree.
+func (c *controller) removeObject(storagePath string) error {
+	stageDir, err := c.newStagingDir("delete-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	return os.Rename(storagePath, path.Join(stageDir, "object"))
+}
+
+func copyBLOB(source, target string, mode os.FileMode) error {
+	reader, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// isRoot reports whether pathSpec points to the home tree of the user.
+func isRoot(pathSpec string) bool {
+	return secureJoin("/", pathSpec) == "/"
+}
+
+// isNotDir reports whether err is caused by a path component
+// that is not a directory.
+func isNotDir(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.ENOTDIR
+	}
+	return false
+}
+
 // secureJoin avoids path traversal attacks when joinning paths.
 func secureJoin(args ...string) string {
 	if len(args) > 1 {
@@ -1,12 +1,17 @@
 package simple
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
+	"path"
 	"testing"
+	"time"
 
+	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -22,10 +27,37 @@ type TestSuite struct {
 func Test(t *testing.T) {
 	suite.Run(t, new(TestSuite))
 }
+
+func TestConformance(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) *conformance.Backend {
+		dir, err := ioutil.TempDir("", "clawio-simple-")
+		require.Nil(t, err)
+		metadataController := New(&Options{MetaDataDir: path.Join(dir, "metadata")})
+		c := metadataController.(*controller)
+		return &conformance.Backend{
+			Controller: metadataController,
+			PutBLOB: func(user *entities.User, pathSpec string, size int64) error {
+				return ioutil.WriteFile(c.getStoragePath(user, pathSpec), make([]byte, size), 0644)
+			},
+			Cleanup: func() {
+				os.RemoveAll(dir)
+			},
+		}
+	})
+}
+
+func TestCheckXattrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clawio-simple-xattrs-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, checkXattrs(path.Join(dir, "data")))
+	names, err := listXattrs(path.Join(dir, "data"))
+	require.Nil(t, err)
+	require.Empty(t, names)
+}
 func (suite *TestSuite) SetupTest() {
 	opts := &Options{
 		MetaDataDir: "/tmp",
-		TempDir:     "/tmp",
 	}
 	metadataController := New(opts)
 	// create homedir for user test
@@ -40,13 +72,19 @@ func (suite *TestSuite) TeardownTest() {
 func (suite *TestSuite) New() {
 	opts := &Options{
 		MetaDataDir: "/tmp",
-		TempDir:     "/tmp",
 	}
 	require.IsType(suite.T(), &controller{}, New(opts))
 }
 func (suite *TestSuite) TestNew_withNilOptions() {
 	require.IsType(suite.T(), &controller{}, New(nil))
 }
+func (suite *TestSuite) TestRegister() {
+	opts := map[string]string{"MetaDataDir": "/tmp", "Checksum": "md5"}
+	metadataController, err := metadatacontroller.New("simple", opts)
+	require.Nil(suite.T(), err)
+	require.IsType(suite.T(), &controller{}, metadataController)
+	require.Equal(suite.T(), "md5", metadataController.(*controller).checksum)
+}
 func (suite *TestSuite) TestInit() {
 	err := suite.metadataController.Init(user)
 	require.Nil(suite.T(), err)
@@ -57,6 +95,50 @@ func (suite *TestSuite) TestInit_withError() {
 	require.NotNil(suite.T(), err)
 }
 
+func (suite *TestSuite) TestCreateTree() {
+	os.RemoveAll(suite.controller.getStoragePath(user, "testcreatetree"))
+	err := suite.metadataController.CreateTree(user, "testcreatetree", false)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "testcreatetree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTree, info.Type)
+}
+func (suite *TestSuite) TestCreateTree_withAlreadyExists() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testcreatetreeexists"), 0755)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "testcreatetreeexists", false)
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), metadatacontroller.AlreadyExists, codeErr.Code)
+}
+func (suite *TestSuite) TestCreateTree_withParentNotFound() {
+	err := suite.metadataController.CreateTree(user, "notexists/testcreatetree", false)
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.NotFound, codeErr.Code)
+}
+func (suite *TestSuite) TestCreateTree_withParentBLOB() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "testcreatetreeblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "testcreatetreeblob/mytree", true)
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.BadInputData, codeErr.Code)
+}
+func (suite *TestSuite) TestCreateTree_recursive() {
+	err := suite.metadataController.CreateTree(user, "testcreatetreerecursive/a/b", true)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "testcreatetreerecursive/a/b")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTree, info.Type)
+	// creating an existing tree recursively is not an error
+	err = suite.metadataController.CreateTree(user, "testcreatetreerecursive/a/b", true)
+	require.Nil(suite.T(), err)
+}
+
 func (suite *TestSuite) TestExamineObject() {
 	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
 	require.Nil(suite.T(), err)
@@ -69,6 +151,82 @@ func (suite *TestSuite) TestExamineObject() {
 	require.Equal(suite.T(), entities.ObjectTypeBLOB, info.Type)
 }
 
+func (suite *TestSuite) TestExamineObject_withMimeTypeAndModTime() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob.pdf"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "myblob.pdf")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "application/pdf", info.MimeType)
+	require.NotEqual(suite.T(), int64(0), info.ModTime)
+}
+
+func (suite *TestSuite) TestExamineObject_withChecksum() {
+	suite.controller.checksum = "md5"
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "md5:c4ca4238a0b923820dcc509a6f75849b", info.Checksum)
+}
+
+func (suite *TestSuite) TestExamineObject_withKeptChecksum() {
+	suite.controller.checksum = "md5"
+	storagePath := suite.controller.getStoragePath(user, "myblob")
+	err := ioutil.WriteFile(storagePath, []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "myblob")
+	require.Nil(suite.T(), err)
+	finfo, err := os.Stat(storagePath)
+	require.Nil(suite.T(), err)
+	err = setXattr(storagePath, checksumXattr, []byte(getETag(storagePath, finfo)+" md5:kept"))
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "md5:kept", info.Checksum)
+
+	err = ioutil.WriteFile(storagePath, []byte("22"), 0644)
+	require.Nil(suite.T(), err)
+	info, err = suite.metadataController.ExamineObject(user, "myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "md5:b6d767d2f8ed5d21a44b0e5886680cb9", info.Checksum)
+}
+
+func (suite *TestSuite) TestExamineObject_withUnsupportedChecksum() {
+	suite.controller.checksum = "crc64"
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "myblob")
+	require.NotNil(suite.T(), err)
+}
+
+func (suite *TestSuite) TestExamineObject_withTree() {
+	suite.controller.checksum = "md5"
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testexaminetree"), 0755)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "testexaminetree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTreeMimeType, info.MimeType)
+	require.Equal(suite.T(), "", info.Checksum)
+}
+
+func (suite *TestSuite) TestExamineObject_withTreeModifiedDirectly() {
+	require.Nil(suite.T(), suite.metadataController.CreateTree(user, "testetagtree/child", true))
+	require.Nil(suite.T(), suite.metadataController.DeleteObject(user, "testetagtree/child"))
+	info, err := suite.metadataController.ExamineObject(user, "testetagtree")
+	require.Nil(suite.T(), err)
+	etag := metadatacontroller.GetETag(info)
+
+	// the ETag kept by the tree is not renewed by BLOBs written
+	// directly, but its modification time is.
+	storagePath := suite.controller.getStoragePath(user, "testetagtree")
+	require.Nil(suite.T(), ioutil.WriteFile(path.Join(storagePath, "myblob"), nil, 0644))
+	modTime := time.Now().Add(time.Minute)
+	require.Nil(suite.T(), os.Chtimes(storagePath, modTime, modTime))
+	info, err = suite.metadataController.ExamineObject(user, "testetagtree")
+	require.Nil(suite.T(), err)
+	require.NotEqual(suite.T(), etag, metadatacontroller.GetETag(info))
+}
+
 func (suite *TestSuite) TestExamineObject_withNotFound() {
 	_, err := suite.metadataController.ExamineObject(user, "notexists")
 	require.NotNil(suite.T(), err)
@@ -79,13 +237,13 @@ func (suite *TestSuite) TestListTree() {
 	require.Nil(suite.T(), err)
 	err = os.MkdirAll(suite.controller.getStoragePath(user, "testlisttree/othertree"), 0755)
 	require.Nil(suite.T(), err)
-	infos, err := suite.metadataController.ListTree(user, "testlisttree")
+	infos, _, err := suite.metadataController.ListTree(user, "testlisttree", nil)
 	require.Nil(suite.T(), err)
 	require.Equal(suite.T(), 1, len(infos))
 }
 
 func (suite *TestSuite) TestListTree_withNotFound() {
-	_, err := suite.metadataController.ListTree(user, "notexists")
+	_, _, err := suite.metadataController.ListTree(user, "notexists", nil)
 	require.NotNil(suite.T(), err)
 }
 
@@ -95,6 +253,29 @@ func (suite *TestSuite) TestDeleteObject() {
 	err = suite.metadataController.DeleteObject(user, "myblob")
 	require.Nil(suite.T(), err)
 }
+func (suite *TestSuite) TestDeleteObject_withNotFound() {
+	err := suite.metadataController.DeleteObject(user, "notexists")
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.NotFound, codeErr.Code)
+}
+func (suite *TestSuite) TestDeleteObject_withRoot() {
+	err := suite.metadataController.DeleteObject(user, "/")
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.BadInputData, codeErr.Code)
+	_, err = os.Stat(suite.controller.getStoragePath(user, "/"))
+	require.Nil(suite.T(), err)
+}
+func (suite *TestSuite) TestMoveObject_withRoot() {
+	err := suite.metadataController.MoveObject(user, "/", "othertree")
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.BadInputData, codeErr.Code)
+}
 
 func (suite *TestSuite) TestMoveBLOBObject() {
 	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "testmoveblobobject"), []byte("1"), 0644)
@@ -165,10 +346,125 @@ func (suite *TestSuite) TestMoveObject_withSourceNotFound() {
 	require.NotNil(suite.T(), err)
 }
 
+func (suite *TestSuite) TestCopyBLOBObject() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "testcopyblobobject"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "testcopyblobobject", "othertestcopyblobobject")
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "othertestcopyblobobject")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+	_, err = suite.metadataController.ExamineObject(user, "testcopyblobobject")
+	require.Nil(suite.T(), err)
+}
+func (suite *TestSuite) TestCopyBLOBObject_isStagedInMetaDataDir() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "myblob", "otherblob")
+	require.Nil(suite.T(), err)
+	names, err := ioutil.ReadDir(path.Join("/tmp", stagingDirName))
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 0, len(names))
+}
+func (suite *TestSuite) TestCopyTreeObject() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testcopytree/othertree"), 0755)
+	require.Nil(suite.T(), err)
+	err = ioutil.WriteFile(suite.controller.getStoragePath(user, "testcopytree/othertree/myblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	os.RemoveAll(suite.controller.getStoragePath(user, "othertestcopytree"))
+	err = suite.metadataController.CopyObject(user, "testcopytree", "othertestcopytree")
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "othertestcopytree/othertree/myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+}
+func (suite *TestSuite) TestCopyTreeObject_intoItself() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testcopytreeintoitself"), 0755)
+	require.Nil(suite.T(), err)
+	os.RemoveAll(suite.controller.getStoragePath(user, "testcopytreeintoitself/copy"))
+	err = suite.metadataController.CopyObject(user, "testcopytreeintoitself", "testcopytreeintoitself/copy")
+	require.Nil(suite.T(), err)
+	infos, _, err := suite.metadataController.ListTree(user, "testcopytreeintoitself/copy", nil)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 0, len(infos))
+}
+func (suite *TestSuite) TestCopyTreeObject_overExistingBLOB() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "testcopytreeoverblobblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	err = os.MkdirAll(suite.controller.getStoragePath(user, "testcopytreeoverblobtree"), 0755)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "testcopytreeoverblobtree", "testcopytreeoverblobblob")
+	require.NotNil(suite.T(), err)
+}
+func (suite *TestSuite) TestCopyObject_withTargetNotFound() {
+	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "myblob", "notexists/otherblob")
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.NotFound, codeErr.Code)
+}
+func (suite *TestSuite) TestCopyObject_withSourceNotFound() {
+	err := suite.metadataController.CopyObject(user, "notexists", "otherblob")
+	require.NotNil(suite.T(), err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.NotFound, codeErr.Code)
+}
+
+func (suite *TestSuite) TestListTreeContext_withCancelledContext() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testlisttreecontext/othertree"), 0755)
+	require.Nil(suite.T(), err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = suite.controller.ListTreeContext(ctx, user, "testlisttreecontext", nil)
+	require.Equal(suite.T(), context.Canceled, err)
+}
+
+func (suite *TestSuite) TestDeleteObjectContext_withCancelledContext() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testdeletecontext/othertree"), 0755)
+	require.Nil(suite.T(), err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = suite.controller.DeleteObjectContext(ctx, user, "testdeletecontext")
+	require.Equal(suite.T(), context.Canceled, err)
+	_, err = suite.metadataController.ExamineObject(user, "testdeletecontext/othertree")
+	require.Nil(suite.T(), err)
+}
+
+func (suite *TestSuite) TestDeleteObject_isStagedInMetaDataDir() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "mytree/othertree"), 0755)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.DeleteObject(user, "mytree")
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "mytree")
+	require.NotNil(suite.T(), err)
+	names, err := ioutil.ReadDir(path.Join("/tmp", stagingDirName))
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 0, len(names))
+}
+
+func (suite *TestSuite) TestCopyObjectContext_withCancelledContext() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "testcopycontext/othertree"), 0755)
+	require.Nil(suite.T(), err)
+	os.RemoveAll(suite.controller.getStoragePath(user, "othertestcopycontext"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = suite.controller.CopyObjectContext(ctx, user, "testcopycontext", "othertestcopycontext")
+	require.Equal(suite.T(), context.Canceled, err)
+	_, err = suite.metadataController.ExamineObject(user, "othertestcopycontext")
+	require.NotNil(suite.T(), err)
+}
+
+func (suite *TestSuite) TestWithContext() {
+	require.Equal(suite.T(), suite.controller, metadatacontroller.WithContext(suite.metadataController))
+}
+
 func (suite *TestSuite) TestListTree_withBLOB() {
 	err := ioutil.WriteFile(suite.controller.getStoragePath(user, "myblob"), []byte("1"), 0644)
 	require.Nil(suite.T(), err)
-	_, err = suite.metadataController.ListTree(user, "myblob")
+	_, _, err = suite.metadataController.ListTree(user, "myblob", nil)
 	require.NotNil(suite.T(), err)
 }
 
@@ -213,3 +509,19 @@ func (suite *TestSuite) TestsecureJoin() {
 		require.Equal(suite.T(), v.expected, secureJoin(v.given...))
 	}
 }
+
+func (suite *TestSuite) TestStreamTreeContext() {
+	err := os.MkdirAll(suite.controller.getStoragePath(user, "teststreamtree/a/b"), 0755)
+	require.Nil(suite.T(), err)
+	defer os.RemoveAll(suite.controller.getStoragePath(user, "teststreamtree"))
+	var specs []string
+	opts := &metadatacontroller.ListOptions{Depth: metadatacontroller.DepthInfinity}
+	next, err := suite.controller.StreamTreeContext(context.Background(), user, "teststreamtree", opts, func(oinfo *entities.ObjectInfo) error {
+		specs = append(specs, oinfo.PathSpec)
+		return nil
+	})
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "", next)
+	require.Equal(suite.T(), []string{"teststreamtree/a", "teststreamtree/a/b"}, specs)
+	require.Implements(suite.T(), (*metadatacontroller.TreeStreamer)(nil), suite.metadataController)
+}
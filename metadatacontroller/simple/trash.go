@@ -0,0 +1,211 @@
+package simple
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// Every item in the trash is a directory named after the ID of the item
+// holding the deleted object and a JSON file describing it.
+const (
+	trashObjectName = "object"
+	trashInfoName   = "info.json"
+)
+
+func (c *controller) ListTrash(user *entities.User) ([]*metadatacontroller.TrashItem, error) {
+	if c.trashDir == "" {
+		return nil, errTrashDisabled()
+	}
+	finfos, err := ioutil.ReadDir(c.getTrashPath(user))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var items []*metadatacontroller.TrashItem
+	for _, fi := range finfos {
+		item, err := c.getTrashItem(user, fi.Name())
+		if err != nil {
+			if codeErr, ok := err.(*codes.Err); ok && codeErr.Code == codes.NotFound {
+				continue // item being created or purged.
+			}
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	sort.Sort(byDeletion(items))
+	return items, nil
+}
+
+func (c *controller) RestoreTrashItem(user *entities.User, id, targetPathSpec string) error {
+	if c.trashDir == "" {
+		return errTrashDisabled()
+	}
+	item, err := c.getTrashItem(user, id)
+	if err != nil {
+		return err
+	}
+	if targetPathSpec == "" {
+		targetPathSpec = item.PathSpec
+	}
+	// the target is checked to be missing before renaming the
+	// object over it, so nothing else can change in between.
+	defer c.lockChanges(true)()
+	if isRoot(targetPathSpec) {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be replaced")
+	}
+	targetPath := c.getStoragePath(user, targetPathSpec)
+	if _, err := os.Lstat(targetPath); err == nil {
+		return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+	}
+	itemPath := path.Join(c.getTrashPath(user), id)
+	restored, err := c.getUsage(path.Join(itemPath, trashObjectName))
+	if err != nil {
+		return err
+	}
+	reserved, err := c.reserveUsage(user, restored)
+	if err != nil {
+		return err
+	}
+	defer reserved.release()
+	c.dropStaleTreeUsage(targetPath)
+	if err := os.Rename(path.Join(itemPath, trashObjectName), targetPath); err != nil {
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		}
+		if isNotDir(err) {
+			return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+		}
+		return err
+	}
+	err = reserved.propagateChange(targetPath, restored)
+	c.moveVersionsDir(c.getTrashVersionsPath(user, id), c.getObjectVersionsPath(user, targetPathSpec))
+	if removeErr := os.RemoveAll(itemPath); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+func (c *controller) PurgeTrashItem(user *entities.User, id string) error {
+	if c.trashDir == "" {
+		return errTrashDisabled()
+	}
+	// items are purged under the same lock as they are restored,
+	// so an item being restored is never removed.
+	defer c.lockChanges(true)()
+	if _, err := c.getTrashItem(user, id); err != nil {
+		return err
+	}
+	c.removeVersionsDir(c.getTrashVersionsPath(user, id))
+	return os.RemoveAll(path.Join(c.getTrashPath(user), id))
+}
+
+func (c *controller) PurgeTrash(user *entities.User, before int64) (int, error) {
+	if c.trashDir == "" {
+		return 0, errTrashDisabled()
+	}
+	defer c.lockChanges(true)()
+	items, err := c.ListTrash(user)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, item := range items {
+		if item.DeletedAt > before {
+			continue
+		}
+		c.removeVersionsDir(c.getTrashVersionsPath(user, item.ID))
+		if err := os.RemoveAll(path.Join(c.getTrashPath(user), item.ID)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// moveToTrash moves the object at pathSpec, described by finfo and
+// with the given size, to a new item in the trash of the user, with
+// the versions of the objects deleted.
+func (c *controller) moveToTrash(user *entities.User, pathSpec string, finfo os.FileInfo, size int64) error {
+	trashPath := c.getTrashPath(user)
+	if err := os.MkdirAll(trashPath, 0755); err != nil {
+		return err
+	}
+	itemPath, err := ioutil.TempDir(trashPath, "")
+	if err != nil {
+		return err
+	}
+	oinfo := newObjectInfo(secureJoin("/", pathSpec), finfo)
+	item := &metadatacontroller.TrashItem{
+		ID:        path.Base(itemPath),
+		PathSpec:  strings.TrimPrefix(oinfo.PathSpec, "/"),
+		DeletedAt: time.Now().Unix(),
+		Type:      oinfo.Type,
+		Size:      size,
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		os.RemoveAll(itemPath)
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(itemPath, trashInfoName), data, 0644); err != nil {
+		os.RemoveAll(itemPath)
+		return err
+	}
+	if err := os.Rename(c.getStoragePath(user, pathSpec), path.Join(itemPath, trashObjectName)); err != nil {
+		os.RemoveAll(itemPath)
+		return err
+	}
+	c.moveVersionsDir(c.getObjectVersionsPath(user, pathSpec), c.getTrashVersionsPath(user, item.ID))
+	return nil
+}
+
+func (c *controller) getTrashItem(user *entities.User, id string) (*metadatacontroller.TrashItem, error) {
+	if id == "" || id == "." || id == ".." || strings.Contains(id, "/") {
+		return nil, codes.NewErr(codes.NotFound, "trash item not found")
+	}
+	data, err := ioutil.ReadFile(path.Join(c.getTrashPath(user), id, trashInfoName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, codes.NewErr(codes.NotFound, "trash item not found")
+		}
+		return nil, err
+	}
+	item := &metadatacontroller.TrashItem{}
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	item.ID = id
+	return item, nil
+}
+
+func (c *controller) getTrashPath(user *entities.User) string {
+	homeDir := secureJoin("/", string(user.Username[0]), user.Username)
+	return secureJoin(c.trashDir, homeDir)
+}
+
+func errTrashDisabled() error {
+	return codes.NewErr(metadatacontroller.NotSupported, "trash is not enabled")
+}
+
+// byDeletion sorts trash items by deletion time, most recent first.
+type byDeletion []*metadatacontroller.TrashItem
+
+func (s byDeletion) Len() int      { return len(s) }
+func (s byDeletion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDeletion) Less(i, j int) bool {
+	if s[i].DeletedAt != s[j].DeletedAt {
+		return s[i].DeletedAt > s[j].DeletedAt
+	}
+	return s[i].ID < s[j].ID
+}
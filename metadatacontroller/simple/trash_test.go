@@ -0,0 +1,200 @@
+package simple
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+// newTrashController returns a controller with the trash enabled
+// and the function removing its directories.
+func newTrashController(t *testing.T) (*controller, func()) {
+	dir, err := ioutil.TempDir("", "clawio-simple-trash-")
+	require.Nil(t, err)
+	c := New(&Options{
+		MetaDataDir: path.Join(dir, "data"),
+		TrashDir:    path.Join(dir, "trash"),
+	}).(*controller)
+	require.Nil(t, c.Init(user))
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func TestDeleteObject_withTrash(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, c.DeleteObject(user, "mytree"))
+	_, err := c.ExamineObject(user, "mytree")
+	conformance.RequireCode(t, codes.NotFound, err)
+
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "mytree", items[0].PathSpec)
+	require.NotEqual(t, int64(0), items[0].DeletedAt)
+
+	require.Nil(t, c.RestoreTrashItem(user, items[0].ID, ""))
+	_, err = c.ExamineObject(user, "mytree/othertree")
+	require.Nil(t, err)
+	items, err = c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+}
+
+func TestRestoreTrashItem_toOtherPath(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "myblob"), []byte("1"), 0644))
+	require.Nil(t, c.DeleteObject(user, "myblob"))
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "myblob"), []byte("2"), 0644))
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+
+	err = c.RestoreTrashItem(user, items[0].ID, "")
+	conformance.RequireCode(t, metadatacontroller.AlreadyExists, err)
+	err = c.RestoreTrashItem(user, items[0].ID, "notexists/myblob")
+	conformance.RequireCode(t, codes.NotFound, err)
+	require.Nil(t, c.RestoreTrashItem(user, items[0].ID, "restored"))
+	data, err := ioutil.ReadFile(c.getStoragePath(user, "restored"))
+	require.Nil(t, err)
+	require.Equal(t, "1", string(data))
+}
+
+func TestRestoreTrashItem_concurrently(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	for i := 0; i < 2; i++ {
+		require.Nil(t, c.CreateTree(user, "mytree", false))
+		require.Nil(t, c.DeleteObject(user, "mytree"))
+	}
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+
+	// both trees are empty, so renaming one over the
+	// other succeeds unless the check is serialized.
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			errs[i] = c.RestoreTrashItem(user, id, "")
+		}(i, item.ID)
+	}
+	wg.Wait()
+	if errs[0] == nil {
+		errs[0], errs[1] = errs[1], errs[0]
+	}
+	conformance.RequireCode(t, metadatacontroller.AlreadyExists, errs[0])
+	require.Nil(t, errs[1])
+	items, err = c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+}
+
+func TestPurgeTrash(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	for _, name := range []string{"a", "b", "c"} {
+		require.Nil(t, c.CreateTree(user, name, false))
+		require.Nil(t, c.DeleteObject(user, name))
+	}
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(items))
+
+	require.Nil(t, c.PurgeTrashItem(user, items[0].ID))
+	err = c.PurgeTrashItem(user, items[0].ID)
+	conformance.RequireCode(t, codes.NotFound, err)
+
+	purged, err := c.PurgeTrash(user, time.Now().Add(-time.Hour).Unix())
+	require.Nil(t, err)
+	require.Equal(t, 0, purged)
+	purged, err = c.PurgeTrash(user, time.Now().Unix())
+	require.Nil(t, err)
+	require.Equal(t, 2, purged)
+	items, err = c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+}
+
+func TestPurgeTrashItem_whileRestoring(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	for i := 0; i < 20; i++ {
+		require.Nil(t, c.CreateTree(user, "mytree", false))
+		require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/myblob"), []byte("1"), 0644))
+		require.Nil(t, c.DeleteObject(user, "mytree"))
+		items, err := c.ListTrash(user)
+		require.Nil(t, err)
+		require.Equal(t, 1, len(items))
+
+		// either the item is restored whole or purged.
+		var restoreErr, purgeErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			restoreErr = c.RestoreTrashItem(user, items[0].ID, "")
+		}()
+		go func() {
+			defer wg.Done()
+			purgeErr = c.PurgeTrashItem(user, items[0].ID)
+		}()
+		wg.Wait()
+		if restoreErr == nil {
+			conformance.RequireCode(t, codes.NotFound, purgeErr)
+			_, err = c.ExamineObject(user, "mytree/myblob")
+			require.Nil(t, err)
+			require.Nil(t, c.DeleteObject(user, "mytree"))
+			require.Nil(t, c.PurgeTrashItem(user, mustListTrash(t, c)[0].ID))
+		} else {
+			conformance.RequireCode(t, codes.NotFound, restoreErr)
+			require.Nil(t, purgeErr)
+		}
+		require.Empty(t, mustListTrash(t, c))
+	}
+}
+
+func mustListTrash(t *testing.T, c *controller) []*metadatacontroller.TrashItem {
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	return items
+}
+
+func TestTrashItem_withInvalidID(t *testing.T) {
+	c, cleanup := newTrashController(t)
+	defer cleanup()
+	err := c.PurgeTrashItem(user, "../..")
+	conformance.RequireCode(t, codes.NotFound, err)
+}
+
+func TestListTrash_withTrashDisabled(t *testing.T) {
+	c := New(&Options{MetaDataDir: "/tmp/t"}).(*controller)
+	_, err := c.ListTrash(user)
+	conformance.RequireCode(t, metadatacontroller.NotSupported, err)
+}
+
+func TestConformance_withTrash(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) *conformance.Backend {
+		c, cleanup := newTrashController(t)
+		return &conformance.Backend{
+			Controller: c,
+			PutBLOB: func(user *entities.User, pathSpec string, size int64) error {
+				return ioutil.WriteFile(c.getStoragePath(user, pathSpec), make([]byte, size), 0644)
+			},
+			Cleanup: cleanup,
+		}
+	})
+}
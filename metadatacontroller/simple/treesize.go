@@ -0,0 +1,191 @@
+package simple
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// When tree sizes or quotas are enabled, every tree keeps the usage of
+// its descendants, the recursive size of their BLOBs and their number,
+// in an extended attribute outside of the namespace of the properties,
+// with the modification time the tree had when it was computed.
+// The usages are updated up to the home tree by every change made
+// through the controller, and computed walking the tree when the
+// attribute is missing or the tree was modified by other components,
+// like the data service creating a BLOB in it. Other changes made
+// outside of the controller, like BLOBs rewritten in place or created
+// deeper in the tree, are not seen until the attribute is removed.
+const treeUsageXattr = "user.clawio-treeusage"
+
+// getObjectSize returns the size of the object at storagePath,
+// described by finfo, that is the recursive size for trees
+// if tree sizes are enabled.
+func (c *controller) getObjectSize(storagePath string, finfo os.FileInfo) (int64, error) {
+	if !c.treeSizes || !finfo.IsDir() {
+		return finfo.Size(), nil
+	}
+	used, err := c.readTreeUsage(storagePath)
+	if err != nil {
+		return 0, err
+	}
+	return used.Bytes, nil
+}
+
+// getUsage returns the usage of the object at storagePath and its
+// descendants, or zero if it does not exist or trees do not keep
+// their usage.
+func (c *controller) getUsage(storagePath string) (metadatacontroller.Usage, error) {
+	if !c.treeUsage {
+		return metadatacontroller.Usage{}, nil
+	}
+	finfo, err := os.Lstat(storagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metadatacontroller.Usage{}, nil
+		}
+		return metadatacontroller.Usage{}, err
+	}
+	if !finfo.IsDir() {
+		return metadatacontroller.Usage{Bytes: finfo.Size(), Objects: 1}, nil
+	}
+	used, err := c.readTreeUsage(storagePath)
+	if err != nil {
+		return metadatacontroller.Usage{}, err
+	}
+	return used.Add(metadatacontroller.Usage{Objects: 1}), nil
+}
+
+// dropStaleTreeUsage removes the usage kept by the parent of storagePath
+// if the tree was modified by other components since it was kept. It is
+// called before changing the object at storagePath, as the change gives
+// the parent a new modification time and propagateUsage would keep the
+// stale usage under it.
+func (c *controller) dropStaleTreeUsage(storagePath string) {
+	if !c.treeUsage {
+		return
+	}
+	c.treeUsageMu.Lock()
+	defer c.treeUsageMu.Unlock()
+	p := path.Dir(storagePath)
+	value, err := getXattr(p, treeUsageXattr)
+	if err != nil {
+		return
+	}
+	finfo, err := os.Stat(p)
+	if err != nil {
+		return
+	}
+	if _, modTime, err := parseTreeUsage(value); err != nil || modTime != finfo.ModTime().UnixNano() {
+		removeXattr(p, treeUsageXattr)
+	}
+}
+
+// propagateUsage adds delta to the usages of the trees from the parent
+// of storagePath up to the home tree of the user. Trees without a usage
+// are left alone, as their usage is computed when needed, and so are
+// the ones modified by other components since their usage was kept.
+// The parent was modified by the change itself, so it keeps its new
+// modification time, its usage being checked by dropStaleTreeUsage
+// before the change.
+func (c *controller) propagateUsage(user *entities.User, storagePath string, delta metadatacontroller.Usage) {
+	if !c.treeUsage {
+		return
+	}
+	c.treeUsageMu.Lock()
+	defer c.treeUsageMu.Unlock()
+	c.treeUsageGen++
+	homePath := c.getStoragePath(user, "/")
+	for p := path.Dir(storagePath); len(p) >= len(homePath); p = path.Dir(p) {
+		value, err := getXattr(p, treeUsageXattr)
+		if err != nil {
+			continue
+		}
+		finfo, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		used, modTime, err := parseTreeUsage(value)
+		if err == nil && p != path.Dir(storagePath) && modTime != finfo.ModTime().UnixNano() {
+			err = errStaleTreeUsage
+		}
+		if err == nil {
+			err = setXattr(p, treeUsageXattr, formatTreeUsage(used.Add(delta), finfo))
+		}
+		if err != nil {
+			removeXattr(p, treeUsageXattr)
+		}
+	}
+}
+
+// readTreeUsage returns the usage kept by the tree at storagePath,
+// computing and keeping it if missing or stale. The tree is walked
+// without holding treeUsageMu, and the usage is kept only if no change
+// was propagated meanwhile, so it never overwrites a newer one.
+func (c *controller) readTreeUsage(storagePath string) (metadatacontroller.Usage, error) {
+	// the tree is stated before being read, so an entry changed
+	// while walking it leaves the usage stale.
+	finfo, err := os.Stat(storagePath)
+	if err != nil {
+		return metadatacontroller.Usage{}, err
+	}
+	if value, err := getXattr(storagePath, treeUsageXattr); err == nil {
+		if used, modTime, err := parseTreeUsage(value); err == nil && modTime == finfo.ModTime().UnixNano() {
+			return used, nil
+		}
+	}
+	c.treeUsageMu.Lock()
+	gen := c.treeUsageGen
+	c.treeUsageMu.Unlock()
+	fd, err := os.Open(storagePath)
+	if err != nil {
+		return metadatacontroller.Usage{}, err
+	}
+	finfos, err := fd.Readdir(-1)
+	fd.Close()
+	if err != nil {
+		return metadatacontroller.Usage{}, err
+	}
+	used := metadatacontroller.Usage{Objects: int64(len(finfos))}
+	for _, fi := range finfos {
+		if !fi.IsDir() {
+			used.Bytes += fi.Size()
+			continue
+		}
+		childUsage, err := c.readTreeUsage(path.Join(storagePath, fi.Name()))
+		if err != nil {
+			return metadatacontroller.Usage{}, err
+		}
+		used = used.Add(childUsage)
+	}
+	c.treeUsageMu.Lock()
+	defer c.treeUsageMu.Unlock()
+	if gen == c.treeUsageGen {
+		// the usage is computed again next time if it cannot be kept.
+		setXattr(storagePath, treeUsageXattr, formatTreeUsage(used, finfo))
+	}
+	return used, nil
+}
+
+var errStaleTreeUsage = errors.New("tree usage is stale")
+
+// parseTreeUsage parses the value of treeUsageXattr, the bytes, the
+// objects and the modification time of the tree separated by spaces.
+func parseTreeUsage(value []byte) (metadatacontroller.Usage, int64, error) {
+	used := metadatacontroller.Usage{}
+	var modTime int64
+	if _, err := fmt.Sscanf(string(value), "%d %d %d", &used.Bytes, &used.Objects, &modTime); err != nil {
+		return metadatacontroller.Usage{}, 0, err
+	}
+	return used, modTime, nil
+}
+
+// formatTreeUsage formats used as the value of treeUsageXattr
+// for the tree described by finfo.
+func formatTreeUsage(used metadatacontroller.Usage, finfo os.FileInfo) []byte {
+	return []byte(fmt.Sprintf("%d %d %d", used.Bytes, used.Objects, finfo.ModTime().UnixNano()))
+}
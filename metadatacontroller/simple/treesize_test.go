@@ -0,0 +1,137 @@
+package simple
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+// newTreeSizesController returns a controller reporting tree sizes
+// and the function removing its directories.
+func newTreeSizesController(t *testing.T) (*controller, func()) {
+	dir, err := ioutil.TempDir("", "clawio-simple-treesizes-")
+	require.Nil(t, err)
+	c := New(&Options{
+		MetaDataDir: path.Join(dir, "data"),
+		TrashDir:    path.Join(dir, "trash"),
+		VersionsDir: path.Join(dir, "versions"),
+		TreeSizes:   true,
+	}).(*controller)
+	require.Nil(t, c.Init(user))
+	return c, func() { os.RemoveAll(dir) }
+}
+
+func requireSize(t *testing.T, c *controller, pathSpec string, size int64) {
+	oinfo, err := c.ExamineObject(user, pathSpec)
+	require.Nil(t, err)
+	require.Equal(t, size, oinfo.Size, pathSpec)
+}
+
+func TestExamineObject_withTreeSizes(t *testing.T) {
+	c, cleanup := newTreeSizesController(t)
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/myblob"), []byte("12345"), 0644))
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/othertree/myblob"), []byte("123"), 0644))
+	requireSize(t, c, "/", 8)
+	requireSize(t, c, "mytree", 8)
+	requireSize(t, c, "mytree/othertree", 3)
+	requireSize(t, c, "mytree/myblob", 5)
+
+	oinfos, _, err := c.ListTree(user, "mytree", &metadatacontroller.ListOptions{Sort: metadatacontroller.SortBySize})
+	require.Nil(t, err)
+	require.Len(t, oinfos, 2)
+	require.Equal(t, int64(3), oinfos[0].Size)
+	require.Equal(t, int64(5), oinfos[1].Size)
+}
+
+func TestTreeSizes_propagated(t *testing.T) {
+	c, cleanup := newTreeSizesController(t)
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree/othertree", true))
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/othertree/myblob"), []byte("123"), 0644))
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "otherblob"), []byte("12345"), 0644))
+	requireSize(t, c, "/", 8)
+
+	require.Nil(t, c.CopyObject(user, "mytree/othertree", "mytree/copiedtree"))
+	requireSize(t, c, "mytree", 6)
+	requireSize(t, c, "/", 11)
+	require.Nil(t, c.MoveObject(user, "otherblob", "mytree/copiedtree/myblob"))
+	requireSize(t, c, "mytree/copiedtree", 5)
+	requireSize(t, c, "mytree", 8)
+	requireSize(t, c, "/", 8)
+	require.Nil(t, c.DeleteObject(user, "mytree/othertree"))
+	requireSize(t, c, "mytree", 5)
+	requireSize(t, c, "/", 5)
+
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, int64(3), items[0].Size)
+	require.Nil(t, c.RestoreTrashItem(user, items[0].ID, "restoredtree"))
+	requireSize(t, c, "/", 8)
+
+	versions, err := c.ListVersions(user, "mytree/copiedtree/myblob")
+	require.Nil(t, err)
+	require.Len(t, versions, 1)
+	require.Nil(t, c.RestoreVersion(user, "mytree/copiedtree/myblob", versions[0].ID))
+	requireSize(t, c, "mytree", 3)
+	requireSize(t, c, "/", 6)
+
+	// the sizes are computed again when their attributes are removed.
+	require.Nil(t, removeXattr(c.getStoragePath(user, "/"), treeUsageXattr))
+	requireSize(t, c, "/", 6)
+}
+
+func TestTreeSizes_withModifiedTree(t *testing.T) {
+	c, cleanup := newTreeSizesController(t)
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	requireSize(t, c, "/", 0)
+	requireSize(t, c, "mytree", 0)
+
+	// the tree where the BLOB is written directly is walked again,
+	// while its ancestors keep their size.
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/myblob"), []byte("12345"), 0644))
+	requireSize(t, c, "mytree", 5)
+	requireSize(t, c, "/", 0)
+	require.Nil(t, c.CopyObject(user, "mytree/myblob", "mytree/otherblob"))
+	requireSize(t, c, "mytree", 10)
+	require.Nil(t, removeXattr(c.getStoragePath(user, "/"), treeUsageXattr))
+	requireSize(t, c, "/", 10)
+}
+
+func TestTreeSizes_withModifiedTreeBeforeChange(t *testing.T) {
+	c, cleanup := newTreeSizesController(t)
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	requireSize(t, c, "mytree", 0)
+
+	// the size of the tree is not read before changing it again
+	// through the controller, which must not hide the BLOB.
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "mytree/myblob"), []byte("12345"), 0644))
+	modTime := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(c.getStoragePath(user, "mytree"), modTime, modTime))
+	require.Nil(t, c.CreateTree(user, "mytree/othertree", false))
+	requireSize(t, c, "mytree", 5)
+}
+
+func TestConformance_withTreeSizes(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) *conformance.Backend {
+		c, cleanup := newTreeSizesController(t)
+		return &conformance.Backend{
+			Controller: c,
+			PutBLOB: func(user *entities.User, pathSpec string, size int64) error {
+				return ioutil.WriteFile(c.getStoragePath(user, pathSpec), make([]byte, size), 0644)
+			},
+			Cleanup: cleanup,
+		}
+	})
+}
@@ -0,0 +1,392 @@
+package simple
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// The versions are kept in a tree mirroring the home tree of the user,
+// where every object has a directory named after it with a
+// versionsObjectPrefix. The directory of a tree holds the directories of
+// its children and the one of a BLOB holds its versions in the
+// versionsDirName directory, so the versions under a tree are moved or
+// removed by renaming or removing a single directory. Every version is a
+// copy of the data the BLOB had and a JSON file, with the same name plus
+// versionInfoExt, describing it. The versions of the objects in the trash
+// are kept under the trashVersionsDirName directory of the home tree.
+const (
+	versionsObjectPrefix = "_"
+	versionsDirName      = "versions"
+	trashVersionsDirName = "trash"
+	versionInfoExt       = ".json"
+)
+
+func (c *controller) ListVersions(user *entities.User, pathSpec string) ([]*metadatacontroller.Version, error) {
+	if c.versionsDir == "" {
+		return nil, errVersionsDisabled()
+	}
+	versions, err := c.readVersions(user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	return c.unexpired(versions), nil
+}
+
+func (c *controller) ExamineVersion(user *entities.User, pathSpec, id string) (*metadatacontroller.Version, error) {
+	if c.versionsDir == "" {
+		return nil, errVersionsDisabled()
+	}
+	return c.getUnexpiredVersion(user, pathSpec, id)
+}
+
+func (c *controller) RestoreVersion(user *entities.User, pathSpec, id string) error {
+	if c.versionsDir == "" {
+		return errVersionsDisabled()
+	}
+	v, err := c.getUnexpiredVersion(user, pathSpec, id)
+	if err != nil {
+		return err
+	}
+	defer c.lockChanges(false)()
+	storagePath := c.getStoragePath(user, pathSpec)
+	if finfo, err := os.Lstat(storagePath); err == nil && finfo.IsDir() {
+		return codes.NewErr(codes.BadInputData, "object is a tree")
+	}
+	replaced, err := c.getUsage(storagePath)
+	if err != nil {
+		return err
+	}
+	restored := metadatacontroller.Usage{Bytes: v.Size, Objects: 1}
+	reserved, err := c.reserveUsage(user, restored.Sub(replaced))
+	if err != nil {
+		return err
+	}
+	defer reserved.release()
+	undo, err := c.keepVersion(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	// the version is copied to the staging directory first, as
+	// VersionsDir can be in another file system.
+	stageDir, err := c.newStagingDir("version-")
+	if err != nil {
+		undo()
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	stagePath := path.Join(stageDir, "object")
+	versionPath := path.Join(c.getVersionsPath(user, pathSpec), id)
+	if err := copyBLOB(versionPath, stagePath, 0644); err != nil {
+		undo()
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		}
+		return err
+	}
+	c.dropStaleTreeUsage(storagePath)
+	if err := os.Rename(stagePath, storagePath); err != nil {
+		undo()
+		if os.IsNotExist(err) {
+			return codes.NewErr(codes.NotFound, err.Error())
+		} else if isNotDir(err) {
+			return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+		}
+		return err
+	}
+	c.removeVersion(user, pathSpec, id)
+	err = reserved.propagateChange(storagePath, restored.Sub(replaced))
+	c.pruneVersions(user, pathSpec)
+	return err
+}
+
+func (c *controller) DeleteVersion(user *entities.User, pathSpec, id string) error {
+	if c.versionsDir == "" {
+		return errVersionsDisabled()
+	}
+	if _, err := c.getVersion(user, pathSpec, id); err != nil {
+		return err
+	}
+	return c.removeVersion(user, pathSpec, id)
+}
+
+// keepVersion keeps the BLOB at pathSpec, if any, as a new version before
+// it is replaced. It returns a function removing the new version, to be
+// called if the BLOB is finally not replaced.
+func (c *controller) keepVersion(user *entities.User, pathSpec string) (func(), error) {
+	nop := func() {}
+	if c.versionsDir == "" {
+		return nop, nil
+	}
+	storagePath := c.getStoragePath(user, pathSpec)
+	finfo, err := os.Lstat(storagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nop, nil
+		}
+		return nil, err
+	}
+	if !finfo.Mode().IsRegular() {
+		return nop, nil
+	}
+	versionsPath := c.getVersionsPath(user, pathSpec)
+	if err := os.MkdirAll(versionsPath, 0755); err != nil {
+		return nil, err
+	}
+	v := &metadatacontroller.Version{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		PathSpec:  strings.TrimPrefix(secureJoin("/", pathSpec), "/"),
+		Size:      finfo.Size(),
+		ModTime:   finfo.ModTime().Unix(),
+		CreatedAt: time.Now().Unix(),
+	}
+	if c.checksum != "" {
+		checksum, err := c.getChecksum(storagePath, finfo)
+		if err != nil {
+			return nil, err
+		}
+		v.Checksum = checksum
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// the data is copied, as the BLOB could be rewritten in place.
+	versionPath := path.Join(versionsPath, v.ID)
+	if err := copyBLOB(storagePath, versionPath, finfo.Mode().Perm()); err != nil {
+		os.Remove(versionPath)
+		return nil, err
+	}
+	undo := func() {
+		os.Remove(versionPath)
+		os.Remove(versionPath + versionInfoExt)
+	}
+	if err := ioutil.WriteFile(versionPath+versionInfoExt, data, 0644); err != nil {
+		undo()
+		return nil, err
+	}
+	return undo, nil
+}
+
+// keepReplacedVersion keeps the BLOB at targetPathSpec as a new version
+// when it is going to be replaced by the BLOB at sourceStoragePath, and
+// returns a function removing the new version like keepVersion.
+func (c *controller) keepReplacedVersion(user *entities.User, sourceStoragePath, targetPathSpec string) (func(), error) {
+	if c.versionsDir == "" || sourceStoragePath == c.getStoragePath(user, targetPathSpec) {
+		return func() {}, nil
+	}
+	finfo, err := os.Lstat(sourceStoragePath)
+	if err != nil || !finfo.Mode().IsRegular() {
+		// the error, if any, is reported when replacing the BLOB.
+		return func() {}, nil
+	}
+	return c.keepVersion(user, targetPathSpec)
+}
+
+// pruneVersions removes the versions of the BLOB at pathSpec expired
+// by the retention policy. Errors are ignored as the versions are
+// pruned again on the next change.
+func (c *controller) pruneVersions(user *entities.User, pathSpec string) {
+	if c.versionsDir == "" {
+		return
+	}
+	versions, err := c.readVersions(user, pathSpec)
+	if err != nil {
+		return
+	}
+	for _, v := range c.retention.Expired(versions, time.Now().Unix()) {
+		c.removeVersion(user, pathSpec, v.ID)
+	}
+}
+
+// unexpired returns the versions not expired by the retention policy.
+// Reads do not remove the versions expired, they are hidden until they
+// are pruned on the next change of their BLOB.
+func (c *controller) unexpired(versions []*metadatacontroller.Version) []*metadatacontroller.Version {
+	expired := map[string]bool{}
+	for _, v := range c.retention.Expired(versions, time.Now().Unix()) {
+		expired[v.ID] = true
+	}
+	var kept []*metadatacontroller.Version
+	for _, v := range versions {
+		if !expired[v.ID] {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// getUnexpiredVersion is like getVersion, but reports the versions
+// expired by the retention policy as not found.
+func (c *controller) getUnexpiredVersion(user *entities.User, pathSpec, id string) (*metadatacontroller.Version, error) {
+	v, err := c.getVersion(user, pathSpec, id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := c.readVersions(user, pathSpec)
+	if err != nil {
+		return nil, err
+	}
+	for _, kept := range c.unexpired(versions) {
+		if kept.ID == id {
+			return v, nil
+		}
+	}
+	return nil, codes.NewErr(codes.NotFound, "version not found")
+}
+
+func (c *controller) readVersions(user *entities.User, pathSpec string) ([]*metadatacontroller.Version, error) {
+	finfos, err := ioutil.ReadDir(c.getVersionsPath(user, pathSpec))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var versions []*metadatacontroller.Version
+	for _, fi := range finfos {
+		if !strings.HasSuffix(fi.Name(), versionInfoExt) {
+			continue
+		}
+		v, err := c.getVersion(user, pathSpec, strings.TrimSuffix(fi.Name(), versionInfoExt))
+		if err != nil {
+			if codeErr, ok := err.(*codes.Err); ok && codeErr.Code == codes.NotFound {
+				continue // removed while listing.
+			}
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	metadatacontroller.SortVersions(versions)
+	return versions, nil
+}
+
+func (c *controller) getVersion(user *entities.User, pathSpec, id string) (*metadatacontroller.Version, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return nil, codes.NewErr(codes.NotFound, "version not found")
+	}
+	data, err := ioutil.ReadFile(path.Join(c.getVersionsPath(user, pathSpec), id+versionInfoExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, codes.NewErr(codes.NotFound, "version not found")
+		}
+		return nil, err
+	}
+	v := &metadatacontroller.Version{}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	// the versions follow their BLOB when it is moved.
+	v.ID = id
+	v.PathSpec = strings.TrimPrefix(secureJoin("/", pathSpec), "/")
+	return v, nil
+}
+
+func (c *controller) removeVersion(user *entities.User, pathSpec, id string) error {
+	versionPath := path.Join(c.getVersionsPath(user, pathSpec), id)
+	if err := os.Remove(versionPath + versionInfoExt); err != nil {
+		return err
+	}
+	return os.Remove(versionPath)
+}
+
+// moveVersions moves the versions of the object at sourcePathSpec, and
+// of the objects under it, to targetPathSpec after the object is moved.
+// The versions of a BLOB replaced at targetPathSpec are kept with the
+// ones moved.
+func (c *controller) moveVersions(user *entities.User, sourcePathSpec, targetPathSpec string) {
+	c.moveVersionsDir(c.getObjectVersionsPath(user, sourcePathSpec), c.getObjectVersionsPath(user, targetPathSpec))
+}
+
+// moveVersionsDir merges the directory of versions at sourcePath into
+// the one at targetPath. Errors are ignored as the objects are already
+// changed, and the versions left behind are removed by the retention.
+func (c *controller) moveVersionsDir(sourcePath, targetPath string) {
+	if c.versionsDir == "" || sourcePath == targetPath {
+		return
+	}
+	if _, err := os.Lstat(sourcePath); err != nil {
+		return
+	}
+	if err := os.MkdirAll(path.Dir(targetPath), 0755); err != nil {
+		return
+	}
+	mergeDirs(sourcePath, targetPath)
+}
+
+// mergeDirs moves the entries of the directory at source to the one at
+// target, merging the directories with the same name, and removes source.
+// Entries of source with the name of a file of target are dropped.
+func mergeDirs(source, target string) {
+	if err := os.Rename(source, target); err == nil {
+		return
+	}
+	names, err := readDirNames(source)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		sourcePath, targetPath := path.Join(source, name), path.Join(target, name)
+		if finfo, err := os.Lstat(targetPath); err == nil && finfo.IsDir() {
+			mergeDirs(sourcePath, targetPath)
+		} else if err != nil {
+			os.Rename(sourcePath, targetPath)
+		}
+	}
+	os.RemoveAll(source)
+}
+
+// removeVersionsDir removes the directory of versions at p after its
+// objects are deleted. Errors are ignored as the objects are already
+// deleted.
+func (c *controller) removeVersionsDir(p string) {
+	if c.versionsDir == "" {
+		return
+	}
+	os.RemoveAll(p)
+}
+
+// getObjectVersionsPath returns the directory of the object
+// at pathSpec in the tree of versions of the user.
+func (c *controller) getObjectVersionsPath(user *entities.User, pathSpec string) string {
+	homeDir := secureJoin("/", string(user.Username[0]), user.Username)
+	p := secureJoin(c.versionsDir, homeDir)
+	for _, name := range strings.Split(secureJoin("/", pathSpec), "/") {
+		if name != "" {
+			p = path.Join(p, versionsObjectPrefix+name)
+		}
+	}
+	return p
+}
+
+// getTrashVersionsPath returns the directory keeping the versions of
+// the objects deleted with the trash item with the given id.
+func (c *controller) getTrashVersionsPath(user *entities.User, id string) string {
+	return path.Join(c.getObjectVersionsPath(user, "/"), trashVersionsDirName, id)
+}
+
+func (c *controller) getVersionsPath(user *entities.User, pathSpec string) string {
+	return path.Join(c.getObjectVersionsPath(user, pathSpec), versionsDirName)
+}
+
+// readDirNames returns the names of the entries of the directory at p.
+func readDirNames(p string) ([]string, error) {
+	fd, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return fd.Readdirnames(-1)
+}
+
+func errVersionsDisabled() error {
+	return codes.NewErr(metadatacontroller.NotSupported, "versioning is not enabled")
+}
@@ -0,0 +1,255 @@
+package simple
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+// newVersionsController returns a controller keeping versions
+// with the given retention and the function removing its directories.
+func newVersionsController(t *testing.T, retention metadatacontroller.VersionRetention) (*controller, func()) {
+	dir, err := ioutil.TempDir("", "clawio-simple-versions-")
+	require.Nil(t, err)
+	c := New(&Options{
+		MetaDataDir:       path.Join(dir, "data"),
+		VersionsDir:       path.Join(dir, "versions"),
+		VersionsRetention: retention,
+	}).(*controller)
+	require.Nil(t, c.Init(user))
+	return c, func() { os.RemoveAll(dir) }
+}
+
+// replaceBLOB writes data to a new BLOB and moves it over the BLOB at pathSpec.
+func replaceBLOB(t *testing.T, c *controller, pathSpec, data string) {
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "upload"), []byte(data), 0644))
+	require.Nil(t, c.MoveObject(user, "upload", pathSpec))
+}
+
+func readBLOB(t *testing.T, c *controller, pathSpec string) string {
+	data, err := ioutil.ReadFile(c.getStoragePath(user, pathSpec))
+	require.Nil(t, err)
+	return string(data)
+}
+
+func TestMoveObject_keepsVersion(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(versions))
+
+	replaceBLOB(t, c, "myblob", "22")
+	replaceBLOB(t, c, "myblob", "333")
+	require.Equal(t, "333", readBLOB(t, c, "myblob"))
+	versions, err = c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(versions))
+	require.Equal(t, int64(2), versions[0].Size)
+	require.Equal(t, int64(1), versions[1].Size)
+	require.Equal(t, "myblob", versions[0].PathSpec)
+
+	version, err := c.ExamineVersion(user, "myblob", versions[1].ID)
+	require.Nil(t, err)
+	require.Equal(t, versions[1], version)
+}
+
+func TestCopyObject_keepsVersion(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "otherblob"), []byte("22"), 0644))
+	require.Nil(t, c.CopyObject(user, "otherblob", "myblob"))
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Equal(t, int64(1), versions[0].Size)
+}
+
+func TestRestoreVersion(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	replaceBLOB(t, c, "myblob", "22")
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+
+	require.Nil(t, c.RestoreVersion(user, "myblob", versions[0].ID))
+	require.Equal(t, "1", readBLOB(t, c, "myblob"))
+	versions, err = c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Equal(t, int64(2), versions[0].Size)
+}
+
+func TestRestoreVersion_withRewrittenBLOB(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	replaceBLOB(t, c, "myblob", "22")
+	// the data service rewrites BLOBs in place.
+	require.Nil(t, ioutil.WriteFile(c.getStoragePath(user, "myblob"), []byte("333"), 0644))
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Nil(t, c.RestoreVersion(user, "myblob", versions[0].ID))
+	require.Equal(t, "1", readBLOB(t, c, "myblob"))
+}
+
+func TestDeleteObject_removesVersions(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	replaceBLOB(t, c, "mytree/myblob", "1")
+	replaceBLOB(t, c, "mytree/myblob", "22")
+	require.Nil(t, c.DeleteObject(user, "mytree"))
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	replaceBLOB(t, c, "mytree/myblob", "333")
+	versions, err := c.ListVersions(user, "mytree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(versions))
+}
+
+func TestDeleteObject_keepsVersionsInTrash(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	c.trashDir = path.Join(path.Dir(c.versionsDir), "trash")
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	replaceBLOB(t, c, "mytree/myblob", "1")
+	replaceBLOB(t, c, "mytree/myblob", "22")
+	require.Nil(t, c.DeleteObject(user, "mytree"))
+	versions, err := c.ListVersions(user, "mytree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(versions))
+
+	items, err := c.ListTrash(user)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Nil(t, c.RestoreTrashItem(user, items[0].ID, "restored"))
+	versions, err = c.ListVersions(user, "restored/myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Nil(t, c.RestoreVersion(user, "restored/myblob", versions[0].ID))
+	require.Equal(t, "1", readBLOB(t, c, "restored/myblob"))
+}
+
+func TestMoveObject_movesVersions(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	require.Nil(t, c.CreateTree(user, "mytree", false))
+	replaceBLOB(t, c, "mytree/myblob", "1")
+	replaceBLOB(t, c, "mytree/myblob", "22")
+	require.Nil(t, c.MoveObject(user, "mytree", "othertree"))
+	require.Nil(t, c.MoveObject(user, "othertree/myblob", "othertree/otherblob"))
+	versions, err := c.ListVersions(user, "mytree/myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(versions))
+	versions, err = c.ListVersions(user, "othertree/otherblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(versions))
+	require.Equal(t, "othertree/otherblob", versions[0].PathSpec)
+
+	// the versions of the BLOB replaced are kept.
+	replaceBLOB(t, c, "otherblob", "333")
+	require.Nil(t, c.MoveObject(user, "othertree/otherblob", "otherblob"))
+	versions, err = c.ListVersions(user, "otherblob")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(versions))
+	require.Equal(t, int64(3), versions[0].Size)
+	require.Equal(t, int64(1), versions[1].Size)
+}
+
+func TestRestoreVersion_withTree(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	replaceBLOB(t, c, "myblob", "22")
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	// the BLOB is replaced by a tree outside the controller.
+	require.Nil(t, os.Remove(c.getStoragePath(user, "myblob")))
+	require.Nil(t, os.Mkdir(c.getStoragePath(user, "myblob"), 0755))
+	err = c.RestoreVersion(user, "myblob", versions[0].ID)
+	conformance.RequireCode(t, codes.BadInputData, err)
+}
+
+func TestDeleteVersion(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	replaceBLOB(t, c, "myblob", "1")
+	replaceBLOB(t, c, "myblob", "22")
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Nil(t, c.DeleteVersion(user, "myblob", versions[0].ID))
+	versions, err = c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(versions))
+}
+
+func TestDeleteVersion_withUnknownVersion(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	err := c.DeleteVersion(user, "myblob", "123")
+	conformance.RequireCode(t, codes.NotFound, err)
+	err = c.DeleteVersion(user, "myblob", "../../myblob")
+	conformance.RequireCode(t, codes.NotFound, err)
+}
+
+func TestVersions_withRetention(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{MaxCount: 2})
+	defer cleanup()
+	for _, data := range []string{"1", "22", "333", "4444"} {
+		replaceBLOB(t, c, "myblob", data)
+	}
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(versions))
+	require.Equal(t, int64(3), versions[0].Size)
+	require.Equal(t, int64(2), versions[1].Size)
+}
+
+func TestListVersions_withExpiredVersions(t *testing.T) {
+	c, cleanup := newVersionsController(t, metadatacontroller.VersionRetention{})
+	defer cleanup()
+	for _, data := range []string{"1", "22", "333"} {
+		replaceBLOB(t, c, "myblob", data)
+	}
+	versions, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(versions))
+
+	// the versions expired are hidden, but only removed
+	// on the next change of the BLOB.
+	c.retention.MaxCount = 1
+	listed, err := c.ListVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(listed))
+	require.Equal(t, versions[0].ID, listed[0].ID)
+	_, err = c.ExamineVersion(user, "myblob", versions[1].ID)
+	conformance.RequireCode(t, codes.NotFound, err)
+	err = c.RestoreVersion(user, "myblob", versions[1].ID)
+	conformance.RequireCode(t, codes.NotFound, err)
+	kept, err := c.readVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(kept))
+	replaceBLOB(t, c, "myblob", "4444")
+	kept, err = c.readVersions(user, "myblob")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(kept))
+}
+
+func TestListVersions_withVersionsDisabled(t *testing.T) {
+	c := New(&Options{MetaDataDir: "/tmp/t"}).(*controller)
+	_, err := c.ListVersions(user, "myblob")
+	conformance.RequireCode(t, metadatacontroller.NotSupported, err)
+	err = c.RestoreVersion(user, "myblob", "123")
+	conformance.RequireCode(t, metadatacontroller.NotSupported, err)
+}
@@ -0,0 +1,63 @@
+package simple
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// listXattrs returns the names of the extended attributes of the
+// file at p, none if the file system does not support them.
+func listXattrs(p string) ([]string, error) {
+	size, err := syscall.Listxattr(p, nil)
+	if err == syscall.ENOTSUP {
+		return nil, nil
+	} else if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: p, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(p, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: p, Err: err}
+	}
+	return strings.Split(strings.TrimSuffix(string(buf[:size]), "\x00"), "\x00"), nil
+}
+
+func getXattr(p, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(p, name, nil)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: p, Err: err}
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(p, name, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: p, Err: err}
+	}
+	return buf[:size], nil
+}
+
+func setXattr(p, name string, value []byte) error {
+	if err := syscall.Setxattr(p, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: p, Err: err}
+	}
+	return nil
+}
+
+func removeXattr(p, name string) error {
+	if err := syscall.Removexattr(p, name); err != nil && err != syscall.ENODATA {
+		return &os.PathError{Op: "removexattr", Path: p, Err: err}
+	}
+	return nil
+}
+
+// isXattrSpaceError reports whether err is caused by
+// the extended attributes of a file being too large.
+func isXattrSpaceError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.ENOSPC || pathErr.Err == syscall.E2BIG
+	}
+	return false
+}
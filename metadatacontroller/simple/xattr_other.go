@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package simple
+
+import "errors"
+
+var errXattrNotSupported = errors.New("extended attributes are not supported on this platform")
+
+// listXattrs returns no attributes, as none can be set.
+func listXattrs(p string) ([]string, error) {
+	return nil, nil
+}
+
+func getXattr(p, name string) ([]byte, error) {
+	return nil, errXattrNotSupported
+}
+
+func setXattr(p, name string, value []byte) error {
+	return errXattrNotSupported
+}
+
+func removeXattr(p, name string) error {
+	return errXattrNotSupported
+}
+
+func isXattrSpaceError(err error) bool {
+	return false
+}
@@ -0,0 +1,856 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	// registers the sqlite3 driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	metadatacontroller.Register("sqlite", func(opts map[string]string) (metadatacontroller.MetaDataController, error) {
+		return New(&Options{Path: opts["Path"]})
+	})
+}
+
+// migrations contains the statements to create and upgrade the schema.
+// The schema version stored in the database is the number of migrations
+// applied, so new migrations must be appended at the end.
+var migrations = []string{
+	`CREATE TABLE objects (
+		id        INTEGER PRIMARY KEY,
+		username  TEXT NOT NULL,
+		parent_id INTEGER REFERENCES objects(id),
+		name      TEXT NOT NULL,
+		type      TEXT NOT NULL,
+		size      INTEGER NOT NULL DEFAULT 0,
+		checksum  TEXT NOT NULL DEFAULT '',
+		modtime   INTEGER NOT NULL,
+		UNIQUE (parent_id, name)
+	)`,
+	`CREATE UNIQUE INDEX objects_root ON objects(username) WHERE parent_id IS NULL`,
+	`CREATE INDEX objects_size ON objects(username, type, size)`,
+	`CREATE INDEX objects_modtime ON objects(username, modtime)`,
+	`CREATE TABLE properties (
+		object_id INTEGER NOT NULL REFERENCES objects(id),
+		key       TEXT NOT NULL,
+		value     TEXT NOT NULL,
+		PRIMARY KEY (object_id, key)
+	)`,
+	`ALTER TABLE objects ADD COLUMN etag TEXT NOT NULL DEFAULT ''`,
+}
+
+// Querier is implemented by the MetaDataController returned by New
+// and provides queries over the namespace of an user that are backed
+// by indexes of the database.
+type Querier interface {
+	// LargestBLOBs returns at most limit BLOBs sorted by size in descending order.
+	LargestBLOBs(user *entities.User, limit int) ([]*entities.ObjectInfo, error)
+	// RecentlyModified returns at most limit objects sorted by modification
+	// time in descending order.
+	RecentlyModified(user *entities.User, limit int) ([]*entities.ObjectInfo, error)
+	// Usage returns the space used by the BLOBs of the user.
+	Usage(user *entities.User) (*Usage, error)
+}
+
+// Usage represents the space used by an user.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	BLOBs int64 `json:"blobs"`
+	Trees int64 `json:"trees"`
+}
+
+type controller struct {
+	db *sql.DB
+	// tx is the transaction of the batch applied, if any,
+	// in which every operation is done.
+	tx *sql.Tx
+}
+
+// row represents an object of the namespace as stored in the database.
+type row struct {
+	id       int64
+	parentID sql.NullInt64
+	name     string
+	otype    entities.ObjectType
+	size     int64
+	checksum string
+	modTime  int64
+	etag     string
+}
+
+// New returns an implementation of MetaDataController that keeps
+// the namespace in a SQLite database, one row per object.
+// The schema of the database is created or upgraded when needed.
+func New(opts *Options) (metadatacontroller.MetaDataController, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Path == "" {
+		return nil, errors.New("path to the database is empty")
+	}
+	db, err := sql.Open("sqlite3", opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer at a time.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &controller{db: db}, nil
+}
+
+// Options hold the configuration options for the
+// SQLiteMetaDataController.
+type Options struct {
+	// Path is the location of the database file.
+	Path string
+}
+
+// migrate applies the migrations not yet applied to the database.
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	err = tx.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	for _, migration := range migrations[version:] {
+		if _, err := tx.Exec(migration); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE schema_version SET version = ?`, len(migrations)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *controller) Init(user *entities.User) error {
+	return c.update(func(tx *sql.Tx) error {
+		_, err := getRoot(tx, user)
+		if err == nil {
+			return nil
+		} else if !isNotFound(err) {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO objects (username, parent_id, name, type, modtime, etag) VALUES (?, NULL, '', ?, ?, ?)`,
+			user.Username, string(entities.ObjectTypeTree), now(), metadatacontroller.NewETag())
+		return err
+	})
+}
+
+func (c *controller) CreateTree(user *entities.User, pathSpec string, recursive bool) error {
+	p := cleanPath(pathSpec)
+	return c.update(func(tx *sql.Tx) error {
+		r, err := getRoot(tx, user)
+		if err != nil {
+			return err
+		}
+		names := split(p)
+		var created *row
+		for i, name := range names {
+			child, err := getChild(tx, r.id, name)
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+			last := i == len(names)-1
+			if child == nil {
+				if !recursive && !last {
+					return codes.NewErr(codes.NotFound, "parent tree not found")
+				}
+				child, err = insertRow(tx, user, &row{
+					parentID: sql.NullInt64{Int64: r.id, Valid: true},
+					name:     name,
+					otype:    entities.ObjectTypeTree,
+					modTime:  now(),
+					etag:     metadatacontroller.NewETag(),
+				})
+				if err != nil {
+					return err
+				}
+				if created == nil {
+					created = child
+				}
+			} else if last && !recursive {
+				return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+			} else if child.otype != entities.ObjectTypeTree {
+				return codes.NewErr(codes.BadInputData, "parent object is not a tree")
+			}
+			r = child
+		}
+		if len(names) == 0 && !recursive {
+			return codes.NewErr(metadatacontroller.AlreadyExists, "object already exists")
+		}
+		if created == nil {
+			return nil
+		}
+		return touchAncestors(tx, created.parentID.Int64)
+	})
+}
+
+func (c *controller) ExamineObject(user *entities.User, pathSpec string) (*entities.ObjectInfo, error) {
+	return c.ExamineObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) ExamineObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) (*entities.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var oinfo *entities.ObjectInfo
+	err := c.view(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, cleanPath(pathSpec))
+		if err != nil {
+			return err
+		}
+		if err := cond.Check(r.etag, true); err != nil {
+			return err
+		}
+		oinfo = getObjectInfo(pathSpec, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oinfo, nil
+}
+
+func (c *controller) ListTree(user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.ListTreeIf(context.Background(), user, pathSpec, opts, nil)
+}
+
+func (c *controller) ListTreeIf(ctx context.Context, user *entities.User, pathSpec string, opts *metadatacontroller.ListOptions, cond *metadatacontroller.Condition) ([]*entities.ObjectInfo, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	pos, err := opts.Position()
+	if err != nil {
+		return nil, "", err
+	}
+	depth, err := opts.GetDepth()
+	if err != nil {
+		return nil, "", err
+	}
+	var oinfos []*entities.ObjectInfo
+	var next string
+	err = c.view(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, cleanPath(pathSpec))
+		if err != nil {
+			return err
+		}
+		if err := cond.Check(r.etag, true); err != nil {
+			return err
+		}
+		if r.otype != entities.ObjectTypeTree {
+			return codes.NewErr(codes.BadInputData, "object is not a tree")
+		}
+		if pos.Order() != metadatacontroller.SortByName || depth != 1 {
+			// ids of the trees visited by the walk.
+			ids := map[string]int64{pathSpec: r.id}
+			oinfos, next, err = metadatacontroller.Walk(pathSpec, opts, func(pathSpec string) ([]*entities.ObjectInfo, error) {
+				children, err := queryRows(tx, `WHERE parent_id = ?`, ids[pathSpec])
+				if err != nil {
+					return nil, err
+				}
+				var oinfos []*entities.ObjectInfo
+				for _, child := range children {
+					p := path.Join(pathSpec, child.name)
+					if child.otype == entities.ObjectTypeTree {
+						ids[p] = child.id
+					}
+					oinfos = append(oinfos, getObjectInfo(p, child))
+				}
+				return oinfos, nil
+			})
+			return err
+		}
+
+		// pages in name order are read using the (parent_id, name) index.
+		limit := -1
+		if opts != nil && opts.Limit > 0 {
+			limit = opts.Limit + 1
+		}
+		children, err := queryRows(tx, `WHERE parent_id = ? AND name > ? ORDER BY name LIMIT ?`, r.id, pos.Name(), limit)
+		if err != nil {
+			return err
+		}
+		for i, child := range children {
+			if i == limit-1 {
+				next = pos.NextCursor(oinfos[len(oinfos)-1])
+				break
+			}
+			oinfos = append(oinfos, getObjectInfo(path.Join(pathSpec, child.name), child))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return oinfos, next, nil
+}
+
+func (c *controller) DeleteObject(user *entities.User, pathSpec string) error {
+	return c.DeleteObjectIf(context.Background(), user, pathSpec, nil)
+}
+
+func (c *controller) DeleteObjectIf(ctx context.Context, user *entities.User, pathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p := cleanPath(pathSpec)
+	if p == "/" {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be deleted")
+	}
+	return c.update(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, p)
+		if err != nil {
+			return err
+		}
+		if err := cond.Check(r.etag, false); err != nil {
+			return err
+		}
+		if err := deleteSubtree(tx, r.id); err != nil {
+			return err
+		}
+		return touchAncestors(tx, r.parentID.Int64)
+	})
+}
+
+func (c *controller) MoveObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	return c.MoveObjectIf(context.Background(), user, sourcePathSpec, targetPathSpec, nil)
+}
+
+func (c *controller) MoveObjectIf(ctx context.Context, user *entities.User, sourcePathSpec, targetPathSpec string, cond *metadatacontroller.Condition) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	if source == "/" {
+		return codes.NewErr(codes.BadInputData, "root tree cannot be moved")
+	}
+	if strings.HasPrefix(target, source+"/") {
+		return codes.NewErr(codes.BadInputData, "object cannot be moved inside itself")
+	}
+	return c.update(func(tx *sql.Tx) error {
+		if cond != nil {
+			r, err := getRow(tx, user, source)
+			if err != nil {
+				return err
+			}
+			if err := cond.Check(r.etag, false); err != nil {
+				return err
+			}
+		}
+		sourceRow, targetParent, err := prepareTransfer(tx, user, source, target)
+		if err != nil {
+			return err
+		}
+		if source == target {
+			return nil
+		}
+		_, err = tx.Exec(`UPDATE objects SET parent_id = ?, name = ? WHERE id = ?`,
+			targetParent.id, path.Base(target), sourceRow.id)
+		if err != nil {
+			return err
+		}
+		if err := touchAncestors(tx, sourceRow.parentID.Int64); err != nil {
+			return err
+		}
+		return touchAncestors(tx, targetParent.id)
+	})
+}
+
+func (c *controller) CopyObject(user *entities.User, sourcePathSpec, targetPathSpec string) error {
+	source, target := cleanPath(sourcePathSpec), cleanPath(targetPathSpec)
+	return c.update(func(tx *sql.Tx) error {
+		sourceRow, targetParent, err := prepareTransfer(tx, user, source, target)
+		if err != nil {
+			return err
+		}
+		if source == target {
+			return nil
+		}
+		// the whole subtree is read before inserting the copies, so a tree
+		// copied inside itself does not contain its own copy.
+		rows, err := querySubtree(tx, sourceRow.id)
+		if err != nil {
+			return err
+		}
+		ids := map[int64]int64{sourceRow.parentID.Int64: targetParent.id}
+		modTime, etag := now(), metadatacontroller.NewETag()
+		for _, r := range rows {
+			copied := *r
+			copied.parentID = sql.NullInt64{Int64: ids[r.parentID.Int64], Valid: true}
+			copied.modTime = modTime
+			copied.etag = etag
+			if r.id == sourceRow.id {
+				copied.name = path.Base(target)
+			}
+			inserted, err := insertRow(tx, user, &copied)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO properties (object_id, key, value)
+				SELECT ?, key, value FROM properties WHERE object_id = ?`, inserted.id, r.id)
+			if err != nil {
+				return err
+			}
+			ids[r.id] = inserted.id
+		}
+		return touchAncestors(tx, targetParent.id)
+	})
+}
+
+func (c *controller) PutBLOB(user *entities.User, pathSpec string, size int64, checksum string) error {
+	p := cleanPath(pathSpec)
+	if p == "/" {
+		return codes.NewErr(codes.BadInputData, "object is a tree")
+	}
+	return c.update(func(tx *sql.Tx) error {
+		parent, err := getParent(tx, user, p)
+		if err != nil {
+			return err
+		}
+		r, err := getChild(tx, parent.id, path.Base(p))
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if r == nil {
+			_, err = insertRow(tx, user, &row{
+				parentID: sql.NullInt64{Int64: parent.id, Valid: true},
+				name:     path.Base(p),
+				otype:    entities.ObjectTypeBLOB,
+				size:     size,
+				checksum: checksum,
+				modTime:  now(),
+				etag:     metadatacontroller.NewETag(),
+			})
+			if err != nil {
+				return err
+			}
+			return touchAncestors(tx, parent.id)
+		}
+		if r.otype == entities.ObjectTypeTree {
+			return codes.NewErr(codes.BadInputData, "object is a tree")
+		}
+		_, err = tx.Exec(`UPDATE objects SET size = ?, checksum = ?, modtime = ?, etag = ? WHERE id = ?`,
+			size, checksum, now(), metadatacontroller.NewETag(), r.id)
+		if err != nil {
+			return err
+		}
+		return touchAncestors(tx, parent.id)
+	})
+}
+
+func (c *controller) SetProperties(user *entities.User, pathSpec string, props map[string]string) error {
+	if err := metadatacontroller.CheckProperties(props); err != nil {
+		return err
+	}
+	return c.update(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, cleanPath(pathSpec))
+		if err != nil {
+			return err
+		}
+		for k, v := range props {
+			_, err := tx.Exec(`INSERT OR REPLACE INTO properties (object_id, key, value) VALUES (?, ?, ?)`, r.id, k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *controller) GetProperties(user *entities.User, pathSpec string) (map[string]string, error) {
+	props := map[string]string{}
+	err := c.view(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, cleanPath(pathSpec))
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT key, value FROM properties WHERE object_id = ?`, r.id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var k, v string
+			if err := rows.Scan(&k, &v); err != nil {
+				return err
+			}
+			props[k] = v
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func (c *controller) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	if err := metadatacontroller.CheckPropertyKeys(keys...); err != nil {
+		return err
+	}
+	return c.update(func(tx *sql.Tx) error {
+		r, err := getRow(tx, user, cleanPath(pathSpec))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if _, err := tx.Exec(`DELETE FROM properties WHERE object_id = ? AND key = ?`, r.id, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *controller) LargestBLOBs(user *entities.User, limit int) ([]*entities.ObjectInfo, error) {
+	return c.queryObjects(user, `WHERE username = ? AND type = ? ORDER BY size DESC LIMIT ?`,
+		user.Username, string(entities.ObjectTypeBLOB), limit)
+}
+
+func (c *controller) RecentlyModified(user *entities.User, limit int) ([]*entities.ObjectInfo, error) {
+	return c.queryObjects(user, `WHERE username = ? AND parent_id IS NOT NULL ORDER BY modtime DESC, id DESC LIMIT ?`,
+		user.Username, limit)
+}
+
+func (c *controller) Usage(user *entities.User) (*Usage, error) {
+	usage := &Usage{}
+	err := c.view(func(tx *sql.Tx) error {
+		if _, err := getRoot(tx, user); err != nil {
+			return err
+		}
+		return tx.QueryRow(`SELECT
+			COALESCE(SUM(CASE WHEN type = ? THEN size ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN type = ? THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN type = ? THEN 1 ELSE 0 END), 0)
+			FROM objects WHERE username = ? AND parent_id IS NOT NULL`,
+			string(entities.ObjectTypeBLOB), string(entities.ObjectTypeBLOB), string(entities.ObjectTypeTree),
+			user.Username).Scan(&usage.Bytes, &usage.BLOBs, &usage.Trees)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// queryObjects returns the objects matching the where clause with
+// their path specs rebuilt from the parent references.
+func (c *controller) queryObjects(user *entities.User, where string, args ...interface{}) ([]*entities.ObjectInfo, error) {
+	var oinfos []*entities.ObjectInfo
+	err := c.view(func(tx *sql.Tx) error {
+		rows, err := queryRows(tx, where, args...)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			p, err := getPath(tx, r)
+			if err != nil {
+				return err
+			}
+			oinfos = append(oinfos, getObjectInfo(p, r))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oinfos, nil
+}
+
+// errBatchFailed rolls back the transaction of a batch.
+var errBatchFailed = errors.New("batch failed")
+
+func (c *controller) ApplyBatch(ctx context.Context, user *entities.User, ops []*metadatacontroller.BatchOperation) ([]*metadatacontroller.BatchResult, error) {
+	var results []*metadatacontroller.BatchResult
+	err := c.update(func(tx *sql.Tx) error {
+		batch := &controller{db: c.db, tx: tx}
+		results = metadatacontroller.ApplyBatch(ctx, metadatacontroller.WithContext(batch), user, ops)
+		if metadatacontroller.BatchFailed(results) {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && err != errBatchFailed {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *controller) update(fn func(tx *sql.Tx) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *controller) view(fn func(tx *sql.Tx) error) error {
+	if c.tx != nil {
+		return fn(c.tx)
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// prepareTransfer checks that the object at source can be moved or copied
+// to target and removes the object being replaced at target if any.
+// It returns the source row and the row of the parent tree of target.
+func prepareTransfer(tx *sql.Tx, user *entities.User, source, target string) (*row, *row, error) {
+	sourceRow, err := getRow(tx, user, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if target == "/" {
+		return nil, nil, codes.NewErr(codes.BadInputData, "root tree cannot be replaced")
+	}
+	targetParent, err := getParent(tx, user, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source == target {
+		return sourceRow, targetParent, nil
+	}
+	targetRow, err := getChild(tx, targetParent.id, path.Base(target))
+	if err != nil {
+		if isNotFound(err) {
+			return sourceRow, targetParent, nil
+		}
+		return nil, nil, err
+	}
+	if targetRow.otype != sourceRow.otype {
+		return nil, nil, codes.NewErr(codes.BadInputData, "target object has a different type")
+	}
+	var children int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM objects WHERE parent_id = ?`, targetRow.id).Scan(&children); err != nil {
+		return nil, nil, err
+	}
+	if children > 0 {
+		return nil, nil, codes.NewErr(codes.BadInputData, "target tree is not empty")
+	}
+	if err := deleteSubtree(tx, targetRow.id); err != nil {
+		return nil, nil, err
+	}
+	return sourceRow, targetParent, nil
+}
+
+// deleteSubtree removes the object with the given id and all its
+// descendants, with their properties.
+func deleteSubtree(tx *sql.Tx, id int64) error {
+	const subtree = `WITH RECURSIVE subtree(id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT objects.id FROM objects JOIN subtree ON objects.parent_id = subtree.id
+		)`
+	if _, err := tx.Exec(subtree+` DELETE FROM properties WHERE object_id IN subtree`, id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(subtree+` DELETE FROM objects WHERE id IN subtree`, id)
+	return err
+}
+
+// touchAncestors gives a new ETag to the tree with the given id
+// and all its ancestors.
+func touchAncestors(tx *sql.Tx, id int64) error {
+	_, err := tx.Exec(`WITH RECURSIVE ancestors(id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT objects.parent_id FROM objects JOIN ancestors ON objects.id = ancestors.id
+			WHERE objects.parent_id IS NOT NULL
+		) UPDATE objects SET etag = ? WHERE id IN ancestors`, id, metadatacontroller.NewETag())
+	return err
+}
+
+// querySubtree returns the object with the given id and all its descendants,
+// parents before children.
+func querySubtree(tx *sql.Tx, id int64) ([]*row, error) {
+	return queryRows(tx, `JOIN (WITH RECURSIVE subtree(id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT objects.id, subtree.depth + 1 FROM objects JOIN subtree ON objects.parent_id = subtree.id
+		) SELECT id, depth FROM subtree) AS subtree ON objects.id = subtree.id
+		ORDER BY subtree.depth`, id)
+}
+
+func getRoot(tx *sql.Tx, user *entities.User) (*row, error) {
+	rows, err := queryRows(tx, `WHERE username = ? AND parent_id IS NULL`, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, codes.NewErr(codes.NotFound, "user home tree not found")
+	}
+	return rows[0], nil
+}
+
+func getChild(tx *sql.Tx, parentID int64, name string) (*row, error) {
+	rows, err := queryRows(tx, `WHERE parent_id = ? AND name = ?`, parentID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, codes.NewErr(codes.NotFound, "object not found")
+	}
+	return rows[0], nil
+}
+
+// getRow resolves p walking down from the root of the user.
+func getRow(tx *sql.Tx, user *entities.User, p string) (*row, error) {
+	r, err := getRoot(tx, user)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range split(p) {
+		if r.otype != entities.ObjectTypeTree {
+			return nil, codes.NewErr(codes.NotFound, "object not found")
+		}
+		r, err = getChild(tx, r.id, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// getParent returns the parent tree of p.
+func getParent(tx *sql.Tx, user *entities.User, p string) (*row, error) {
+	parent, err := getRow(tx, user, path.Dir(p))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, codes.NewErr(codes.NotFound, "parent tree not found")
+		}
+		return nil, err
+	}
+	if parent.otype != entities.ObjectTypeTree {
+		return nil, codes.NewErr(codes.BadInputData, "parent object is not a tree")
+	}
+	return parent, nil
+}
+
+// getPath rebuilds the path of r following the parent references.
+func getPath(tx *sql.Tx, r *row) (string, error) {
+	var names []string
+	for r.parentID.Valid {
+		names = append([]string{r.name}, names...)
+		rows, err := queryRows(tx, `WHERE id = ?`, r.parentID.Int64)
+		if err != nil {
+			return "", err
+		}
+		if len(rows) == 0 {
+			return "", codes.NewErr(codes.NotFound, "parent tree not found")
+		}
+		r = rows[0]
+	}
+	return "/" + strings.Join(names, "/"), nil
+}
+
+func insertRow(tx *sql.Tx, user *entities.User, r *row) (*row, error) {
+	res, err := tx.Exec(`INSERT INTO objects (username, parent_id, name, type, size, checksum, modtime, etag) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.Username, r.parentID, r.name, string(r.otype), r.size, r.checksum, r.modTime, r.etag)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	inserted := *r
+	inserted.id = id
+	return &inserted, nil
+}
+
+func queryRows(tx *sql.Tx, clause string, args ...interface{}) ([]*row, error) {
+	rows, err := tx.Query(`SELECT objects.id, objects.parent_id, objects.name, objects.type,
+		objects.size, objects.checksum, objects.modtime, objects.etag FROM objects `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []*row
+	for rows.Next() {
+		r := &row{}
+		var otype string
+		if err := rows.Scan(&r.id, &r.parentID, &r.name, &otype, &r.size, &r.checksum, &r.modTime, &r.etag); err != nil {
+			return nil, err
+		}
+		r.otype = entities.ObjectType(otype)
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func getObjectInfo(pathSpec string, r *row) *entities.ObjectInfo {
+	oinfo := &entities.ObjectInfo{
+		PathSpec: pathSpec,
+		Size:     r.size,
+		Type:     r.otype,
+		Checksum: r.checksum,
+		ModTime:  r.modTime,
+	}
+	if r.otype == entities.ObjectTypeTree {
+		oinfo.MimeType = entities.ObjectTypeTreeMimeType
+	} else {
+		oinfo.MimeType = mime.TypeByExtension(path.Ext(pathSpec))
+	}
+	metadatacontroller.SetETag(oinfo, r.etag)
+	return oinfo
+}
+
+func isNotFound(err error) bool {
+	codeErr, ok := err.(*codes.Err)
+	return ok && codeErr.Code == codes.NotFound
+}
+
+// split returns the names of the path components of p.
+func split(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// cleanPath returns the absolute clean form of pathSpec, avoiding
+// path traversal outside of the user namespace.
+func cleanPath(pathSpec string) string {
+	return path.Join("/", pathSpec)
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
@@ -0,0 +1,353 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/conformance"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+var user = &entities.User{Username: "test"}
+
+type TestSuite struct {
+	suite.Suite
+	metadataController metadatacontroller.MetaDataController
+	controller         *controller
+	dir                string
+}
+
+func Test(t *testing.T) {
+	suite.Run(t, new(TestSuite))
+}
+func TestConformance(t *testing.T) {
+	conformance.RunSuite(t, func(t *testing.T) *conformance.Backend {
+		dir, err := ioutil.TempDir("", "clawio-sqlite-")
+		require.Nil(t, err)
+		metadataController, err := New(&Options{Path: path.Join(dir, "metadata.sqlite")})
+		require.Nil(t, err)
+		return &conformance.Backend{
+			Controller: metadataController,
+			Cleanup: func() {
+				metadataController.(*controller).db.Close()
+				os.RemoveAll(dir)
+			},
+		}
+	})
+}
+func (suite *TestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "clawio-sqlite-")
+	require.Nil(suite.T(), err)
+	suite.dir = dir
+	metadataController, err := New(&Options{Path: path.Join(dir, "metadata.sqlite")})
+	require.Nil(suite.T(), err)
+	suite.metadataController = metadataController
+	suite.controller = suite.metadataController.(*controller)
+	err = suite.metadataController.Init(user)
+	require.Nil(suite.T(), err)
+}
+func (suite *TestSuite) TearDownTest() {
+	suite.controller.db.Close()
+	os.RemoveAll(suite.dir)
+}
+func (suite *TestSuite) TestNew_withNilOptions() {
+	_, err := New(nil)
+	require.NotNil(suite.T(), err)
+}
+func (suite *TestSuite) TestRegister() {
+	opts := map[string]string{"Path": path.Join(suite.dir, "other.sqlite")}
+	metadataController, err := metadatacontroller.New("sqlite", opts)
+	require.Nil(suite.T(), err)
+	require.IsType(suite.T(), &controller{}, metadataController)
+	metadataController.(*controller).db.Close()
+}
+func (suite *TestSuite) TestInit() {
+	err := suite.metadataController.Init(user)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "/")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTree, info.Type)
+}
+
+func (suite *TestSuite) TestCreateTree() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTree, info.Type)
+	require.Equal(suite.T(), entities.ObjectTypeTreeMimeType, info.MimeType)
+}
+func (suite *TestSuite) TestCreateTree_withAlreadyExists() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "mytree", false)
+	requireCode(suite.T(), metadatacontroller.AlreadyExists, err)
+}
+func (suite *TestSuite) TestCreateTree_withParentNotFound() {
+	err := suite.metadataController.CreateTree(user, "notexists/mytree", false)
+	requireCode(suite.T(), codes.NotFound, err)
+}
+func (suite *TestSuite) TestCreateTree_withParentBLOB() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "myblob/mytree", true)
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+func (suite *TestSuite) TestCreateTree_overExistingBLOB() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "myblob", false)
+	requireCode(suite.T(), metadatacontroller.AlreadyExists, err)
+}
+func (suite *TestSuite) TestCreateTree_recursive() {
+	err := suite.metadataController.CreateTree(user, "a/b/c", true)
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "a/b/c")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), entities.ObjectTypeTree, info.Type)
+	err = suite.metadataController.CreateTree(user, "a/b/c", true)
+	require.Nil(suite.T(), err)
+}
+
+func (suite *TestSuite) TestExamineObject() {
+	err := suite.controller.PutBLOB(user, "myblob.pdf", 1, "md5:c4ca4238a0b923820dcc509a6f75849b")
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "myblob.pdf")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "myblob.pdf", info.PathSpec)
+	require.Equal(suite.T(), int64(1), info.Size)
+	require.Equal(suite.T(), "md5:c4ca4238a0b923820dcc509a6f75849b", info.Checksum)
+	require.Equal(suite.T(), "application/pdf", info.MimeType)
+	require.Equal(suite.T(), entities.ObjectTypeBLOB, info.Type)
+	require.NotEqual(suite.T(), int64(0), info.ModTime)
+}
+func (suite *TestSuite) TestExamineObject_withNotFound() {
+	_, err := suite.metadataController.ExamineObject(user, "notexists")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+func (suite *TestSuite) TestExamineObject_withUserNotInitialized() {
+	_, err := suite.metadataController.ExamineObject(&entities.User{Username: "other"}, "/")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+
+func (suite *TestSuite) TestListTree() {
+	err := suite.metadataController.CreateTree(user, "testlisttree/othertree/deeptree", true)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "testlisttree/myblob", 1, "")
+	require.Nil(suite.T(), err)
+	infos, _, err := suite.metadataController.ListTree(user, "testlisttree", nil)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 2, len(infos))
+	require.Equal(suite.T(), "testlisttree/myblob", infos[0].PathSpec)
+	require.Equal(suite.T(), "testlisttree/othertree", infos[1].PathSpec)
+}
+func (suite *TestSuite) TestListTree_withNotFound() {
+	_, _, err := suite.metadataController.ListTree(user, "notexists", nil)
+	requireCode(suite.T(), codes.NotFound, err)
+}
+func (suite *TestSuite) TestListTree_withBLOB() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	_, _, err = suite.metadataController.ListTree(user, "myblob", nil)
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+
+func (suite *TestSuite) TestDeleteObject() {
+	err := suite.metadataController.CreateTree(user, "mytree/othertree", true)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/othertree/myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.DeleteObject(user, "mytree")
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "mytree/othertree/myblob")
+	requireCode(suite.T(), codes.NotFound, err)
+	infos, _, err := suite.metadataController.ListTree(user, "/", nil)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 0, len(infos))
+}
+func (suite *TestSuite) TestDeleteObject_withNotFound() {
+	err := suite.metadataController.DeleteObject(user, "notexists")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+func (suite *TestSuite) TestDeleteObject_withRoot() {
+	err := suite.metadataController.DeleteObject(user, "/")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+
+func (suite *TestSuite) TestMoveBLOBObject() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "myblob", "otherblob")
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "myblob")
+	requireCode(suite.T(), codes.NotFound, err)
+	info, err := suite.metadataController.ExamineObject(user, "otherblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+}
+func (suite *TestSuite) TestMoveTreeObject() {
+	err := suite.metadataController.CreateTree(user, "mytree/othertree", true)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/othertree/myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "mytree", "movedtree")
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "mytree")
+	requireCode(suite.T(), codes.NotFound, err)
+	info, err := suite.metadataController.ExamineObject(user, "movedtree/othertree/myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+}
+func (suite *TestSuite) TestMoveBLOBObject_overExistingBLOB() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "myblob2", 2, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "myblob", "myblob2")
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "myblob2")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+}
+func (suite *TestSuite) TestMoveBLOBObject_overExistingTree() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "myblob", "mytree")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+func (suite *TestSuite) TestMoveTreeObject_overExistingBLOB() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "mytree", "myblob")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+func (suite *TestSuite) TestMoveTreeObject_overExistingTree() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CreateTree(user, "othertree/deeptree", true)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "mytree", "othertree")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+func (suite *TestSuite) TestMoveTreeObject_intoItself() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "mytree", "mytree/othertree")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+func (suite *TestSuite) TestMoveObject_withTargetNotFound() {
+	err := suite.controller.PutBLOB(user, "myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.MoveObject(user, "myblob", "notexists/otherblob")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+func (suite *TestSuite) TestMoveObject_withSourceNotFound() {
+	err := suite.metadataController.MoveObject(user, "notexists", "otherblob")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+
+func (suite *TestSuite) TestCopyTreeObject() {
+	err := suite.metadataController.CreateTree(user, "mytree/othertree", true)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/othertree/myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "mytree", "copiedtree")
+	require.Nil(suite.T(), err)
+	_, err = suite.metadataController.ExamineObject(user, "mytree/othertree/myblob")
+	require.Nil(suite.T(), err)
+	info, err := suite.metadataController.ExamineObject(user, "copiedtree/othertree/myblob")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), int64(1), info.Size)
+}
+func (suite *TestSuite) TestCopyTreeObject_intoItself() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/myblob", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.metadataController.CopyObject(user, "mytree", "mytree/copy")
+	require.Nil(suite.T(), err)
+	infos, _, err := suite.metadataController.ListTree(user, "mytree/copy", nil)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 1, len(infos))
+}
+func (suite *TestSuite) TestCopyObject_withSourceNotFound() {
+	err := suite.metadataController.CopyObject(user, "notexists", "otherblob")
+	requireCode(suite.T(), codes.NotFound, err)
+}
+
+func (suite *TestSuite) TestPutBLOB_overExistingTree() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree", 1, "")
+	requireCode(suite.T(), codes.BadInputData, err)
+}
+
+func (suite *TestSuite) TestMigrate_isIdempotent() {
+	err := migrate(suite.controller.db)
+	require.Nil(suite.T(), err)
+	var version int
+	err = suite.controller.db.QueryRow(`SELECT version FROM schema_version`).Scan(&version)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), len(migrations), version)
+}
+
+func (suite *TestSuite) TestLargestBLOBs() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/small", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/big", 100, "")
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "medium", 10, "")
+	require.Nil(suite.T(), err)
+	infos, err := suite.metadataController.(Querier).LargestBLOBs(user, 2)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 2, len(infos))
+	require.Equal(suite.T(), "/mytree/big", infos[0].PathSpec)
+	require.Equal(suite.T(), "/medium", infos[1].PathSpec)
+}
+
+func (suite *TestSuite) TestRecentlyModified() {
+	err := suite.controller.PutBLOB(user, "first", 1, "")
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "second", 1, "")
+	require.Nil(suite.T(), err)
+	infos, err := suite.metadataController.(Querier).RecentlyModified(user, 10)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 2, len(infos))
+	require.Equal(suite.T(), "/second", infos[0].PathSpec)
+}
+
+func (suite *TestSuite) TestUsage() {
+	err := suite.metadataController.CreateTree(user, "mytree", false)
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "mytree/myblob", 3, "")
+	require.Nil(suite.T(), err)
+	err = suite.controller.PutBLOB(user, "myblob", 4, "")
+	require.Nil(suite.T(), err)
+	usage, err := suite.metadataController.(Querier).Usage(user)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), &Usage{Bytes: 7, BLOBs: 2, Trees: 1}, usage)
+}
+
+func (suite *TestSuite) TestUsage_withUserNotInitialized() {
+	_, err := suite.metadataController.(Querier).Usage(&entities.User{Username: "other"})
+	requireCode(suite.T(), codes.NotFound, err)
+}
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	require.NotNil(t, err)
+	codeErr, ok := err.(*codes.Err)
+	require.True(t, ok)
+	require.Equal(t, code, codeErr.Code)
+}
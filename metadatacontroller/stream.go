@@ -0,0 +1,35 @@
+package metadatacontroller
+
+import (
+	"context"
+
+	"github.com/clawio/entities"
+)
+
+// TreeStreamer is implemented by controllers able to list a tree
+// without holding all the entries listed in memory.
+type TreeStreamer interface {
+	// StreamTreeContext lists the tree at pathSpec like ListTreeContext but
+	// calls fn for every entry instead of returning them. It returns the
+	// cursor of the next page.
+	StreamTreeContext(ctx context.Context, user *entities.User, pathSpec string, opts *ListOptions, fn ListFunc) (string, error)
+}
+
+// StreamTree lists the tree at pathSpec calling fn for every entry and
+// returns the cursor of the next page. Controllers that do not implement
+// TreeStreamer are listed with ListTreeContext.
+func StreamTree(ctx context.Context, c ContextMetaDataController, user *entities.User, pathSpec string, opts *ListOptions, fn ListFunc) (string, error) {
+	if s, ok := c.(TreeStreamer); ok {
+		return s.StreamTreeContext(ctx, user, pathSpec, opts, fn)
+	}
+	oinfos, next, err := c.ListTreeContext(ctx, user, pathSpec, opts)
+	if err != nil {
+		return "", err
+	}
+	for _, oinfo := range oinfos {
+		if err := fn(oinfo); err != nil {
+			return "", err
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,44 @@
+package metadatacontroller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/clawio/entities"
+	"github.com/stretchr/testify/require"
+)
+
+// listController lists the same entries for every tree.
+type listController struct {
+	nopController
+	oinfos []*entities.ObjectInfo
+}
+
+func (c *listController) ListTree(user *entities.User, pathSpec string, opts *ListOptions) ([]*entities.ObjectInfo, string, error) {
+	return c.oinfos, "next", nil
+}
+
+func TestStreamTree(t *testing.T) {
+	c := &listController{oinfos: []*entities.ObjectInfo{{PathSpec: "a"}, {PathSpec: "b"}}}
+	var got []*entities.ObjectInfo
+	next, err := StreamTree(context.Background(), WithContext(c), &entities.User{}, "/", nil, func(oinfo *entities.ObjectInfo) error {
+		got = append(got, oinfo)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, "next", next)
+	require.Equal(t, c.oinfos, got)
+}
+
+func TestStreamTree_withListFuncError(t *testing.T) {
+	c := &listController{oinfos: []*entities.ObjectInfo{{PathSpec: "a"}, {PathSpec: "b"}}}
+	stop := errors.New("stop")
+	calls := 0
+	_, err := StreamTree(context.Background(), WithContext(c), &entities.User{}, "/", nil, func(oinfo *entities.ObjectInfo) error {
+		calls++
+		return stop
+	})
+	require.Equal(t, stop, err)
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,33 @@
+package metadatacontroller
+
+import (
+	"github.com/clawio/entities"
+)
+
+// TrashItem is an object deleted by a user and kept in the trash.
+type TrashItem struct {
+	// ID identifies the item in the trash of the user.
+	ID string
+	// PathSpec is the path the object had when it was deleted.
+	PathSpec string
+	// DeletedAt is the Unix time of the deletion.
+	DeletedAt int64
+	Type      entities.ObjectType
+	Size      int64
+}
+
+// TrashController is implemented by controllers that move deleted objects
+// to a per-user trash, from where they can be restored or purged.
+type TrashController interface {
+	// ListTrash returns the items in the trash of the user,
+	// most recently deleted first.
+	ListTrash(user *entities.User) ([]*TrashItem, error)
+	// RestoreTrashItem moves the item back to targetPathSpec,
+	// or to the path it had if targetPathSpec is empty.
+	RestoreTrashItem(user *entities.User, id, targetPathSpec string) error
+	// PurgeTrashItem removes the item from the trash for good.
+	PurgeTrashItem(user *entities.User, id string) error
+	// PurgeTrash removes for good the items deleted at or before
+	// the Unix time given and returns the number of items removed.
+	PurgeTrash(user *entities.User, before int64) (int, error)
+}
@@ -0,0 +1,101 @@
+package metadatacontroller
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/clawio/entities"
+)
+
+// Version is a previous state of a BLOB, kept when another object is
+// moved or copied over the BLOB or a version of the BLOB is restored.
+// BLOBs overwritten in place, by writing their data outside the
+// controller, are not versioned.
+type Version struct {
+	// ID identifies the version among the versions of the BLOB.
+	ID       string
+	PathSpec string
+	Size     int64
+	Checksum string
+	// ModTime is the modification time the BLOB had.
+	ModTime int64
+	// CreatedAt is the Unix time when the BLOB was replaced.
+	CreatedAt int64
+}
+
+// VersionController is implemented by controllers that keep
+// the previous versions of BLOBs. The versions follow their BLOB
+// when it is moved and are removed when it is deleted. Only the
+// controllers holding the data of the BLOBs can keep versions, so
+// the ones implementing BLOBPutter do not, and BLOBs overwritten
+// through PutBLOB are not versioned.
+type VersionController interface {
+	// ListVersions returns the versions of the BLOB at pathSpec,
+	// most recent first.
+	ListVersions(user *entities.User, pathSpec string) ([]*Version, error)
+	ExamineVersion(user *entities.User, pathSpec, id string) (*Version, error)
+	// RestoreVersion makes the version the current state of the BLOB.
+	// The state being replaced is kept as a new version.
+	RestoreVersion(user *entities.User, pathSpec, id string) error
+	DeleteVersion(user *entities.User, pathSpec, id string) error
+}
+
+// VersionRetention is the policy deciding how long versions are kept.
+// A zero value keeps versions forever.
+type VersionRetention struct {
+	// MaxCount is the maximum number of versions kept per BLOB.
+	MaxCount int
+	// MaxAge is the maximum age in seconds of the versions kept.
+	MaxAge int64
+}
+
+// NewVersionRetention returns the retention policy given by the
+// VersionsMaxCount and VersionsMaxAge options of a controller.
+func NewVersionRetention(opts map[string]string) (*VersionRetention, error) {
+	r := &VersionRetention{}
+	if v := opts["VersionsMaxCount"]; v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		r.MaxCount = count
+	}
+	if v := opts["VersionsMaxAge"]; v != "" {
+		age, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		r.MaxAge = age
+	}
+	return r, nil
+}
+
+// Expired returns the versions that must be removed at the Unix time now.
+func (r *VersionRetention) Expired(versions []*Version, now int64) []*Version {
+	sorted := make([]*Version, len(versions))
+	copy(sorted, versions)
+	SortVersions(sorted)
+	var expired []*Version
+	for i, v := range sorted {
+		if (r.MaxCount > 0 && i >= r.MaxCount) || (r.MaxAge > 0 && now-v.CreatedAt > r.MaxAge) {
+			expired = append(expired, v)
+		}
+	}
+	return expired
+}
+
+// SortVersions sorts versions from the most recent to the oldest.
+func SortVersions(versions []*Version) {
+	sort.Sort(byCreation(versions))
+}
+
+type byCreation []*Version
+
+func (s byCreation) Len() int      { return len(s) }
+func (s byCreation) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCreation) Less(i, j int) bool {
+	if s[i].CreatedAt != s[j].CreatedAt {
+		return s[i].CreatedAt > s[j].CreatedAt
+	}
+	return s[i].ID > s[j].ID
+}
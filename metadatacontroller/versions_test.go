@@ -0,0 +1,33 @@
+package metadatacontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVersionRetention(t *testing.T) {
+	r, err := NewVersionRetention(map[string]string{"VersionsMaxCount": "3", "VersionsMaxAge": "60"})
+	require.Nil(t, err)
+	require.Equal(t, &VersionRetention{MaxCount: 3, MaxAge: 60}, r)
+	_, err = NewVersionRetention(map[string]string{"VersionsMaxAge": "1h"})
+	require.NotNil(t, err)
+}
+
+func TestVersionRetention_Expired(t *testing.T) {
+	versions := []*Version{
+		{ID: "1", CreatedAt: 10},
+		{ID: "3", CreatedAt: 30},
+		{ID: "2", CreatedAt: 20},
+	}
+	require.Equal(t, 0, len((&VersionRetention{}).Expired(versions, 100)))
+
+	expired := (&VersionRetention{MaxCount: 2}).Expired(versions, 100)
+	require.Equal(t, 1, len(expired))
+	require.Equal(t, "1", expired[0].ID)
+
+	expired = (&VersionRetention{MaxAge: 75}).Expired(versions, 100)
+	require.Equal(t, 2, len(expired))
+	require.Equal(t, "2", expired[0].ID)
+	require.Equal(t, "1", expired[1].ID)
+}
@@ -0,0 +1,8 @@
+// Package rpc serves the metadata API over gRPC.
+//
+// The messages and the client and server stubs in metadata.pb.go are
+// generated from metadata.proto with go generate, which needs protoc and
+// protoc-gen-go in the PATH, and must not be edited.
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. metadata.proto
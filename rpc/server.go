@@ -0,0 +1,242 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/authentication/lib"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/service"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// AuthorizationMetadata is the metadata header carrying the
+	// JWT of the user as "bearer <token>".
+	AuthorizationMetadata = "authorization"
+
+	// NextCursorTrailer is the trailer of ListTree carrying the cursor
+	// of the next page of a listing. It is absent on the last page.
+	NextCursorTrailer = "x-next-cursor"
+)
+
+type userKey struct{}
+
+// Server implements MetaDataServer on top of a metadata controller.
+type Server struct {
+	MetaDataController metadatacontroller.MetaDataController
+	// MaxListEntries is the maximum number of entries sent by a
+	// single ListTree, service.DefaultMaxListEntries if 0.
+	MaxListEntries int
+
+	authenticator *lib.Authenticator
+}
+
+// New returns a Server for c authenticating the users with the
+// JWT key and signing method of cfg.
+func New(c metadatacontroller.MetaDataController, cfg *service.GeneralConfig) *Server {
+	return &Server{
+		MetaDataController: c,
+		MaxListEntries:     cfg.MaxListEntries,
+		authenticator:      lib.NewAuthenticator(cfg.JWTKey, cfg.JWTSigningMethod),
+	}
+}
+
+// NewGRPCServer returns a grpc.Server serving s, which rejects
+// the calls without a valid token with codes.Unauthenticated.
+func NewGRPCServer(s *Server, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(s.authenticateUnary),
+		grpc.StreamInterceptor(s.authenticateStream))
+	g := grpc.NewServer(opts...)
+	RegisterMetaDataServer(g, s)
+	return g
+}
+
+// UserFromContext returns the user authenticated for a call.
+func UserFromContext(ctx context.Context) *entities.User {
+	user, _ := ctx.Value(userKey{}).(*entities.User)
+	return user
+}
+
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md[AuthorizationMetadata]; len(values) > 0 {
+		token = values[0]
+	}
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+	user, err := s.authenticator.CreateUserFromToken(token)
+	if err != nil {
+		server.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("invalid token")
+		return nil, status.Error(grpccodes.Unauthenticated, "invalid token")
+	}
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{stream, ctx})
+}
+
+// authenticatedStream is a grpc.ServerStream whose
+// context carries the user authenticated.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authenticatedStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (s *Server) contextController() metadatacontroller.ContextMetaDataController {
+	return metadatacontroller.WithContext(s.MetaDataController)
+}
+
+// Init creates the home tree of the user.
+func (s *Server) Init(ctx context.Context, req *InitRequest) (*InitResponse, error) {
+	if err := s.contextController().InitContext(ctx, UserFromContext(ctx)); err != nil {
+		return nil, toStatus(err, "error creating user home tree")
+	}
+	return &InitResponse{}, nil
+}
+
+// Examine retrieves the information about an object.
+func (s *Server) Examine(ctx context.Context, req *ExamineRequest) (*ObjectInfo, error) {
+	oinfo, err := s.contextController().ExamineObjectContext(ctx, UserFromContext(ctx), req.PathSpec)
+	if err != nil {
+		return nil, toStatus(err, "error examining object")
+	}
+	return newObjectInfo(oinfo), nil
+}
+
+// ListTree streams the information about the descendants of a tree,
+// and sets the cursor of the next page in the NextCursorTrailer.
+func (s *Server) ListTree(req *ListTreeRequest, stream MetaData_ListTreeServer) error {
+	opts, err := s.getListOptions(req)
+	if err != nil {
+		return toStatus(err, "error listing tree")
+	}
+	ctx := stream.Context()
+	next, err := metadatacontroller.StreamTree(ctx, s.contextController(), UserFromContext(ctx), req.PathSpec, opts, func(oinfo *entities.ObjectInfo) error {
+		return stream.Send(newObjectInfo(oinfo))
+	})
+	if err != nil {
+		return toStatus(err, "error listing tree")
+	}
+	if next != "" {
+		stream.SetTrailer(metadata.Pairs(NextCursorTrailer, next))
+	}
+	return nil
+}
+
+func (s *Server) getListOptions(req *ListTreeRequest) (*metadatacontroller.ListOptions, error) {
+	if req.Limit < 0 {
+		return nil, codes.NewErr(codes.BadInputData, "limit must be a non-negative number")
+	}
+	if req.Depth < metadatacontroller.DepthInfinity {
+		return nil, codes.NewErr(codes.BadInputData, "depth must be a positive number or -1")
+	}
+	opts := &metadatacontroller.ListOptions{
+		Limit:  int(req.Limit),
+		Cursor: req.Cursor,
+		Sort:   metadatacontroller.SortOrder(req.Sort),
+		Depth:  int(req.Depth),
+	}
+	maxEntries := s.MaxListEntries
+	if maxEntries <= 0 {
+		maxEntries = service.DefaultMaxListEntries
+	}
+	if opts.Limit == 0 || opts.Limit > maxEntries {
+		opts.Limit = maxEntries
+	}
+	return opts, nil
+}
+
+// Move moves an object.
+func (s *Server) Move(ctx context.Context, req *MoveRequest) (*MoveResponse, error) {
+	err := s.contextController().MoveObjectContext(ctx, UserFromContext(ctx), req.SourcePathSpec, req.TargetPathSpec)
+	if err != nil {
+		return nil, toStatus(err, "error moving object")
+	}
+	return &MoveResponse{}, nil
+}
+
+// Delete deletes an object.
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	if err := s.contextController().DeleteObjectContext(ctx, UserFromContext(ctx), req.PathSpec); err != nil {
+		return nil, toStatus(err, "error deleting object")
+	}
+	return &DeleteResponse{}, nil
+}
+
+func newObjectInfo(oinfo *entities.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		PathSpec: oinfo.PathSpec,
+		Size:     oinfo.Size,
+		Type:     string(oinfo.Type),
+		MimeType: oinfo.MimeType,
+		Checksum: oinfo.Checksum,
+		ModTime:  oinfo.ModTime,
+		Etag:     metadatacontroller.GetETag(oinfo),
+	}
+}
+
+// toStatus returns the gRPC status error for err, the counterpart of the
+// HTTP status codes answered by the service. Unexpected errors are logged
+// with msg.
+func toStatus(err error, msg string) error {
+	switch err {
+	case context.Canceled:
+		return status.Error(grpccodes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(grpccodes.DeadlineExceeded, err.Error())
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		switch codeErr.Code {
+		case codes.NotFound:
+			return status.Error(grpccodes.NotFound, err.Error())
+		case codes.BadInputData:
+			return status.Error(grpccodes.InvalidArgument, err.Error())
+		case metadatacontroller.AlreadyExists:
+			return status.Error(grpccodes.AlreadyExists, err.Error())
+		case metadatacontroller.QuotaExceeded:
+			return status.Error(grpccodes.ResourceExhausted, err.Error())
+		case metadatacontroller.PreconditionFailed:
+			return status.Error(grpccodes.FailedPrecondition, err.Error())
+		case metadatacontroller.NotSupported:
+			return status.Error(grpccodes.Unimplemented, err.Error())
+		}
+	}
+	if _, ok := status.FromError(err); ok {
+		// the stream failed to send.
+		return err
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error(msg)
+	return status.Error(grpccodes.Internal, err.Error())
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/clawio/authentication/lib"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/clawio/metadata/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var user = &entities.User{Username: "test"}
+
+// newClient serves c over a local listener and returns a client
+// authenticated as user, with a function stopping both.
+func newClient(t *testing.T, c metadatacontroller.MetaDataController) (MetaDataClient, context.Context, func()) {
+	cfg := &service.GeneralConfig{JWTKey: "secret", JWTSigningMethod: "HS256", MaxListEntries: 2}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	g := NewGRPCServer(New(c, cfg))
+	go g.Serve(lis)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.Nil(t, err)
+
+	token, err := lib.NewAuthenticator(cfg.JWTKey, cfg.JWTSigningMethod).CreateToken(user)
+	require.Nil(t, err)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(AuthorizationMetadata, "bearer "+token))
+	return NewMetaDataClient(conn), ctx, func() {
+		conn.Close()
+		g.Stop()
+	}
+}
+
+func requireCode(t *testing.T, code grpccodes.Code, err error) {
+	require.NotNil(t, err)
+	require.Equal(t, code, status.Code(err), err.Error())
+}
+
+func TestServer(t *testing.T) {
+	c := memory.New()
+	client, ctx, stop := newClient(t, c)
+	defer stop()
+
+	_, err := client.Init(ctx, &InitRequest{})
+	require.Nil(t, err)
+	for _, pathSpec := range []string{"a", "b", "c"} {
+		require.Nil(t, c.CreateTree(user, pathSpec, false))
+	}
+	require.Nil(t, c.(metadatacontroller.BLOBPutter).PutBLOB(user, "a/blob.txt", 3, ""))
+
+	oinfo, err := client.Examine(ctx, &ExamineRequest{PathSpec: "a/blob.txt"})
+	require.Nil(t, err)
+	require.Equal(t, "a/blob.txt", oinfo.PathSpec)
+	require.Equal(t, int64(3), oinfo.Size)
+	require.Equal(t, string(entities.ObjectTypeBLOB), oinfo.Type)
+	require.NotEqual(t, "", oinfo.Etag)
+
+	_, err = client.Move(ctx, &MoveRequest{SourcePathSpec: "a/blob.txt", TargetPathSpec: "b/blob.txt"})
+	require.Nil(t, err)
+	_, err = client.Examine(ctx, &ExamineRequest{PathSpec: "b/blob.txt"})
+	require.Nil(t, err)
+
+	_, err = client.Delete(ctx, &DeleteRequest{PathSpec: "b/blob.txt"})
+	require.Nil(t, err)
+	_, err = client.Examine(ctx, &ExamineRequest{PathSpec: "b/blob.txt"})
+	requireCode(t, grpccodes.NotFound, err)
+	_, err = client.Delete(ctx, &DeleteRequest{PathSpec: "b/blob.txt"})
+	requireCode(t, grpccodes.NotFound, err)
+}
+
+func TestServer_listTree(t *testing.T) {
+	c := memory.New()
+	client, ctx, stop := newClient(t, c)
+	defer stop()
+	require.Nil(t, c.Init(user))
+	for _, pathSpec := range []string{"a", "b", "c"} {
+		require.Nil(t, c.CreateTree(user, pathSpec, false))
+	}
+
+	// the listing is paginated by MaxListEntries.
+	list := func(cursor string) ([]string, string) {
+		stream, err := client.ListTree(ctx, &ListTreeRequest{PathSpec: "/", Cursor: cursor})
+		require.Nil(t, err)
+		var names []string
+		for {
+			oinfo, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err)
+			names = append(names, oinfo.PathSpec)
+		}
+		next := stream.Trailer()[NextCursorTrailer]
+		if len(next) == 0 {
+			return names, ""
+		}
+		return names, next[0]
+	}
+	names, next := list("")
+	require.Equal(t, []string{"/a", "/b"}, names)
+	require.NotEqual(t, "", next)
+	names, next = list(next)
+	require.Equal(t, []string{"/c"}, names)
+	require.Equal(t, "", next)
+
+	stream, err := client.ListTree(ctx, &ListTreeRequest{PathSpec: "notexists"})
+	require.Nil(t, err)
+	_, err = stream.Recv()
+	requireCode(t, grpccodes.NotFound, err)
+	stream, err = client.ListTree(ctx, &ListTreeRequest{PathSpec: "/", Limit: -1})
+	require.Nil(t, err)
+	_, err = stream.Recv()
+	requireCode(t, grpccodes.InvalidArgument, err)
+}
+
+func TestServer_withInvalidToken(t *testing.T) {
+	client, _, stop := newClient(t, memory.New())
+	defer stop()
+	_, err := client.Init(context.Background(), &InitRequest{})
+	requireCode(t, grpccodes.Unauthenticated, err)
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(AuthorizationMetadata, "bearer invalid"))
+	stream, err := client.ListTree(ctx, &ListTreeRequest{PathSpec: "/"})
+	require.Nil(t, err)
+	_, err = stream.Recv()
+	requireCode(t, grpccodes.Unauthenticated, err)
+}
@@ -2,11 +2,22 @@ package main
 
 import (
 	"flag"
+	"net"
+
 	"github.com/NYTimes/gizmo/config"
 	"github.com/NYTimes/gizmo/server"
+	"github.com/clawio/metadata/rpc"
 	"github.com/clawio/metadata/service"
+	"google.golang.org/grpc"
+
+	// metadata controller backends available through configuration.
+	_ "github.com/clawio/metadata/metadatacontroller/bolt"
+	_ "github.com/clawio/metadata/metadatacontroller/memory"
+	_ "github.com/clawio/metadata/metadatacontroller/sqlite"
 )
 
+var grpcAddr = flag.String("grpc", "", "address of the gRPC API, not served if empty")
+
 func main() {
 	flag.Parse()
 	var cfg *service.Config
@@ -23,7 +34,27 @@ func main() {
 		server.Log.Fatal("unable to register service: ", err)
 	}
 
+	var g *grpc.Server
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			server.Log.Fatal("unable to listen for gRPC: ", err)
+		}
+		g = rpc.NewGRPCServer(rpc.New(svc.MetaDataController, cfg.General))
+		go func() {
+			if err := g.Serve(lis); err != nil {
+				server.Log.Fatal("gRPC server encountered a fatal error: ", err)
+			}
+		}()
+	}
+
 	err = server.Run()
+	if g != nil {
+		g.GracefulStop()
+	}
+	if closeErr := svc.Close(); closeErr != nil {
+		server.Log.Error("unable to close service: ", closeErr)
+	}
 	if err != nil {
 		server.Log.Fatal("server encountered a fatal error: ", err)
 	}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+)
+
+const (
+	// MaxBatchOperations is the maximum number of operations of a batch.
+	MaxBatchOperations = 1000
+
+	// maxBatchBodySize is the maximum size of the
+	// JSON array with the operations of a batch.
+	maxBatchBodySize = 1 << 20
+)
+
+// BatchResult is the result of an operation of a batch.
+type BatchResult struct {
+	// Status is the HTTP status code the operation
+	// would have been answered with alone.
+	Status     int
+	ObjectInfo *entities.ObjectInfo `json:",omitempty"`
+	Error      *codes.Err           `json:",omitempty"`
+}
+
+// Batch applies the operations given as a JSON array in the body in order
+// and answers with the array of their results. Failed operations do not
+// stop the others unless the atomic query parameter is true: then every
+// operation is applied or none, and the operations not applied are
+// answered with http.StatusFailedDependency. Controllers without
+// transactions reject atomic batches with http.StatusNotImplemented.
+func (s *Service) Batch(w http.ResponseWriter, r *http.Request) {
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	var ops []*metadatacontroller.BatchOperation
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodySize)).Decode(&ops); err != nil {
+		s.handleBatchError(codes.NewErr(codes.BadInputData, "operations are not a JSON array"), w)
+		return
+	}
+	if len(ops) > MaxBatchOperations {
+		s.handleBatchError(codes.NewErr(codes.BadInputData, "too many operations"), w)
+		return
+	}
+	for _, op := range ops {
+		if op == nil {
+			s.handleBatchError(codes.NewErr(codes.BadInputData, "operations must be JSON objects"), w)
+			return
+		}
+	}
+
+	var results []*metadatacontroller.BatchResult
+	atomic := r.URL.Query().Get("atomic") == "true"
+	if atomic {
+		b, ok := s.batcher(w)
+		if !ok {
+			return
+		}
+		var err error
+		results, err = b.ApplyBatch(r.Context(), user, ops)
+		if err != nil {
+			s.handleBatchError(err, w)
+			return
+		}
+	} else {
+		c := s.contextController()
+		for _, op := range ops {
+			results = append(results, metadatacontroller.ApplyOperation(r.Context(), c, user, op))
+		}
+	}
+
+	rolledBack := atomic && metadatacontroller.BatchFailed(results)
+	res := make([]*BatchResult, len(ops))
+	for i := range ops {
+		if i >= len(results) || rolledBack && i != len(results)-1 {
+			res[i] = &BatchResult{Status: http.StatusFailedDependency}
+			continue
+		}
+		res[i] = newBatchResult(ops[i], results[i])
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.handleBatchError(err, w)
+		return
+	}
+}
+
+// batcher returns the metadata controller of the service as a Batcher.
+// If the controller cannot apply batches atomically, it answers the
+// request with http.StatusNotImplemented and returns false.
+func (s *Service) batcher(w http.ResponseWriter) (metadatacontroller.Batcher, bool) {
+	b, ok := s.MetaDataController.(metadatacontroller.Batcher)
+	if !ok {
+		notImplemented(w, "metadata controller cannot apply batches atomically")
+		return nil, false
+	}
+	return b, true
+}
+
+// newBatchResult returns the result of an operation, with the
+// status codes answered by the endpoint of the operation.
+func newBatchResult(op *metadatacontroller.BatchOperation, result *metadatacontroller.BatchResult) *BatchResult {
+	if result.Err == nil {
+		if op.Op == metadatacontroller.BatchCreateTree || op.Op == metadatacontroller.BatchCopy {
+			return &BatchResult{Status: http.StatusCreated}
+		}
+		return &BatchResult{Status: http.StatusOK, ObjectInfo: result.ObjectInfo}
+	}
+	if status := contextErrorStatus(result.Err); status != 0 {
+		return &BatchResult{Status: status}
+	}
+	if codeErr, ok := result.Err.(*codes.Err); ok {
+		switch codeErr.Code {
+		case codes.NotFound:
+			return &BatchResult{Status: http.StatusNotFound, Error: codeErr}
+		case codes.BadInputData:
+			return &BatchResult{Status: http.StatusBadRequest, Error: codeErr}
+		case metadatacontroller.AlreadyExists:
+			return &BatchResult{Status: http.StatusConflict, Error: codeErr}
+		case metadatacontroller.QuotaExceeded:
+			return &BatchResult{Status: http.StatusInsufficientStorage, Error: codeErr}
+		case metadatacontroller.PreconditionFailed:
+			return &BatchResult{Status: http.StatusPreconditionFailed, Error: codeErr}
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": result.Err,
+	}).Error("error applying batch operation")
+	return &BatchResult{Status: http.StatusInternalServerError}
+}
+
+func (s *Service) handleBatchError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("bad batch request")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error applying batch")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
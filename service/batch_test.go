@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) batch(query, body string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest("POST", batchURL+query, strings.NewReader(body))
+	require.Nil(suite.T(), err)
+	setToken(r)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	return w
+}
+
+func (suite *TestSuite) batchResults(w *httptest.ResponseRecorder) []*BatchResult {
+	require.Equal(suite.T(), http.StatusOK, w.Code, w.Body.String())
+	results := []*BatchResult{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(&results))
+	return results
+}
+
+func (suite *TestSuite) TestBatch() {
+	c := memory.New()
+	require.Nil(suite.T(), c.Init(user))
+	require.Nil(suite.T(), c.(metadatacontroller.BLOBPutter).PutBLOB(user, "myblob", 3, ""))
+	suite.Service.MetaDataController = c
+	w := suite.batch("", `[
+		{"Op": "createtree", "PathSpec": "mytree"},
+		{"Op": "move", "PathSpec": "myblob", "TargetPathSpec": "mytree/myblob"},
+		{"Op": "delete", "PathSpec": "notexists"},
+		{"Op": "copy", "PathSpec": "mytree", "TargetPathSpec": "othertree"},
+		{"Op": "examine", "PathSpec": "othertree/myblob"},
+		{"Op": "rename"}
+	]`)
+	results := suite.batchResults(w)
+	require.Equal(suite.T(), 6, len(results))
+	for i, status := range []int{http.StatusCreated, http.StatusOK, http.StatusNotFound, http.StatusCreated, http.StatusOK, http.StatusBadRequest} {
+		require.Equal(suite.T(), status, results[i].Status, "operation %d", i)
+	}
+	require.Equal(suite.T(), codes.NotFound, results[2].Error.Code)
+	require.Equal(suite.T(), int64(3), results[4].ObjectInfo.Size)
+}
+
+func (suite *TestSuite) TestBatch_atomic() {
+	suite.MockMetaDataController.On("ApplyBatch").Once().Return([]*metadatacontroller.BatchResult{
+		{ObjectInfo: &entities.ObjectInfo{PathSpec: "myblob"}},
+		{Err: codes.NewErr(metadatacontroller.AlreadyExists, "")},
+	}, nil)
+	w := suite.batch("?atomic=true", `[
+		{"Op": "examine", "PathSpec": "myblob"},
+		{"Op": "createtree", "PathSpec": "mytree"},
+		{"Op": "delete", "PathSpec": "myblob"}
+	]`)
+	results := suite.batchResults(w)
+	require.Equal(suite.T(), 3, len(results))
+	require.Equal(suite.T(), http.StatusFailedDependency, results[0].Status)
+	require.Nil(suite.T(), results[0].ObjectInfo)
+	require.Equal(suite.T(), http.StatusConflict, results[1].Status)
+	require.Equal(suite.T(), http.StatusFailedDependency, results[2].Status)
+}
+
+func (suite *TestSuite) TestBatch_atomicNotSupported() {
+	c := memory.New()
+	require.Nil(suite.T(), c.Init(user))
+	suite.Service.MetaDataController = metadatacontroller.WithJournal(c, metadatacontroller.NewMemoryJournal(10), nil)
+	w := suite.batch("?atomic=true", `[{"Op": "createtree", "PathSpec": "mytree"}]`)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+	_, err := c.ExamineObject(user, "mytree")
+	require.NotNil(suite.T(), err)
+}
+
+func (suite *TestSuite) TestBatch_withError() {
+	suite.MockMetaDataController.On("ApplyBatch").Once().Return([]*metadatacontroller.BatchResult(nil), codes.NewErr(99, ""))
+	w := suite.batch("?atomic=true", `[{"Op": "delete", "PathSpec": "myblob"}]`)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestBatch_withBadInput() {
+	require.Equal(suite.T(), http.StatusBadRequest, suite.batch("", `{"Op": "delete"}`).Code)
+	require.Equal(suite.T(), http.StatusBadRequest, suite.batch("", `[null]`).Code)
+	ops := make([]string, MaxBatchOperations+1)
+	for i := range ops {
+		ops[i] = `{"Op": "examine"}`
+	}
+	require.Equal(suite.T(), http.StatusBadRequest, suite.batch("", "["+strings.Join(ops, ",")+"]").Code)
+}
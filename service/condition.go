@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/clawio/metadata/metadatacontroller"
+)
+
+// getCondition returns the condition of the If-Match and If-None-Match
+// headers of r, or nil if it has none.
+func getCondition(r *http.Request) *metadatacontroller.Condition {
+	ifMatch := parseETags(r.Header.Get("If-Match"), false)
+	ifNoneMatch := parseETags(r.Header.Get("If-None-Match"), true)
+	if len(ifMatch) == 0 && len(ifNoneMatch) == 0 {
+		return nil
+	}
+	return &metadatacontroller.Condition{IfMatch: ifMatch, IfNoneMatch: ifNoneMatch}
+}
+
+// parseETags returns the ETags of a comma separated list of entity tags.
+// Weak tags only match when weak is true, as the ETags of the controllers
+// are strong.
+func parseETags(header string, weak bool) []string {
+	var etags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if tag == metadatacontroller.AnyETag {
+			etags = append(etags, tag)
+			continue
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		etags = append(etags, strings.Trim(tag, `"`))
+	}
+	if len(etags) == 0 && strings.TrimSpace(header) != "" {
+		// none of the tags can match.
+		etags = []string{""}
+	}
+	return etags
+}
+
+// conditionalController returns the metadata controller of the service as a
+// ConditionalController. If the controller cannot check conditions, it answers
+// the request with http.StatusNotImplemented and returns false.
+func (s *Service) conditionalController(w http.ResponseWriter) (metadatacontroller.ConditionalController, bool) {
+	cc, ok := s.asConditionalController()
+	if !ok {
+		notImplemented(w, "metadata controller cannot check conditions")
+	}
+	return cc, ok
+}
+
+// asConditionalController returns the metadata controller of the service
+// as a ConditionalController, or false if it cannot check conditions.
+func (s *Service) asConditionalController() (metadatacontroller.ConditionalController, bool) {
+	cc, ok := s.MetaDataController.(metadatacontroller.ConditionalController)
+	return cc, ok
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestGetCondition() {
+	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
+	require.Nil(suite.T(), err)
+	require.Nil(suite.T(), getCondition(r))
+
+	r.Header.Set("If-Match", `"a", W/"b", *`)
+	r.Header.Set("If-None-Match", `W/"c", "d"`)
+	require.Equal(suite.T(), &metadatacontroller.Condition{
+		IfMatch:     []string{"a", "*"},
+		IfNoneMatch: []string{"c", "d"},
+	}, getCondition(r))
+
+	// weak tags never match If-Match.
+	r.Header.Del("If-None-Match")
+	r.Header.Set("If-Match", `W/"a"`)
+	require.Equal(suite.T(), &metadatacontroller.Condition{IfMatch: []string{""}}, getCondition(r))
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// CopyObject copies an object to the target path.
+func (s *Service) CopyObject(w http.ResponseWriter, r *http.Request) {
+	sourcePath := mux.Vars(r)["path"]
+	targetPath := r.URL.Query().Get("target")
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	err := s.contextController().CopyObjectContext(r.Context(), user, sourcePath, targetPath)
+	if err != nil {
+		s.handleCopyObjectError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Service) handleCopyObjectError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("object not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object cannot be copied")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.QuotaExceeded {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota exceeded")
+			w.WriteHeader(http.StatusInsufficientStorage)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error copying object")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestCopy() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("CopyObject").Once().Return(nil)
+	r, err := http.NewRequest("POST", copyURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	values := r.URL.Query()
+	values.Set("target", "otherblob")
+	r.URL.RawQuery = values.Encode()
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+}
+func (suite *TestSuite) TestCopy_withNotFoundError() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("CopyObject").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("POST", copyURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+func (suite *TestSuite) TestCopy_withBadInputError() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("CopyObject").Once().Return(codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("POST", copyURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+func (suite *TestSuite) TestCopy_withQuotaExceededError() {
+	suite.MockMetaDataController.On("CopyObject").Once().Return(codes.NewErr(metadatacontroller.QuotaExceeded, ""))
+	r, err := http.NewRequest("POST", copyURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInsufficientStorage, w.Code)
+}
+func (suite *TestSuite) TestCopy_withError() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("CopyObject").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("POST", copyURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
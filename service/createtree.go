@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// CreateTree creates a tree object.
+func (s *Service) CreateTree(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+	recursive := r.URL.Query().Get("recursive") == "true"
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	err := s.contextController().CreateTreeContext(r.Context(), user, path, recursive)
+	if err != nil {
+		s.handleCreateTreeError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Service) handleCreateTreeError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("parent tree not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == metadatacontroller.AlreadyExists {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object already exists")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("tree cannot be created")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.QuotaExceeded {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota exceeded")
+			w.WriteHeader(http.StatusInsufficientStorage)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error creating tree")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestCreateTree() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(nil)
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_recursive() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(nil)
+	r, err := http.NewRequest("POST", createTreeURL+"mytree/othertree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	values := r.URL.Query()
+	values.Set("recursive", "true")
+	r.URL.RawQuery = values.Encode()
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_withNotFoundError() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_withAlreadyExistsError() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(codes.NewErr(metadatacontroller.AlreadyExists, ""))
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_withBadInputError() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_withQuotaExceededError() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(codes.NewErr(metadatacontroller.QuotaExceeded, ""))
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInsufficientStorage, w.Code)
+}
+func (suite *TestSuite) TestCreateTree_withError() {
+	suite.MockMetaDataController.On("CreateTree").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("POST", createTreeURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
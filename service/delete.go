@@ -1,12 +1,15 @@
 package service
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/NYTimes/gizmo/server"
 	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
@@ -15,7 +18,16 @@ import (
 func (s *Service) DeleteObject(w http.ResponseWriter, r *http.Request) {
 	path := mux.Vars(r)["path"]
 	user := context.Get(r, keys.UserKey).(*entities.User)
-	err := s.MetaDataController.DeleteObject(user, path)
+	var err error
+	if cond := getCondition(r); cond != nil {
+		cc, ok := s.conditionalController(w)
+		if !ok {
+			return
+		}
+		err = cc.DeleteObjectIf(r.Context(), user, path, cond)
+	} else {
+		err = s.contextController().DeleteObjectContext(r.Context(), user, path)
+	}
 	if err != nil {
 		s.handleDeleteObjectError(err, w)
 		return
@@ -23,6 +35,31 @@ func (s *Service) DeleteObject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleDeleteObjectError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object cannot be deleted")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.PreconditionFailed {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+	}
 	server.Log.WithFields(logrus.Fields{
 		"error": err,
 	}).Error("error deleting object")
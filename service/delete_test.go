@@ -1,10 +1,12 @@
 package service
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,6 +19,24 @@ func (suite *TestSuite) TestDelete() {
 	suite.Server.ServeHTTP(w, r)
 	require.Equal(suite.T(), http.StatusOK, w.Code)
 }
+func (suite *TestSuite) TestDelete_withNotFoundError() {
+	suite.MockMetaDataController.On("DeleteObject").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("DELETE", deleteURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+func (suite *TestSuite) TestDelete_withBadInputError() {
+	suite.MockMetaDataController.On("DeleteObject").Once().Return(codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("DELETE", deleteURL+"", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
 func (suite *TestSuite) TestDelete_withError() {
 	suite.MockMetaDataController.On("DeleteObject").Once().Return(codes.NewErr(99, ""))
 	r, err := http.NewRequest("DELETE", deleteURL+"myblob", nil)
@@ -26,3 +46,38 @@ func (suite *TestSuite) TestDelete_withError() {
 	suite.Server.ServeHTTP(w, r)
 	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 }
+
+func (suite *TestSuite) TestDelete_withTimedOutContext() {
+	r, err := http.NewRequest("DELETE", deleteURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	ctx, cancel := context.WithTimeout(r.Context(), 0)
+	defer cancel()
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r.WithContext(ctx))
+	require.Equal(suite.T(), http.StatusServiceUnavailable, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "DeleteObject")
+}
+
+func (suite *TestSuite) TestDelete_withIfMatch() {
+	suite.MockMetaDataController.On("DeleteObjectIf").Once().Return(nil)
+	r, err := http.NewRequest("DELETE", deleteURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "DeleteObject")
+}
+
+func (suite *TestSuite) TestDelete_withPreconditionFailed() {
+	suite.MockMetaDataController.On("DeleteObjectIf").Once().Return(codes.NewErr(metadatacontroller.PreconditionFailed, ""))
+	r, err := http.NewRequest("DELETE", deleteURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestDeleteVersion() {
+	suite.MockMetaDataController.On("DeleteVersion").Once().Return(nil)
+	r, err := http.NewRequest("DELETE", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNoContent, w.Code)
+}
+
+func (suite *TestSuite) TestDeleteVersion_withNotFoundError() {
+	suite.MockMetaDataController.On("DeleteVersion").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("DELETE", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestDeleteVersion_withError() {
+	suite.MockMetaDataController.On("DeleteVersion").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("DELETE", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+)
+
+const (
+	// EventStreamContentType is the media type of Server-Sent Events.
+	EventStreamContentType = "text/event-stream"
+
+	// ResyncEvent is the event sent when the changes after the
+	// Last-Event-ID of the client are no longer kept, so the client
+	// has to read the namespace again.
+	ResyncEvent = "resync"
+
+	// eventsHeartbeat is the interval of the comments sent to keep
+	// idle event streams open through proxies.
+	eventsHeartbeat = 30 * time.Second
+
+	// eventsPageSize is the number of missed changes read at a time
+	// for clients resuming with Last-Event-ID.
+	eventsPageSize = 100
+)
+
+// GetEvents streams the changes of the namespace of the user as
+// Server-Sent Events, one event per change named after its operation,
+// with the sequence number of the change as id and the change as data.
+// Clients resuming with the Last-Event-ID header receive first the
+// changes they missed, or a ResyncEvent if they are no longer kept.
+func (s *Service) GetEvents(w http.ResponseWriter, r *http.Request) {
+	cc, ok := s.changesController(w)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.handleGetEventsError(fmt.Errorf("%T cannot flush", w), w)
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+
+	// the subscription starts before the missed changes are read,
+	// so no change is lost in between.
+	sub := cc.SubscribeChanges(user)
+	defer sub.Close()
+	var last int64
+	var missed []*metadatacontroller.Change
+	resync := false
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		seq, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || seq < 0 {
+			s.handleGetEventsError(codes.NewErr(codes.BadInputData, "Last-Event-ID must be a non-negative number"), w)
+			return
+		}
+		missed, err = cc.Changes(user, seq, eventsPageSize)
+		if codeErr, ok := err.(*codes.Err); ok && codeErr.Code == metadatacontroller.ChangesExpired {
+			resync = true
+		} else if err != nil {
+			s.handleGetEventsError(err, w)
+			return
+		}
+		last = seq
+	}
+
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if resync {
+		if err := writeEvent(w, "", ResyncEvent, struct{}{}); err != nil {
+			return
+		}
+	}
+	for len(missed) > 0 {
+		for _, change := range missed {
+			if err := writeChangeEvent(w, change); err != nil {
+				return
+			}
+			last = change.Seq
+		}
+		flusher.Flush()
+		if len(missed) < eventsPageSize {
+			break
+		}
+		var err error
+		if missed, err = cc.Changes(user, last, eventsPageSize); err != nil {
+			// the client resumes from the last event received.
+			server.Log.WithFields(logrus.Fields{
+				"user":  user.Username,
+				"error": err,
+			}).Warn("missed changes not read")
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change, ok := <-sub.C:
+			if !ok {
+				// the client fell behind, it resumes
+				// from the last event received.
+				server.Log.WithFields(logrus.Fields{
+					"user": user.Username,
+				}).Warn("event subscriber dropped")
+				return
+			}
+			if change.Seq <= last {
+				continue
+			}
+			if err := writeChangeEvent(w, change); err != nil {
+				return
+			}
+			last = change.Seq
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeChangeEvent(w http.ResponseWriter, change *metadatacontroller.Change) error {
+	return writeEvent(w, strconv.FormatInt(change.Seq, 10), string(change.Op), change)
+}
+
+func writeEvent(w http.ResponseWriter, id, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func (s *Service) handleGetEventsError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("events cannot be streamed")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error streaming events")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	id, name string
+	change   *metadatacontroller.Change
+}
+
+// readEvent reads the next event from a stream, skipping comments.
+func readEvent(reader *bufio.Reader) (*event, error) {
+	e := &event{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.name != "":
+			return e, nil
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.change = &metadatacontroller.Change{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), e.change); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// setJournaledController sets a journaled memory controller with the
+// user home tree to the service and returns the function removing it.
+func (suite *TestSuite) setJournaledController() func() {
+	dir, err := ioutil.TempDir("", "clawio-service-journal-")
+	require.Nil(suite.T(), err)
+	c := memory.New()
+	require.Nil(suite.T(), c.Init(user))
+	suite.Service.MetaDataController = metadatacontroller.WithJournal(c, metadatacontroller.NewFileJournal(dir, 0), nil)
+	return func() { os.RemoveAll(dir) }
+}
+
+// getEvents requests the events and returns the response and the function
+// closing it with the server, which waits for the handler to return.
+func (suite *TestSuite) getEvents(lastEventID string) (*http.Response, func()) {
+	ts := httptest.NewServer(suite.Server)
+	r, err := http.NewRequest("GET", ts.URL+eventsURL, nil)
+	require.Nil(suite.T(), err)
+	setToken(r)
+	if lastEventID != "" {
+		r.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(r)
+	require.Nil(suite.T(), err)
+	return res, func() {
+		res.Body.Close()
+		ts.Close()
+	}
+}
+
+func (suite *TestSuite) TestGetEvents() {
+	defer suite.setJournaledController()()
+	c := suite.Service.MetaDataController
+	require.Nil(suite.T(), c.CreateTree(user, "mytree", false))
+	require.Nil(suite.T(), c.CreateTree(user, "othertree", false))
+
+	res, closeEvents := suite.getEvents("1")
+	defer closeEvents()
+	require.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	require.Equal(suite.T(), EventStreamContentType, res.Header.Get("Content-Type"))
+	reader := bufio.NewReader(res.Body)
+
+	// the missed change is sent first.
+	e, err := readEvent(reader)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "2", e.id)
+	require.Equal(suite.T(), "create", e.name)
+	require.Equal(suite.T(), "othertree", e.change.PathSpec)
+	require.NotEqual(suite.T(), "", e.change.ETag)
+
+	require.Nil(suite.T(), c.MoveObject(user, "mytree", "movedtree"))
+	e, err = readEvent(reader)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "3", e.id)
+	require.Equal(suite.T(), "move", e.name)
+	require.Equal(suite.T(), "mytree", e.change.PathSpec)
+	require.Equal(suite.T(), "movedtree", e.change.TargetPathSpec)
+}
+
+func (suite *TestSuite) TestGetEvents_withManyMissedChanges() {
+	defer suite.setJournaledController()()
+	c := suite.Service.MetaDataController
+	for i := 0; i < eventsPageSize*2+1; i++ {
+		require.Nil(suite.T(), c.SetProperties(user, "/", map[string]string{"color": "red"}))
+	}
+
+	// the missed changes are read a page at a time.
+	res, closeEvents := suite.getEvents("0")
+	defer closeEvents()
+	reader := bufio.NewReader(res.Body)
+	for i := 1; i <= eventsPageSize*2+1; i++ {
+		e, err := readEvent(reader)
+		require.Nil(suite.T(), err)
+		require.Equal(suite.T(), strconv.Itoa(i), e.id)
+	}
+}
+
+func (suite *TestSuite) TestGetEvents_withExpiredLastEventID() {
+	defer suite.setJournaledController()()
+	res, closeEvents := suite.getEvents("10")
+	defer closeEvents()
+	require.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	e, err := readEvent(bufio.NewReader(res.Body))
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), ResyncEvent, e.name)
+}
+
+func (suite *TestSuite) TestGetEvents_withBadLastEventID() {
+	defer suite.setJournaledController()()
+	res, closeEvents := suite.getEvents("last")
+	defer closeEvents()
+	require.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+}
+
+func (suite *TestSuite) TestGetEvents_withoutJournal() {
+	suite.Service.MetaDataController = memory.New()
+	res, closeEvents := suite.getEvents("")
+	defer closeEvents()
+	require.Equal(suite.T(), http.StatusNotImplemented, res.StatusCode)
+}
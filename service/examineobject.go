@@ -9,6 +9,7 @@ import (
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
@@ -17,11 +18,24 @@ import (
 func (s *Service) ExamineObject(w http.ResponseWriter, r *http.Request) {
 	path := mux.Vars(r)["path"]
 	user := context.Get(r, keys.UserKey).(*entities.User)
-	oinfo, err := s.MetaDataController.ExamineObject(user, path)
+	var oinfo *entities.ObjectInfo
+	var err error
+	if cond := getCondition(r); cond != nil {
+		cc, ok := s.conditionalController(w)
+		if !ok {
+			return
+		}
+		oinfo, err = cc.ExamineObjectIf(r.Context(), user, path, cond)
+	} else {
+		oinfo, err = s.contextController().ExamineObjectContext(r.Context(), user, path)
+	}
 	if err != nil {
 		s.handleExamineObjectError(err, w)
 		return
 	}
+	if etag := metadatacontroller.GetETag(oinfo); etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
 	if err := json.NewEncoder(w).Encode(oinfo); err != nil {
 		s.handleExamineObjectError(err, w)
 		return
@@ -29,6 +43,9 @@ func (s *Service) ExamineObject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleExamineObjectError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
 	if codeErr, ok := err.(*codes.Err); ok {
 		if codeErr.Code == codes.NotFound {
 			server.Log.WithFields(logrus.Fields{
@@ -36,6 +53,15 @@ func (s *Service) handleExamineObjectError(err error, w http.ResponseWriter) {
 			}).Error("object not found")
 			w.WriteHeader(http.StatusNotFound)
 			return
+		} else if codeErr.Code == metadatacontroller.NotModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		} else if codeErr.Code == metadatacontroller.PreconditionFailed {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
 		}
 	}
 	server.Log.WithFields(logrus.Fields{
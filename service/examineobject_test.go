@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +21,19 @@ func (suite *TestSuite) TestExamine() {
 	require.Equal(suite.T(), http.StatusOK, w.Code)
 }
 
+func (suite *TestSuite) TestExamine_withETag() {
+	oinfo := &entities.ObjectInfo{}
+	metadatacontroller.SetETag(oinfo, "abc")
+	suite.MockMetaDataController.On("ExamineObject").Once().Return(oinfo, nil)
+	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	require.Equal(suite.T(), `"abc"`, w.Header().Get("ETag"))
+}
+
 func (suite *TestSuite) TestExamine_withObjectNotFound() {
 	suite.MockMetaDataController.On("ExamineObject").Once().Return(&entities.ObjectInfo{}, codes.NewErr(codes.NotFound, ""))
 	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
@@ -38,3 +53,37 @@ func (suite *TestSuite) TestExamine_withError() {
 	suite.Server.ServeHTTP(w, r)
 	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 }
+
+func (suite *TestSuite) TestExamine_withCancelledContext() {
+	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r.WithContext(ctx))
+	require.Equal(suite.T(), StatusClientClosedRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "ExamineObject")
+}
+
+func (suite *TestSuite) TestExamine_withNotModified() {
+	suite.MockMetaDataController.On("ExamineObjectIf").Once().Return(&entities.ObjectInfo{}, codes.NewErr(metadatacontroller.NotModified, ""))
+	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-None-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotModified, w.Code)
+}
+
+func (suite *TestSuite) TestExamine_withPreconditionFailed() {
+	suite.MockMetaDataController.On("ExamineObjectIf").Once().Return(&entities.ObjectInfo{}, codes.NewErr(metadatacontroller.PreconditionFailed, ""))
+	r, err := http.NewRequest("GET", examineURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+}
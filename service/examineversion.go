@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// ExamineVersion retrieves the information about the version
+// of a BLOB given by the version query parameter.
+func (s *Service) ExamineVersion(w http.ResponseWriter, r *http.Request) {
+	vc, ok := s.versionController(w)
+	if !ok {
+		return
+	}
+	path := mux.Vars(r)["path"]
+	id := r.URL.Query().Get("version")
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	version, err := vc.ExamineVersion(user, path, id)
+	if err != nil {
+		s.handleExamineVersionError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(version); err != nil {
+		s.handleExamineVersionError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleExamineVersionError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("version not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("version cannot be examined")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("versioning is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error examining version")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+var version = &metadatacontroller.Version{ID: "123"}
+
+func (suite *TestSuite) TestExamineVersion() {
+	suite.MockMetaDataController.On("ExamineVersion").Once().Return(version, nil)
+	r, err := http.NewRequest("GET", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "ListVersions")
+}
+
+func (suite *TestSuite) TestExamineVersion_withNotFoundError() {
+	suite.MockMetaDataController.On("ExamineVersion").Once().Return(version, codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("GET", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestExamineVersion_withError() {
+	suite.MockMetaDataController.On("ExamineVersion").Once().Return(version, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+)
+
+// DefaultJournalMaxCount is the number of changes kept per
+// user when JournalMaxCount is not set.
+const DefaultJournalMaxCount = 10000
+
+// GetChanges retrieves, oldest first, the changes of the namespace of the
+// user with a sequence number greater than the since query parameter, 0 if
+// absent. The limit parameter caps the changes returned like in listings,
+// clients ask for the next ones using the sequence number of the last one.
+// If the changes after since are no longer kept, it answers with
+// http.StatusGone and the client has to read the namespace again.
+func (s *Service) GetChanges(w http.ResponseWriter, r *http.Request) {
+	cc, ok := s.changesController(w)
+	if !ok {
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	since, limit, err := s.getChangesRange(r)
+	if err != nil {
+		s.handleGetChangesError(err, w)
+		return
+	}
+	changes, err := cc.Changes(user, since, limit)
+	if err != nil {
+		s.handleGetChangesError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		s.handleGetChangesError(err, w)
+		return
+	}
+}
+
+func (s *Service) getChangesRange(r *http.Request) (int64, int, error) {
+	query := r.URL.Query()
+	var since int64
+	if v := query.Get("since"); v != "" {
+		seq, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seq < 0 {
+			return 0, 0, codes.NewErr(codes.BadInputData, "since must be a non-negative number")
+		}
+		since = seq
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			return 0, 0, codes.NewErr(codes.BadInputData, "limit must be a non-negative number")
+		}
+		limit = l
+	}
+	maxEntries := s.Config.General.MaxListEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxListEntries
+	}
+	if limit == 0 || limit > maxEntries {
+		limit = maxEntries
+	}
+	return since, limit, nil
+}
+
+func (s *Service) handleGetChangesError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("changes cannot be retrieved")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.ChangesExpired {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("changes expired")
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error getting changes")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
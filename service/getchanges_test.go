@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var changes = []*metadatacontroller.Change{
+	{Seq: 3, Op: metadatacontroller.ChangeMove, PathSpec: "myblob", TargetPathSpec: "otherblob", ETag: "1"},
+}
+
+func (suite *TestSuite) TestGetChanges() {
+	suite.MockMetaDataController.On("Changes").Once().Return(changes, nil)
+	r, err := http.NewRequest("GET", changesURL+"?since=2&limit=1", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	got := []*metadatacontroller.Change{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(suite.T(), changes, got)
+}
+
+func (suite *TestSuite) TestGetChanges_withBadSince() {
+	r, err := http.NewRequest("GET", changesURL+"?since=-1", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestGetChanges_withError() {
+	suite.MockMetaDataController.On("Changes").Once().Return(changes, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", changesURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestGetChanges_withExpiredError() {
+	suite.MockMetaDataController.On("Changes").Once().Return(changes, codes.NewErr(metadatacontroller.ChangesExpired, ""))
+	r, err := http.NewRequest("GET", changesURL+"?since=100", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusGone, w.Code)
+}
+
+func (suite *TestSuite) TestGetChanges_withoutJournal() {
+	suite.Service.MetaDataController = memory.New()
+	r, err := http.NewRequest("GET", changesURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
+
+func (suite *TestSuite) TestGetChanges_withJournal() {
+	defer suite.setJournaledController()()
+	require.Nil(suite.T(), suite.Service.MetaDataController.CreateTree(user, "mytree", false))
+	require.Nil(suite.T(), suite.Service.MetaDataController.CreateTree(user, "othertree", false))
+
+	r, err := http.NewRequest("GET", changesURL+"?since=1", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	got := []*metadatacontroller.Change{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(suite.T(), 1, len(got))
+	require.Equal(suite.T(), int64(2), got[0].Seq)
+	require.Equal(suite.T(), "othertree", got[0].PathSpec)
+	require.NotEqual(suite.T(), "", got[0].ETag)
+
+	// the memory controller has no trash even when journaled.
+	r, err = http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w = httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// GetProperties retrieves the properties of an object as a JSON object.
+func (s *Service) GetProperties(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	props, err := s.MetaDataController.GetProperties(user, path)
+	if err != nil {
+		s.handleGetPropertiesError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(props); err != nil {
+		s.handleGetPropertiesError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleGetPropertiesError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok && codeErr.Code == codes.NotFound {
+		server.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("object not found")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error getting properties")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+var props = map[string]string{"tag": "red"}
+
+func (suite *TestSuite) TestGetProperties() {
+	suite.MockMetaDataController.On("GetProperties").Once().Return(props, nil)
+	r, err := http.NewRequest("GET", propertiesURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	got := map[string]string{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(suite.T(), props, got)
+}
+
+func (suite *TestSuite) TestGetProperties_withNotFoundError() {
+	suite.MockMetaDataController.On("GetProperties").Once().Return(props, codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("GET", propertiesURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestGetProperties_withError() {
+	suite.MockMetaDataController.On("GetProperties").Once().Return(props, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", propertiesURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
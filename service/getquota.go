@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+)
+
+// GetQuota retrieves the usage and the quota limit of the user.
+func (s *Service) GetQuota(w http.ResponseWriter, r *http.Request) {
+	qc, ok := s.quotaController(w)
+	if !ok {
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	quota, err := qc.GetQuota(user)
+	if err != nil {
+		s.handleGetQuotaError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(quota); err != nil {
+		s.handleGetQuotaError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleGetQuotaError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("user home tree not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota cannot be retrieved")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error getting quota")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
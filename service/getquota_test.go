@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var quota = &metadatacontroller.Quota{
+	Used:  metadatacontroller.Usage{Bytes: 10, Objects: 2},
+	Limit: metadatacontroller.QuotaLimit{Bytes: 100},
+}
+
+func (suite *TestSuite) TestGetQuota() {
+	suite.MockMetaDataController.On("GetQuota").Once().Return(quota, nil)
+	r, err := http.NewRequest("GET", quotaURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	got := &metadatacontroller.Quota{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(got))
+	require.Equal(suite.T(), quota, got)
+}
+
+func (suite *TestSuite) TestGetQuota_withBadInputError() {
+	suite.MockMetaDataController.On("GetQuota").Once().Return(quota, codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("GET", quotaURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestGetQuota_withNotSupportedError() {
+	suite.MockMetaDataController.On("GetQuota").Once().Return(quota, codes.NewErr(metadatacontroller.NotSupported, ""))
+	r, err := http.NewRequest("GET", quotaURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
+
+func (suite *TestSuite) TestGetQuota_withError() {
+	suite.MockMetaDataController.On("GetQuota").Once().Return(quota, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", quotaURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestGetQuota_withoutQuota() {
+	suite.Service.MetaDataController = memory.New()
+	r, err := http.NewRequest("GET", quotaURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
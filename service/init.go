@@ -13,7 +13,7 @@ import (
 // Init retrieves the information about an object.
 func (s *Service) Init(w http.ResponseWriter, r *http.Request) {
 	user := context.Get(r, keys.UserKey).(*entities.User)
-	err := s.MetaDataController.Init(user)
+	err := s.contextController().InitContext(r.Context(), user)
 	if err != nil {
 		s.handleInitError(err, w)
 		return
@@ -21,6 +21,9 @@ func (s *Service) Init(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleInitError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
 	server.Log.WithFields(logrus.Fields{
 		"error": err,
 	}).Error("error creating user home tree")
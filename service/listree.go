@@ -2,33 +2,181 @@ package service
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/NYTimes/gizmo/server"
 	"github.com/Sirupsen/logrus"
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
-// ListTree retrieves the information about an object.
+const (
+	// NextCursorHeader is the response header carrying the cursor
+	// of the next page of a listing. It is absent on the last page.
+	NextCursorHeader = "X-Next-Cursor"
+
+	// DefaultMaxListEntries is the maximum number of entries
+	// returned by a single listing when not configured.
+	DefaultMaxListEntries = 10000
+
+	// ListErrorTrailer is the trailer set when a streamed listing
+	// fails after the first entry has been sent.
+	ListErrorTrailer = "X-List-Error"
+
+	// NDJSONContentType is the media type of listings streamed
+	// as one JSON encoded entry per line.
+	NDJSONContentType = "application/x-ndjson"
+)
+
+// ListTree retrieves the information about the descendants of a tree.
+// The limit, cursor and sort query parameters select the page returned
+// and the depth parameter, a number or infinity, the levels listed.
+// Clients accepting NDJSONContentType receive the entries as they are
+// listed, with the next cursor sent as a trailer. The If-Match and
+// If-None-Match headers are checked on the tree.
 func (s *Service) ListTree(w http.ResponseWriter, r *http.Request) {
 	path := mux.Vars(r)["path"]
 	user := context.Get(r, keys.UserKey).(*entities.User)
-	oinfos, err := s.MetaDataController.ListTree(user, path)
+	opts, err := s.getListOptions(r)
+	if err != nil {
+		s.handleListTreeError(err, w)
+		return
+	}
+	cond := getCondition(r)
+	if cond == nil && acceptsNDJSON(r) {
+		s.streamTree(w, r, user, path, opts)
+		return
+	}
+	var oinfos []*entities.ObjectInfo
+	var next string
+	if cond != nil {
+		cc, ok := s.conditionalController(w)
+		if !ok {
+			return
+		}
+		oinfos, next, err = cc.ListTreeIf(r.Context(), user, path, opts, cond)
+	} else {
+		oinfos, next, err = s.contextController().ListTreeContext(r.Context(), user, path, opts)
+	}
 	if err != nil {
 		s.handleListTreeError(err, w)
 		return
 	}
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+	if acceptsNDJSON(r) {
+		// conditional listings are sent once the condition is checked.
+		w.Header().Set("Content-Type", NDJSONContentType)
+		enc := json.NewEncoder(w)
+		for _, oinfo := range oinfos {
+			if err := enc.Encode(oinfo); err != nil {
+				s.handleListTreeError(err, w)
+				return
+			}
+		}
+		return
+	}
 	if err := json.NewEncoder(w).Encode(oinfos); err != nil {
 		s.handleListTreeError(err, w)
 		return
 	}
 }
 
+func (s *Service) streamTree(w http.ResponseWriter, r *http.Request, user *entities.User, path string, opts *metadatacontroller.ListOptions) {
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	started := false
+	next, err := metadatacontroller.StreamTree(r.Context(), s.contextController(), user, path, opts, func(oinfo *entities.ObjectInfo) error {
+		if !started {
+			w.Header().Set("Content-Type", NDJSONContentType)
+			w.Header().Set("Trailer", NextCursorHeader+", "+ListErrorTrailer)
+			started = true
+		}
+		if err := enc.Encode(oinfo); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			s.handleListTreeError(err, w)
+			return
+		}
+		// the status has already been sent.
+		server.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("error streaming tree")
+		w.Header().Set(ListErrorTrailer, err.Error())
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", NDJSONContentType)
+	}
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+}
+
+// acceptsNDJSON reports whether the client accepts NDJSONContentType.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == NDJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) getListOptions(r *http.Request) (*metadatacontroller.ListOptions, error) {
+	query := r.URL.Query()
+	opts := &metadatacontroller.ListOptions{
+		Cursor: query.Get("cursor"),
+		Sort:   metadatacontroller.SortOrder(query.Get("sort")),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			return nil, codes.NewErr(codes.BadInputData, "limit must be a non-negative number")
+		}
+		opts.Limit = l
+	}
+	maxEntries := s.Config.General.MaxListEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxListEntries
+	}
+	if opts.Limit == 0 || opts.Limit > maxEntries {
+		opts.Limit = maxEntries
+	}
+	switch depth := query.Get("depth"); depth {
+	case "":
+	case "infinity":
+		opts.Depth = metadatacontroller.DepthInfinity
+	default:
+		d, err := strconv.Atoi(depth)
+		if err != nil || d < 1 {
+			return nil, codes.NewErr(codes.BadInputData, "depth must be a positive number or infinity")
+		}
+		opts.Depth = d
+	}
+	return opts, nil
+}
+
 func (s *Service) handleListTreeError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
 	if codeErr, ok := err.(*codes.Err); ok {
 		if codeErr.Code == codes.NotFound {
 			server.Log.WithFields(logrus.Fields{
@@ -37,10 +185,21 @@ func (s *Service) handleListTreeError(err error, w http.ResponseWriter) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		if codeErr.Code == metadatacontroller.NotModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if codeErr.Code == metadatacontroller.PreconditionFailed {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
 		if codeErr.Code == codes.BadInputData {
 			server.Log.WithFields(logrus.Fields{
 				"error": err,
-			}).Warn("object is not a tree")
+			}).Warn("bad list request")
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(err)
 			return
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/stretchr/testify/require"
 )
 
@@ -13,7 +15,7 @@ var oinfos = []*entities.ObjectInfo{}
 
 func (suite *TestSuite) TestListTree() {
 	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
-	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, nil)
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "", nil)
 	r, err := http.NewRequest("GET", listURL+"mytree", nil)
 	setToken(r)
 	require.Nil(suite.T(), err)
@@ -24,7 +26,7 @@ func (suite *TestSuite) TestListTree() {
 
 func (suite *TestSuite) TestListTree_withNotFoundError() {
 	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
-	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, codes.NewErr(codes.NotFound, ""))
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "", codes.NewErr(codes.NotFound, ""))
 	r, err := http.NewRequest("GET", listURL+"mytree", nil)
 	setToken(r)
 	require.Nil(suite.T(), err)
@@ -34,7 +36,7 @@ func (suite *TestSuite) TestListTree_withNotFoundError() {
 }
 func (suite *TestSuite) TestListTree_withBadInputError() {
 	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
-	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, codes.NewErr(codes.BadInputData, ""))
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "", codes.NewErr(codes.BadInputData, ""))
 	r, err := http.NewRequest("GET", listURL+"mytree", nil)
 	setToken(r)
 	require.Nil(suite.T(), err)
@@ -44,7 +46,7 @@ func (suite *TestSuite) TestListTree_withBadInputError() {
 }
 func (suite *TestSuite) TestListTree_withError() {
 	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
-	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, codes.NewErr(99, ""))
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "", codes.NewErr(99, ""))
 	r, err := http.NewRequest("GET", listURL+"mytree", nil)
 	setToken(r)
 	require.Nil(suite.T(), err)
@@ -52,3 +54,125 @@ func (suite *TestSuite) TestListTree_withError() {
 	suite.Server.ServeHTTP(w, r)
 	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 }
+
+func (suite *TestSuite) TestListTree_withNextCursor() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "next", nil)
+	r, err := http.NewRequest("GET", listURL+"mytree?limit=10&sort=size", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	require.Equal(suite.T(), "next", w.Header().Get(NextCursorHeader))
+}
+
+func (suite *TestSuite) TestListTree_withInvalidLimit() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	r, err := http.NewRequest("GET", listURL+"mytree?limit=-1", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "ListTree")
+}
+
+func (suite *TestSuite) TestListTree_withInvalidDepth() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	r, err := http.NewRequest("GET", listURL+"mytree?depth=0", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "ListTree")
+}
+
+func (suite *TestSuite) TestgetListOptions() {
+	r, err := http.NewRequest("GET", listURL+"mytree?depth=infinity&sort=mtime&cursor=abc", nil)
+	require.Nil(suite.T(), err)
+	opts, err := suite.Service.getListOptions(r)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), metadatacontroller.DepthInfinity, opts.Depth)
+	require.Equal(suite.T(), metadatacontroller.SortByModTime, opts.Sort)
+	require.Equal(suite.T(), "abc", opts.Cursor)
+	require.Equal(suite.T(), DefaultMaxListEntries, opts.Limit)
+}
+
+func (suite *TestSuite) TestgetListOptions_withMaxListEntries() {
+	suite.Service.Config.General.MaxListEntries = 5
+	defer func() { suite.Service.Config.General.MaxListEntries = 0 }()
+	r, err := http.NewRequest("GET", listURL+"mytree?limit=10&depth=3", nil)
+	require.Nil(suite.T(), err)
+	opts, err := suite.Service.getListOptions(r)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 5, opts.Limit)
+	require.Equal(suite.T(), 3, opts.Depth)
+}
+
+func (suite *TestSuite) TestListTree_withNDJSON() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	infos := []*entities.ObjectInfo{{PathSpec: "mytree/a"}, {PathSpec: "mytree/b"}}
+	suite.MockMetaDataController.On("ListTree").Once().Return(infos, "next", nil)
+	r, err := http.NewRequest("GET", listURL+"mytree", nil)
+	require.Nil(suite.T(), err)
+	r.Header.Set("Accept", "application/json, application/x-ndjson; q=0.9")
+	setToken(r)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	res := w.Result()
+	require.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	require.Equal(suite.T(), NDJSONContentType, res.Header.Get("Content-Type"))
+	require.Equal(suite.T(), "next", res.Trailer.Get(NextCursorHeader))
+	dec := json.NewDecoder(res.Body)
+	for _, info := range infos {
+		got := &entities.ObjectInfo{}
+		require.Nil(suite.T(), dec.Decode(got))
+		require.Equal(suite.T(), info.PathSpec, got.PathSpec)
+	}
+	require.False(suite.T(), dec.More())
+}
+
+func (suite *TestSuite) TestListTree_withNDJSONAndNotFoundError() {
+	suite.MockAuthService.On("Verify", "").Once().Return(user, &codes.Response{}, nil)
+	suite.MockMetaDataController.On("ListTree").Once().Return(oinfos, "", codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("GET", listURL+"mytree", nil)
+	require.Nil(suite.T(), err)
+	r.Header.Set("Accept", NDJSONContentType)
+	setToken(r)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestListTree_withNotModified() {
+	suite.MockMetaDataController.On("ListTreeIf").Once().Return([]*entities.ObjectInfo{}, "", codes.NewErr(metadatacontroller.NotModified, ""))
+	r, err := http.NewRequest("GET", listURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-None-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotModified, w.Code)
+}
+
+func (suite *TestSuite) TestListTree_withConditionAndNDJSON() {
+	oinfos := []*entities.ObjectInfo{{PathSpec: "mytree/a"}, {PathSpec: "mytree/b"}}
+	suite.MockMetaDataController.On("ListTreeIf").Once().Return(oinfos, "", nil)
+	r, err := http.NewRequest("GET", listURL+"mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-None-Match", `"abc"`)
+	r.Header.Set("Accept", NDJSONContentType)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	require.Equal(suite.T(), NDJSONContentType, w.Header().Get("Content-Type"))
+	dec := json.NewDecoder(w.Body)
+	for _, oinfo := range oinfos {
+		decoded := &entities.ObjectInfo{}
+		require.Nil(suite.T(), dec.Decode(decoded))
+		require.Equal(suite.T(), oinfo.PathSpec, decoded.PathSpec)
+	}
+}
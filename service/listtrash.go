@@ -0,0 +1,56 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+)
+
+// ListTrash retrieves the items in the trash of the user.
+func (s *Service) ListTrash(w http.ResponseWriter, r *http.Request) {
+	tc, ok := s.trashController(w)
+	if !ok {
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	items, err := tc.ListTrash(user)
+	if err != nil {
+		s.handleListTrashError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		s.handleListTrashError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleListTrashError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash cannot be listed")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error listing trash")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
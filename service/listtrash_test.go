@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var trashItems = []*metadatacontroller.TrashItem{}
+
+func (suite *TestSuite) TestListTrash() {
+	suite.MockMetaDataController.On("ListTrash").Once().Return(trashItems, nil)
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TestSuite) TestListTrash_withBadInputError() {
+	suite.MockMetaDataController.On("ListTrash").Once().Return(trashItems, codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestListTrash_withNotSupportedError() {
+	suite.MockMetaDataController.On("ListTrash").Once().Return(trashItems, codes.NewErr(metadatacontroller.NotSupported, ""))
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
+
+func (suite *TestSuite) TestListTrash_withError() {
+	suite.MockMetaDataController.On("ListTrash").Once().Return(trashItems, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestListTrash_withoutTrash() {
+	suite.Service.MetaDataController = memory.New()
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
+
+// plainWrapper wraps a controller without implementing
+// any of its optional interfaces.
+type plainWrapper struct {
+	metadatacontroller.MetaDataController
+}
+
+func (w plainWrapper) Unwrap() metadatacontroller.MetaDataController {
+	return w.MetaDataController
+}
+
+func (suite *TestSuite) TestListTrash_withWrapperWithoutTrash() {
+	suite.Service.MetaDataController = plainWrapper{suite.MockMetaDataController}
+	r, err := http.NewRequest("GET", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// ListVersions retrieves the versions of a BLOB, most recent first.
+// If the version query parameter is given, only that version is retrieved.
+func (s *Service) ListVersions(w http.ResponseWriter, r *http.Request) {
+	vc, ok := s.versionController(w)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("version") != "" {
+		s.ExamineVersion(w, r)
+		return
+	}
+	path := mux.Vars(r)["path"]
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	versions, err := vc.ListVersions(user, path)
+	if err != nil {
+		s.handleListVersionsError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		s.handleListVersionsError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleListVersionsError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("versions cannot be listed")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("versioning is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error listing versions")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
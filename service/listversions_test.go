@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var versions = []*metadatacontroller.Version{}
+
+func (suite *TestSuite) TestListVersions() {
+	suite.MockMetaDataController.On("ListVersions").Once().Return(versions, nil)
+	r, err := http.NewRequest("GET", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TestSuite) TestListVersions_withBadInputError() {
+	suite.MockMetaDataController.On("ListVersions").Once().Return(versions, codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("GET", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestListVersions_withNotSupportedError() {
+	suite.MockMetaDataController.On("ListVersions").Once().Return(versions, codes.NewErr(metadatacontroller.NotSupported, ""))
+	r, err := http.NewRequest("GET", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
+
+func (suite *TestSuite) TestListVersions_withError() {
+	suite.MockMetaDataController.On("ListVersions").Once().Return(versions, codes.NewErr(99, ""))
+	r, err := http.NewRequest("GET", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestListVersions_withoutVersions() {
+	suite.Service.MetaDataController = memory.New()
+	r, err := http.NewRequest("GET", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotImplemented, w.Code)
+}
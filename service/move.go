@@ -9,16 +9,27 @@ import (
 	"github.com/clawio/codes"
 	"github.com/clawio/entities"
 	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
 )
 
 // MoveObject retrieves the information about an object.
+// The If-Match and If-None-Match headers are checked on the source object.
 func (s *Service) MoveObject(w http.ResponseWriter, r *http.Request) {
 	sourcePath := mux.Vars(r)["path"]
 	targetPath := r.URL.Query().Get("target")
 	user := context.Get(r, keys.UserKey).(*entities.User)
-	err := s.MetaDataController.MoveObject(user, sourcePath, targetPath)
+	var err error
+	if cond := getCondition(r); cond != nil {
+		cc, ok := s.conditionalController(w)
+		if !ok {
+			return
+		}
+		err = cc.MoveObjectIf(r.Context(), user, sourcePath, targetPath, cond)
+	} else {
+		err = s.contextController().MoveObjectContext(r.Context(), user, sourcePath, targetPath)
+	}
 	if err != nil {
 		s.handleMoveObjectError(err, w)
 		return
@@ -26,6 +37,9 @@ func (s *Service) MoveObject(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleMoveObjectError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
 	if codeErr, ok := err.(*codes.Err); ok {
 		if codeErr.Code == codes.NotFound {
 			server.Log.WithFields(logrus.Fields{
@@ -40,6 +54,12 @@ func (s *Service) handleMoveObjectError(err error, w http.ResponseWriter) {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(err)
 			return
+		} else if codeErr.Code == metadatacontroller.PreconditionFailed {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
 		}
 	}
 	server.Log.WithFields(logrus.Fields{
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 
 	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,3 +52,15 @@ func (suite *TestSuite) TestMove_withError() {
 	suite.Server.ServeHTTP(w, r)
 	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
 }
+
+func (suite *TestSuite) TestMove_withPreconditionFailed() {
+	suite.MockMetaDataController.On("MoveObjectIf").Once().Return(codes.NewErr(metadatacontroller.PreconditionFailed, ""))
+	r, err := http.NewRequest("POST", moveURL+"myblob?target=otherblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	r.Header.Set("If-Match", `"abc"`)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "MoveObject")
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// PurgeResult is the response of PurgeTrash.
+type PurgeResult struct {
+	Purged int
+}
+
+// PurgeTrash removes for good the items in the trash deleted more than
+// the number of seconds given by the olderthan query parameter ago,
+// or all of them if it is not given.
+func (s *Service) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	tc, ok := s.trashController(w)
+	if !ok {
+		return
+	}
+	var olderThan int64
+	if param := r.URL.Query().Get("olderthan"); param != "" {
+		v, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || v < 0 {
+			s.handlePurgeTrashError(codes.NewErr(codes.BadInputData, "olderthan must be a non-negative number of seconds"), w)
+			return
+		}
+		olderThan = v
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	purged, err := tc.PurgeTrash(user, time.Now().Unix()-olderThan)
+	if err != nil {
+		s.handlePurgeTrashError(err, w)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(&PurgeResult{Purged: purged}); err != nil {
+		s.handlePurgeTrashError(err, w)
+		return
+	}
+}
+
+// PurgeTrashItem removes an item from the trash for good.
+func (s *Service) PurgeTrashItem(w http.ResponseWriter, r *http.Request) {
+	tc, ok := s.trashController(w)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	if err := tc.PurgeTrashItem(user, id); err != nil {
+		s.handlePurgeTrashError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handlePurgeTrashError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash item not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash cannot be purged")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error purging trash")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestPurgeTrash() {
+	suite.MockMetaDataController.On("PurgeTrash").Once().Return(2, nil)
+	r, err := http.NewRequest("DELETE", trashURL+"?olderthan=3600", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	res := &PurgeResult{}
+	require.Nil(suite.T(), json.NewDecoder(w.Body).Decode(res))
+	require.Equal(suite.T(), 2, res.Purged)
+}
+
+func (suite *TestSuite) TestPurgeTrash_withInvalidOlderThan() {
+	r, err := http.NewRequest("DELETE", trashURL+"?olderthan=yesterday", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "PurgeTrash")
+}
+
+func (suite *TestSuite) TestPurgeTrash_withError() {
+	suite.MockMetaDataController.On("PurgeTrash").Once().Return(0, codes.NewErr(99, ""))
+	r, err := http.NewRequest("DELETE", trashURL, nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
+
+func (suite *TestSuite) TestPurgeTrashItem() {
+	suite.MockMetaDataController.On("PurgeTrashItem").Once().Return(nil)
+	r, err := http.NewRequest("DELETE", trashURL+"/123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNoContent, w.Code)
+}
+
+func (suite *TestSuite) TestPurgeTrashItem_withNotFoundError() {
+	suite.MockMetaDataController.On("PurgeTrashItem").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("DELETE", trashURL+"/123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
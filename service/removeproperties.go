@@ -0,0 +1,55 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// RemoveProperties removes the properties of an object
+// given by the key query parameters.
+func (s *Service) RemoveProperties(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+	propKeys := r.URL.Query()["key"]
+	if len(propKeys) == 0 {
+		s.handleRemovePropertiesError(codes.NewErr(codes.BadInputData, "key is missing"), w)
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	if err := s.MetaDataController.RemoveProperties(user, path, propKeys); err != nil {
+		s.handleRemovePropertiesError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handleRemovePropertiesError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("object not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("properties cannot be removed")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error removing properties")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
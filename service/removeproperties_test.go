@@ -0,0 +1,49 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestRemoveProperties() {
+	suite.MockMetaDataController.On("RemoveProperties").Once().Return(nil)
+	r, err := http.NewRequest("DELETE", propertiesURL+"myblob?key=tag&key=description", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNoContent, w.Code)
+}
+
+func (suite *TestSuite) TestRemoveProperties_withoutKey() {
+	r, err := http.NewRequest("DELETE", propertiesURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "RemoveProperties")
+}
+
+func (suite *TestSuite) TestRemoveProperties_withNotFoundError() {
+	suite.MockMetaDataController.On("RemoveProperties").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("DELETE", propertiesURL+"myblob?key=tag", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestRemoveProperties_withError() {
+	suite.MockMetaDataController.On("RemoveProperties").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("DELETE", propertiesURL+"myblob?key=tag", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
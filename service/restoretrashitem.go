@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// RestoreTrashItem moves an item of the trash back to its original
+// path or to the path given by the target query parameter.
+func (s *Service) RestoreTrashItem(w http.ResponseWriter, r *http.Request) {
+	tc, ok := s.trashController(w)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	targetPath := r.URL.Query().Get("target")
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	if err := tc.RestoreTrashItem(user, id, targetPath); err != nil {
+		s.handleRestoreTrashItemError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Service) handleRestoreTrashItemError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash item or target parent tree not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == metadatacontroller.AlreadyExists {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("target object already exists")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash item cannot be restored")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.QuotaExceeded {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota exceeded")
+			w.WriteHeader(http.StatusInsufficientStorage)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("trash is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error restoring trash item")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
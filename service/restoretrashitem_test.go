@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestRestoreTrashItem() {
+	suite.MockMetaDataController.On("RestoreTrashItem").Once().Return(nil)
+	r, err := http.NewRequest("POST", trashURL+"/123/restore?target=mytree", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreTrashItem_withNotFoundError() {
+	suite.MockMetaDataController.On("RestoreTrashItem").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("POST", trashURL+"/123/restore", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreTrashItem_withAlreadyExistsError() {
+	suite.MockMetaDataController.On("RestoreTrashItem").Once().Return(codes.NewErr(metadatacontroller.AlreadyExists, ""))
+	r, err := http.NewRequest("POST", trashURL+"/123/restore", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusConflict, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreTrashItem_withBadInputError() {
+	suite.MockMetaDataController.On("RestoreTrashItem").Once().Return(codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("POST", trashURL+"/123/restore", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreTrashItem_withError() {
+	suite.MockMetaDataController.On("RestoreTrashItem").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("POST", trashURL+"/123/restore", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
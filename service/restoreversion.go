@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// RestoreVersion makes the version of a BLOB given by the version
+// query parameter the current state of the BLOB.
+func (s *Service) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	vc, ok := s.versionController(w)
+	if !ok {
+		return
+	}
+	path := mux.Vars(r)["path"]
+	id := r.URL.Query().Get("version")
+	if id == "" {
+		s.handleRestoreVersionError(codes.NewErr(codes.BadInputData, "version is missing"), w)
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	if err := vc.RestoreVersion(user, path, id); err != nil {
+		s.handleRestoreVersionError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Service) handleRestoreVersionError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("version not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("version cannot be restored")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.QuotaExceeded {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota exceeded")
+			w.WriteHeader(http.StatusInsufficientStorage)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.NotSupported {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("versioning is not enabled")
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error restoring version")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
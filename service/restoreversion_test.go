@@ -0,0 +1,49 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestRestoreVersion() {
+	suite.MockMetaDataController.On("RestoreVersion").Once().Return(nil)
+	r, err := http.NewRequest("POST", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreVersion_withoutVersion() {
+	r, err := http.NewRequest("POST", versionsURL+"myblob", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "RestoreVersion")
+}
+
+func (suite *TestSuite) TestRestoreVersion_withNotFoundError() {
+	suite.MockMetaDataController.On("RestoreVersion").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("POST", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestRestoreVersion_withError() {
+	suite.MockMetaDataController.On("RestoreVersion").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("POST", versionsURL+"myblob?version=123", nil)
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
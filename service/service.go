@@ -1,13 +1,21 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/NYTimes/gizmo/config"
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
 	"github.com/clawio/authentication/lib"
+	"github.com/clawio/entities"
 	"github.com/clawio/metadata/metadatacontroller"
-	"github.com/clawio/metadata/metadatacontroller/simple"
+	// the simple metadata controller is always available.
+	_ "github.com/clawio/metadata/metadatacontroller/simple"
 	"github.com/clawio/sdk"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -35,14 +43,37 @@ type (
 		BaseURL                      string
 		JWTKey, JWTSigningMethod     string
 		AuthenticationServiceBaseURL string
+		// MaxListEntries is the maximum number of entries returned
+		// by a single listing, DefaultMaxListEntries if 0.
+		// Larger listings are paginated.
+		MaxListEntries int
 	}
 
 	// MetaDataControllerConfig is a struct that holds
 	// configuration parameters for a metadata controller.
+	// Type is the name under which the controller backend
+	// is registered in the metadatacontroller package and
+	// Options are passed verbatim to the backend.
+	// VersionsMaxCount and VersionsMaxAge (in seconds) are the
+	// retention policy of controllers keeping versions of BLOBs,
+	// versions are kept forever if 0.
 	MetaDataControllerConfig struct {
 		Type              string
+		Options           map[string]string
 		SimpleMetaDataDir string
-		SimpleTempDir     string
+		SimpleChecksum    string
+		VersionsMaxCount  int
+		VersionsMaxAge    int
+		// Quota are the limits on the usage of the users
+		// for controllers enforcing them, none if nil.
+		Quota *metadatacontroller.QuotaLimits
+		// JournalDir is the directory keeping the journal of the
+		// changes of every user. If empty, the changes are kept
+		// in memory.
+		JournalDir string
+		// JournalMaxCount is the number of changes kept for every
+		// user, DefaultJournalMaxCount if 0.
+		JournalMaxCount int
 	}
 )
 
@@ -63,16 +94,166 @@ func New(cfg *Config) (*Service, error) {
 	urls.AuthServiceBaseURL = cfg.General.AuthenticationServiceBaseURL
 	s := sdk.New(urls, nil)
 
-	metadataController := getMetaDataController(cfg.MetaDataController)
+	metadataController, err := getMetaDataController(cfg.MetaDataController)
+	if err != nil {
+		return nil, err
+	}
 	return &Service{Config: cfg, SDK: s, MetaDataController: metadataController}, nil
 }
 
-func getMetaDataController(cfg *MetaDataControllerConfig) metadatacontroller.MetaDataController {
-	opts := &simple.Options{
-		MetaDataDir: cfg.SimpleMetaDataDir,
-		TempDir:     cfg.SimpleTempDir,
+// Close releases the resources held by the metadata controller, like
+// the database of the Bolt controller.
+func (s *Service) Close() error {
+	if closer, ok := metadatacontroller.Unwrap(s.MetaDataController).(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func getMetaDataController(cfg *MetaDataControllerConfig) (metadatacontroller.MetaDataController, error) {
+	opts := map[string]string{}
+	for k, v := range cfg.Options {
+		opts[k] = v
+	}
+	// the options of the simple controller predate
+	// the registry and are kept as top level fields.
+	if cfg.Type == "simple" {
+		setDefaultOption(opts, "MetaDataDir", cfg.SimpleMetaDataDir)
+		setDefaultOption(opts, "Checksum", cfg.SimpleChecksum)
+	}
+	if cfg.VersionsMaxCount > 0 {
+		setDefaultOption(opts, "VersionsMaxCount", strconv.Itoa(cfg.VersionsMaxCount))
+	}
+	if cfg.VersionsMaxAge > 0 {
+		setDefaultOption(opts, "VersionsMaxAge", strconv.Itoa(cfg.VersionsMaxAge))
 	}
-	return simple.New(opts)
+	if cfg.Quota != nil {
+		quota, err := json.Marshal(cfg.Quota)
+		if err != nil {
+			return nil, err
+		}
+		setDefaultOption(opts, "Quota", string(quota))
+	}
+	c, err := metadatacontroller.New(cfg.Type, opts)
+	if err != nil {
+		return nil, err
+	}
+	max := cfg.JournalMaxCount
+	if max == 0 {
+		max = DefaultJournalMaxCount
+	}
+	journal := metadatacontroller.NewMemoryJournal(max)
+	if cfg.JournalDir != "" {
+		journal = metadatacontroller.NewFileJournal(cfg.JournalDir, max)
+	}
+	return metadatacontroller.WithJournal(c, journal, logJournalError), nil
+}
+
+// logJournalError logs the changes that could not be journaled.
+func logJournalError(user *entities.User, change *metadatacontroller.Change, err error) {
+	server.Log.WithFields(logrus.Fields{
+		"user":  user.Username,
+		"op":    change.Op,
+		"path":  change.PathSpec,
+		"error": err,
+	}).Error("change not journaled")
+}
+
+func setDefaultOption(opts map[string]string, key, value string) {
+	if _, ok := opts[key]; !ok && value != "" {
+		opts[key] = value
+	}
+}
+
+// StatusClientClosedRequest is the status code, not standard but used by
+// nginx, answered when the client cancels a request before it completes.
+const StatusClientClosedRequest = 499
+
+// contextErrorStatus returns the status code answered when err is caused by
+// the context of a request being done, and 0 for any other error.
+func contextErrorStatus(err error) int {
+	switch err {
+	case context.Canceled:
+		return StatusClientClosedRequest
+	case context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	}
+	return 0
+}
+
+// handleContextError answers the request if err is caused by its
+// context being done and reports whether it did.
+func handleContextError(err error, w http.ResponseWriter) bool {
+	status := contextErrorStatus(err)
+	if status == 0 {
+		return false
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Warn("request not completed")
+	w.WriteHeader(status)
+	return true
+}
+
+// contextController returns the metadata controller of the service
+// with support for the context of the requests.
+func (s *Service) contextController() metadatacontroller.ContextMetaDataController {
+	return metadatacontroller.WithContext(s.MetaDataController)
+}
+
+// changesController returns the metadata controller of the service as a
+// ChangeController. If the changes are not journaled, it answers the
+// request with http.StatusNotImplemented and returns false.
+func (s *Service) changesController(w http.ResponseWriter) (metadatacontroller.ChangeController, bool) {
+	cc, ok := s.MetaDataController.(metadatacontroller.ChangeController)
+	if !ok {
+		notImplemented(w, "metadata controller journals no changes")
+		return nil, false
+	}
+	return cc, true
+}
+
+// notImplemented answers the request with http.StatusNotImplemented
+// after logging why.
+func notImplemented(w http.ResponseWriter, why string) {
+	server.Log.Warn(why)
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// trashController returns the metadata controller of the service as a
+// TrashController. If the controller has no trash, it answers the
+// request with http.StatusNotImplemented and returns false.
+func (s *Service) trashController(w http.ResponseWriter) (metadatacontroller.TrashController, bool) {
+	tc, ok := s.MetaDataController.(metadatacontroller.TrashController)
+	if !ok {
+		notImplemented(w, "metadata controller has no trash")
+		return nil, false
+	}
+	return tc, true
+}
+
+// versionController returns the metadata controller of the service as a
+// VersionController. If the controller keeps no versions, it answers the
+// request with http.StatusNotImplemented and returns false.
+func (s *Service) versionController(w http.ResponseWriter) (metadatacontroller.VersionController, bool) {
+	vc, ok := s.MetaDataController.(metadatacontroller.VersionController)
+	if !ok {
+		notImplemented(w, "metadata controller keeps no versions")
+		return nil, false
+	}
+	return vc, true
+}
+
+// quotaController returns the metadata controller of the service as a
+// QuotaController. If the controller has no quota, it answers the
+// request with http.StatusNotImplemented and returns false.
+func (s *Service) quotaController(w http.ResponseWriter) (metadatacontroller.QuotaController, bool) {
+	qc, ok := s.MetaDataController.(metadatacontroller.QuotaController)
+	if !ok {
+		notImplemented(w, "metadata controller has no quota")
+		return nil, false
+	}
+	return qc, true
 }
 
 // Prefix returns the string prefix used for all endpoints within
@@ -94,6 +275,11 @@ func (s *Service) Middleware(h http.Handler) http.Handler {
 func (s *Service) Endpoints() map[string]map[string]http.HandlerFunc {
 	authenticator := lib.NewAuthenticator(s.Config.General.JWTKey, s.Config.General.JWTSigningMethod)
 
+	webDAV := map[string]http.HandlerFunc{}
+	for _, method := range webDAVMethods {
+		webDAV[method] = prometheus.InstrumentHandlerFunc(WebDAVPath, authenticator.JWTHandlerFunc(s.WebDAV))
+	}
+
 	return map[string]map[string]http.HandlerFunc{
 		"/metrics": {
 			"GET": func(w http.ResponseWriter, r *http.Request) {
@@ -103,6 +289,9 @@ func (s *Service) Endpoints() map[string]map[string]http.HandlerFunc {
 		"/init": {
 			"POST": prometheus.InstrumentHandlerFunc("/init", authenticator.JWTHandlerFunc(s.Init)),
 		},
+		"/createtree/{path:.*}": {
+			"POST": prometheus.InstrumentHandlerFunc("/createtree", authenticator.JWTHandlerFunc(s.CreateTree)),
+		},
 		"/examine/{path:.*}": {
 			"GET": prometheus.InstrumentHandlerFunc("/examine", authenticator.JWTHandlerFunc(s.ExamineObject)),
 		},
@@ -112,8 +301,47 @@ func (s *Service) Endpoints() map[string]map[string]http.HandlerFunc {
 		"/move/{path:.*}": {
 			"POST": prometheus.InstrumentHandlerFunc("/move", authenticator.JWTHandlerFunc(s.MoveObject)),
 		},
+		"/copy/{path:.*}": {
+			"POST": prometheus.InstrumentHandlerFunc("/copy", authenticator.JWTHandlerFunc(s.CopyObject)),
+		},
 		"/delete/{path:.*}": {
 			"DELETE": prometheus.InstrumentHandlerFunc("/delete", authenticator.JWTHandlerFunc(s.DeleteObject)),
 		},
+		"/batch": {
+			"POST": prometheus.InstrumentHandlerFunc("/batch", authenticator.JWTHandlerFunc(s.Batch)),
+		},
+		"/changes": {
+			"GET": prometheus.InstrumentHandlerFunc("/changes", authenticator.JWTHandlerFunc(s.GetChanges)),
+		},
+		"/events": {
+			"GET": prometheus.InstrumentHandlerFunc("/events", authenticator.JWTHandlerFunc(s.GetEvents)),
+		},
+		"/ws": {
+			"GET": prometheus.InstrumentHandlerFunc("/ws", tokenFromProtocol(authenticator.JWTHandlerFunc(s.Subscribe))),
+		},
+		WebDAVPath + "/{path:.*}": webDAV,
+		"/quota": {
+			"GET": prometheus.InstrumentHandlerFunc("/quota", authenticator.JWTHandlerFunc(s.GetQuota)),
+		},
+		"/trash": {
+			"GET":    prometheus.InstrumentHandlerFunc("/trash", authenticator.JWTHandlerFunc(s.ListTrash)),
+			"DELETE": prometheus.InstrumentHandlerFunc("/trash", authenticator.JWTHandlerFunc(s.PurgeTrash)),
+		},
+		"/trash/{id}": {
+			"DELETE": prometheus.InstrumentHandlerFunc("/trash/item", authenticator.JWTHandlerFunc(s.PurgeTrashItem)),
+		},
+		"/trash/{id}/restore": {
+			"POST": prometheus.InstrumentHandlerFunc("/trash/restore", authenticator.JWTHandlerFunc(s.RestoreTrashItem)),
+		},
+		"/properties/{path:.*}": {
+			"GET":    prometheus.InstrumentHandlerFunc("/properties", authenticator.JWTHandlerFunc(s.GetProperties)),
+			"POST":   prometheus.InstrumentHandlerFunc("/properties/set", authenticator.JWTHandlerFunc(s.SetProperties)),
+			"DELETE": prometheus.InstrumentHandlerFunc("/properties/remove", authenticator.JWTHandlerFunc(s.RemoveProperties)),
+		},
+		"/versions/{path:.*}": {
+			"GET":    prometheus.InstrumentHandlerFunc("/versions", authenticator.JWTHandlerFunc(s.ListVersions)),
+			"POST":   prometheus.InstrumentHandlerFunc("/versions/restore", authenticator.JWTHandlerFunc(s.RestoreVersion)),
+			"DELETE": prometheus.InstrumentHandlerFunc("/versions/delete", authenticator.JWTHandlerFunc(s.DeleteVersion)),
+		},
 	}
 }
@@ -10,7 +10,10 @@ import (
 	"github.com/NYTimes/gizmo/config"
 	"github.com/NYTimes/gizmo/server"
 	"github.com/clawio/authentication/lib"
+	"github.com/clawio/codes"
 	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	_ "github.com/clawio/metadata/metadatacontroller/memory"
 	mock_metadatacontroller "github.com/clawio/metadata/metadatacontroller/mock"
 	"github.com/clawio/sdk"
 	"github.com/clawio/sdk/mocks"
@@ -19,14 +22,25 @@ import (
 )
 
 var (
-	examineURL string
-	listURL    string
-	deleteURL  string
-	moveURL    string
-	initURL    string
-	metricsURL string
-	user       = &entities.User{Username: "test"}
-	jwtToken   string
+	examineURL    string
+	createTreeURL string
+	listURL       string
+	deleteURL     string
+	moveURL       string
+	copyURL       string
+	batchURL      string
+	trashURL      string
+	versionsURL   string
+	propertiesURL string
+	quotaURL      string
+	changesURL    string
+	eventsURL     string
+	wsURL         string
+	webDAVURL     string
+	initURL       string
+	metricsURL    string
+	user          = &entities.User{Username: "test"}
+	jwtToken      string
 )
 
 type TestSuite struct {
@@ -53,7 +67,6 @@ func (suite *TestSuite) SetupTest() {
 		MetaDataController: &MetaDataControllerConfig{
 			Type:              "simple",
 			SimpleMetaDataDir: "/tmp",
-			SimpleTempDir:     "/tmp",
 		},
 	}
 	mockAuthService := &mocks.MockAuthService{}
@@ -85,9 +98,20 @@ func (suite *TestSuite) SetupTest() {
 
 	// set testing urls
 	examineURL = path.Join(svc.Config.General.BaseURL, "/examine") + "/"
+	createTreeURL = path.Join(svc.Config.General.BaseURL, "/createtree") + "/"
 	listURL = path.Join(svc.Config.General.BaseURL, "/list") + "/"
 	deleteURL = path.Join(svc.Config.General.BaseURL, "/delete") + "/"
 	moveURL = path.Join(svc.Config.General.BaseURL, "/move") + "/"
+	copyURL = path.Join(svc.Config.General.BaseURL, "/copy") + "/"
+	batchURL = path.Join(svc.Config.General.BaseURL, "/batch")
+	trashURL = path.Join(svc.Config.General.BaseURL, "/trash")
+	versionsURL = path.Join(svc.Config.General.BaseURL, "/versions") + "/"
+	propertiesURL = path.Join(svc.Config.General.BaseURL, "/properties") + "/"
+	quotaURL = path.Join(svc.Config.General.BaseURL, "/quota")
+	changesURL = path.Join(svc.Config.General.BaseURL, "/changes")
+	eventsURL = path.Join(svc.Config.General.BaseURL, "/events")
+	wsURL = path.Join(svc.Config.General.BaseURL, "/ws")
+	webDAVURL = path.Join(svc.Config.General.BaseURL, WebDAVPath) + "/"
 	initURL = path.Join(svc.Config.General.BaseURL, "/init")
 	metricsURL = path.Join(svc.Config.General.BaseURL, "/metrics")
 }
@@ -105,13 +129,86 @@ func (suite *TestSuite) TestNew() {
 		MetaDataController: &MetaDataControllerConfig{
 			Type:              "simple",
 			SimpleMetaDataDir: "/tmp",
-			SimpleTempDir:     "/tmp",
 		},
 	}
 	svc, err := New(cfg)
 	require.Nil(suite.T(), err)
 	require.NotNil(suite.T(), svc)
 }
+func (suite *TestSuite) TestNew_withMemoryMetaDataController() {
+	cfg := &Config{
+		Server: &config.Server{},
+		General: &GeneralConfig{
+			AuthenticationServiceBaseURL: "http://localhost:58001/api/auth/",
+		},
+		MetaDataController: &MetaDataControllerConfig{
+			Type: "memory",
+		},
+	}
+	svc, err := New(cfg)
+	require.Nil(suite.T(), err)
+	require.Nil(suite.T(), svc.MetaDataController.Init(user))
+}
+
+// closingController records whether it was closed.
+type closingController struct {
+	metadatacontroller.MetaDataController
+	closed bool
+}
+
+func (c *closingController) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (suite *TestSuite) TestClose() {
+	c := &closingController{}
+	suite.Service.MetaDataController = metadatacontroller.WithJournal(c, metadatacontroller.NewMemoryJournal(0), nil)
+	require.Nil(suite.T(), suite.Service.Close())
+	require.True(suite.T(), c.closed)
+
+	// controllers without resources are left alone.
+	suite.Service.MetaDataController = &mock_metadatacontroller.MetaDataController{}
+	require.Nil(suite.T(), suite.Service.Close())
+}
+
+func (suite *TestSuite) TestNew_withQuota() {
+	cfg := &Config{
+		Server: &config.Server{},
+		General: &GeneralConfig{
+			AuthenticationServiceBaseURL: "http://localhost:58001/api/auth/",
+		},
+		MetaDataController: &MetaDataControllerConfig{
+			Type:              "simple",
+			SimpleMetaDataDir: "/tmp",
+			Quota: &metadatacontroller.QuotaLimits{
+				QuotaLimit: metadatacontroller.QuotaLimit{Bytes: 100},
+			},
+		},
+	}
+	svc, err := New(cfg)
+	require.Nil(suite.T(), err)
+	qc, ok := svc.MetaDataController.(metadatacontroller.QuotaController)
+	require.True(suite.T(), ok)
+	// the quota is enabled, so only the home tree is missing.
+	_, err = qc.GetQuota(&entities.User{Username: "notexists"})
+	codeErr, ok := err.(*codes.Err)
+	require.True(suite.T(), ok)
+	require.Equal(suite.T(), codes.NotFound, codeErr.Code)
+}
+func (suite *TestSuite) TestNew_withUnknownMetaDataController() {
+	cfg := &Config{
+		Server: &config.Server{},
+		General: &GeneralConfig{
+			AuthenticationServiceBaseURL: "http://localhost:58001/api/auth/",
+		},
+		MetaDataController: &MetaDataControllerConfig{
+			Type: "notexists",
+		},
+	}
+	_, err := New(cfg)
+	require.NotNil(suite.T(), err)
+}
 func (suite *TestSuite) TestNew_withNilConfig() {
 	_, err := New(nil)
 	require.NotNil(suite.T(), err)
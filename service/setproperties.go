@@ -0,0 +1,59 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// maxPropertiesBodySize is the maximum size of the
+// JSON object with the properties to set.
+const maxPropertiesBodySize = 1 << 20
+
+// SetProperties sets the properties of an object given as a JSON object
+// in the body, keeping the properties not present in it.
+func (s *Service) SetProperties(w http.ResponseWriter, r *http.Request) {
+	path := mux.Vars(r)["path"]
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	props := map[string]string{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPropertiesBodySize)).Decode(&props); err != nil {
+		s.handleSetPropertiesError(codes.NewErr(codes.BadInputData, "properties are not a JSON object of strings"), w)
+		return
+	}
+	if err := s.MetaDataController.SetProperties(user, path, props); err != nil {
+		s.handleSetPropertiesError(err, w)
+		return
+	}
+}
+
+func (s *Service) handleSetPropertiesError(err error, w http.ResponseWriter) {
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("object not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("properties cannot be set")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error setting properties")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
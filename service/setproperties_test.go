@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/clawio/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func (suite *TestSuite) TestSetProperties() {
+	suite.MockMetaDataController.On("SetProperties").Once().Return(nil)
+	r, err := http.NewRequest("POST", propertiesURL+"myblob", strings.NewReader(`{"tag": "red"}`))
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+}
+
+func (suite *TestSuite) TestSetProperties_withInvalidBody() {
+	r, err := http.NewRequest("POST", propertiesURL+"myblob", strings.NewReader(`{"tag": 1}`))
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	suite.MockMetaDataController.AssertNotCalled(suite.T(), "SetProperties")
+}
+
+func (suite *TestSuite) TestSetProperties_withNotFoundError() {
+	suite.MockMetaDataController.On("SetProperties").Once().Return(codes.NewErr(codes.NotFound, ""))
+	r, err := http.NewRequest("POST", propertiesURL+"myblob", strings.NewReader(`{"tag": "red"}`))
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *TestSuite) TestSetProperties_withBadInputError() {
+	suite.MockMetaDataController.On("SetProperties").Once().Return(codes.NewErr(codes.BadInputData, ""))
+	r, err := http.NewRequest("POST", propertiesURL+"myblob", strings.NewReader(`{"": "red"}`))
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestSetProperties_withError() {
+	suite.MockMetaDataController.On("SetProperties").Once().Return(codes.NewErr(99, ""))
+	r, err := http.NewRequest("POST", propertiesURL+"myblob", strings.NewReader(`{"tag": "red"}`))
+	setToken(r)
+	require.Nil(suite.T(), err)
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	require.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+}
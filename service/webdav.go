@@ -0,0 +1,553 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/codes"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// WebDAVPath is the path, under the BaseURL, of the WebDAV frontend.
+const WebDAVPath = "/webdav"
+
+// webDAVMethods are the methods served by WebDAV.
+var webDAVMethods = []string{"OPTIONS", "PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "DELETE"}
+
+// errConditionsNotSupported is returned when the request has conditions
+// and the controller cannot check them.
+var errConditionsNotSupported = errors.New("conditions not supported")
+
+// errWebDAVConflict is returned when the parent of the target of
+// an operation does not exist.
+var errWebDAVConflict = codes.NewErr(codes.NotFound, "parent tree not found")
+
+// WebDAV serves the namespace of the user over WebDAV (RFC 4918) without
+// locks, mapping PROPFIND to ExamineObject and ListTree, capped to
+// MaxListEntries entries, PROPPATCH to the properties of the objects,
+// MKCOL to CreateTree, COPY, MOVE and DELETE to CopyObject, MoveObject
+// and DeleteObject. Overwritten objects are replaced only once the copy
+// or move succeeds. The size, type, mime type, modification time and
+// ETag of the objects are exposed as the DAV: live properties and their
+// properties as dead properties in PropertyNamespace.
+func (s *Service) WebDAV(w http.ResponseWriter, r *http.Request) {
+	pathSpec := mux.Vars(r)["path"]
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	var err error
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Allow", strings.Join(webDAVMethods, ", "))
+		w.Header().Set("DAV", "1")
+	case "PROPFIND":
+		err = s.propfind(w, r, user, pathSpec)
+	case "PROPPATCH":
+		err = s.proppatch(w, r, user, pathSpec)
+	case "MKCOL":
+		err = s.mkcol(w, r, user, pathSpec)
+	case "COPY", "MOVE":
+		err = s.copyMove(w, r, user, pathSpec)
+	case "DELETE":
+		err = s.webDAVDelete(r, user, pathSpec)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+	if err != nil {
+		s.handleWebDAVError(err, w)
+	}
+}
+
+func (s *Service) propfind(w http.ResponseWriter, r *http.Request, user *entities.User, pathSpec string) error {
+	depth := metadatacontroller.DepthInfinity
+	switch r.Header.Get("Depth") {
+	case "0":
+		depth = 0
+	case "1":
+		depth = 1
+	case "", "infinity":
+	default:
+		return codes.NewErr(codes.BadInputData, "Depth must be 0, 1 or infinity")
+	}
+	pf := &propfind{}
+	if err := xml.NewDecoder(r.Body).Decode(pf); err == io.EOF {
+		pf.AllProp = &struct{}{}
+	} else if err != nil {
+		return codes.NewErr(codes.BadInputData, "bad propfind: "+err.Error())
+	}
+
+	oinfo, err := s.contextController().ExamineObjectContext(r.Context(), user, pathSpec)
+	if err != nil {
+		return err
+	}
+	oinfos := []*entities.ObjectInfo{oinfo}
+	if oinfo.Type == entities.ObjectTypeTree && depth != 0 {
+		// the responses are built in memory, so the listing is
+		// capped like the ones of ListTree, asking for one more
+		// entry to know if the cap is exceeded.
+		maxEntries := s.Config.General.MaxListEntries
+		if maxEntries <= 0 {
+			maxEntries = DefaultMaxListEntries
+		}
+		opts := &metadatacontroller.ListOptions{Depth: depth, Limit: maxEntries + 1}
+		next, err := metadatacontroller.StreamTree(r.Context(), s.contextController(), user, pathSpec, opts, func(oinfo *entities.ObjectInfo) error {
+			oinfos = append(oinfos, oinfo)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if next != "" || len(oinfos)-1 > maxEntries {
+			if depth == metadatacontroller.DepthInfinity {
+				return writeDAVError(w, http.StatusForbidden, "propfind-finite-depth")
+			}
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return nil
+		}
+	}
+
+	responses := []*davResponse{}
+	for _, oinfo := range oinfos {
+		res, err := s.propfindResponse(user, oinfo, pf)
+		if err != nil {
+			return err
+		}
+		responses = append(responses, res)
+	}
+	return writeMultistatus(w, responses)
+}
+
+func (s *Service) propfindResponse(user *entities.User, oinfo *entities.ObjectInfo, pf *propfind) (*davResponse, error) {
+	props := liveProps(oinfo)
+	names := []xml.Name{}
+	for _, prop := range pf.Prop {
+		names = append(names, prop.XMLName)
+	}
+	// the properties of the object are only read when asked.
+	dead := pf.AllProp != nil || pf.PropName != nil
+	for _, name := range names {
+		if _, ok := props[name]; !ok {
+			dead = true
+		}
+	}
+	if dead {
+		keys, err := s.MetaDataController.GetProperties(user, oinfo.PathSpec)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range keys {
+			if name, ok := propertyName(key); ok {
+				props[name] = escapeXML(value)
+			}
+		}
+	}
+	if pf.AllProp != nil || pf.PropName != nil {
+		names = names[:0]
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Sort(byXMLName(names))
+	}
+
+	found, missing := []davPropValue{}, []davPropValue{}
+	for _, name := range names {
+		value, ok := props[name]
+		if pf.PropName != nil {
+			value = ""
+		}
+		prop := davPropValue{XMLName: responseName(name), InnerXML: value}
+		if ok {
+			found = append(found, prop)
+		} else {
+			missing = append(missing, prop)
+		}
+	}
+	res := &davResponse{Href: s.webDAVHref(oinfo)}
+	if len(found) > 0 || len(missing) == 0 {
+		res.Propstats = append(res.Propstats, newPropstat(http.StatusOK, found))
+	}
+	if len(missing) > 0 {
+		res.Propstats = append(res.Propstats, newPropstat(http.StatusNotFound, missing))
+	}
+	return res, nil
+}
+
+type byXMLName []xml.Name
+
+func (n byXMLName) Len() int      { return len(n) }
+func (n byXMLName) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n byXMLName) Less(i, j int) bool {
+	if n[i].Space != n[j].Space {
+		return n[i].Space < n[j].Space
+	}
+	return n[i].Local < n[j].Local
+}
+
+// liveProps returns the DAV: properties of an object as XML.
+func liveProps(oinfo *entities.ObjectInfo) map[xml.Name]string {
+	dav := func(local string) xml.Name { return xml.Name{Space: davNamespace, Local: local} }
+	resourceType := ""
+	if oinfo.Type == entities.ObjectTypeTree {
+		resourceType = "<D:collection/>"
+	}
+	props := map[xml.Name]string{
+		dav("displayname"):      escapeXML(path.Base(cleanPathSpec(oinfo.PathSpec))),
+		dav("resourcetype"):     resourceType,
+		dav("getcontentlength"): strconv.FormatInt(oinfo.Size, 10),
+		dav("getcontenttype"):   escapeXML(oinfo.MimeType),
+		dav("getlastmodified"):  time.Unix(oinfo.ModTime, 0).UTC().Format(http.TimeFormat),
+	}
+	if etag := metadatacontroller.GetETag(oinfo); etag != "" {
+		props[dav("getetag")] = escapeXML(`"` + etag + `"`)
+	}
+	return props
+}
+
+func (s *Service) proppatch(w http.ResponseWriter, r *http.Request, user *entities.User, pathSpec string) error {
+	pu := &propertyupdate{}
+	if err := xml.NewDecoder(r.Body).Decode(pu); err != nil {
+		return codes.NewErr(codes.BadInputData, "bad propertyupdate: "+err.Error())
+	}
+	oinfo, err := s.contextController().ExamineObjectContext(r.Context(), user, pathSpec)
+	if err != nil {
+		return err
+	}
+	names, forbidden, conflicts := []davPropValue{}, []davPropValue{}, []davPropValue{}
+	for _, update := range pu.Updates {
+		for _, prop := range update.Prop {
+			name := davPropValue{XMLName: responseName(prop.XMLName)}
+			// the live properties cannot be changed.
+			if prop.XMLName.Space == davNamespace {
+				forbidden = append(forbidden, name)
+				continue
+			}
+			key := propertyKey(prop.XMLName)
+			if update.Remove {
+				err = metadatacontroller.CheckPropertyKeys(key)
+			} else {
+				err = metadatacontroller.CheckProperties(map[string]string{key: prop.Value})
+			}
+			if err != nil {
+				conflicts = append(conflicts, name)
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+
+	res := &davResponse{Href: s.webDAVHref(oinfo)}
+	if len(forbidden) > 0 || len(conflicts) > 0 {
+		// the update is atomic, so nothing is changed.
+		if len(forbidden) > 0 {
+			res.Propstats = append(res.Propstats, newPropstat(http.StatusForbidden, forbidden))
+		}
+		if len(conflicts) > 0 {
+			res.Propstats = append(res.Propstats, newPropstat(http.StatusConflict, conflicts))
+		}
+		if len(names) > 0 {
+			res.Propstats = append(res.Propstats, newPropstat(http.StatusFailedDependency, names))
+		}
+		return writeMultistatus(w, []*davResponse{res})
+	}
+
+	// the instructions are applied in document order to the current
+	// properties, and only the difference is stored.
+	old, err := s.MetaDataController.GetProperties(user, pathSpec)
+	if err != nil {
+		return err
+	}
+	props := map[string]string{}
+	for k, v := range old {
+		props[k] = v
+	}
+	for _, update := range pu.Updates {
+		for _, prop := range update.Prop {
+			if update.Remove {
+				delete(props, propertyKey(prop.XMLName))
+			} else {
+				props[propertyKey(prop.XMLName)] = prop.Value
+			}
+		}
+	}
+	status := http.StatusOK
+	if err := s.updateProperties(user, pathSpec, old, props); err != nil {
+		server.Log.WithFields(logrus.Fields{
+			"error":    err,
+			"pathSpec": pathSpec,
+		}).Error("properties not updated")
+		status = http.StatusInternalServerError
+	}
+	res.Propstats = append(res.Propstats, newPropstat(status, names))
+	return writeMultistatus(w, []*davResponse{res})
+}
+
+// updateProperties changes the properties of the object at pathSpec
+// from old to props, restoring old if it fails. Failures to restore are
+// only logged, as the update fails anyway.
+func (s *Service) updateProperties(user *entities.User, pathSpec string, old, props map[string]string) error {
+	err := s.replaceProperties(user, pathSpec, old, props)
+	if err != nil {
+		if restoreErr := s.replaceProperties(user, pathSpec, props, old); restoreErr != nil {
+			server.Log.WithFields(logrus.Fields{
+				"error":    restoreErr,
+				"pathSpec": pathSpec,
+			}).Error("properties not restored")
+		}
+	}
+	return err
+}
+
+// replaceProperties sets the properties of props that are missing or
+// different in old, and removes the ones of old missing in props.
+func (s *Service) replaceProperties(user *entities.User, pathSpec string, old, props map[string]string) error {
+	set, remove := map[string]string{}, []string{}
+	for k, v := range props {
+		if oldValue, ok := old[k]; !ok || oldValue != v {
+			set[k] = v
+		}
+	}
+	for k := range old {
+		if _, ok := props[k]; !ok {
+			remove = append(remove, k)
+		}
+	}
+	if len(set) > 0 {
+		if err := s.MetaDataController.SetProperties(user, pathSpec, set); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		return s.MetaDataController.RemoveProperties(user, pathSpec, remove)
+	}
+	return nil
+}
+
+func (s *Service) mkcol(w http.ResponseWriter, r *http.Request, user *entities.User, pathSpec string) error {
+	if r.ContentLength > 0 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return nil
+	}
+	err := s.contextController().CreateTreeContext(r.Context(), user, pathSpec, false)
+	if codeErr, ok := err.(*codes.Err); ok {
+		switch codeErr.Code {
+		case codes.NotFound:
+			return errWebDAVConflict
+		case metadatacontroller.AlreadyExists:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// copyMove copies or moves the object to the Destination header. Existing
+// objects at the destination are replaced unless the Overwrite header is
+// F: BLOBs by the controller, which replaces them with other BLOBs, and
+// trees by moving them aside and deleting them once the copy or move
+// succeeds, so they are restored if it fails.
+func (s *Service) copyMove(w http.ResponseWriter, r *http.Request, user *entities.User, pathSpec string) error {
+	target, err := s.getDestination(r)
+	if err != nil {
+		return err
+	}
+	if cleanPathSpec(target) == cleanPathSpec(pathSpec) {
+		w.WriteHeader(http.StatusForbidden)
+		return nil
+	}
+	if r.Method == "COPY" && r.Header.Get("Depth") != "" && r.Header.Get("Depth") != "infinity" {
+		return codes.NewErr(codes.BadInputData, "COPY is only supported with Depth infinity")
+	}
+	cc := s.contextController()
+	oinfo, err := cc.ExamineObjectContext(r.Context(), user, pathSpec)
+	if err != nil {
+		return err
+	}
+	overwritten, aside := false, ""
+	if targetInfo, err := cc.ExamineObjectContext(r.Context(), user, target); err == nil {
+		if r.Header.Get("Overwrite") == "F" {
+			return codes.NewErr(metadatacontroller.PreconditionFailed, "destination exists")
+		}
+		if oinfo.Type != entities.ObjectTypeBLOB || targetInfo.Type != entities.ObjectTypeBLOB {
+			aside = path.Join(path.Dir(cleanPathSpec(target)), ".webdav-overwritten-"+metadatacontroller.NewETag())
+			if err := cc.MoveObjectContext(r.Context(), user, target, aside); err != nil {
+				return err
+			}
+		}
+		overwritten = true
+	} else if codeErr, ok := err.(*codes.Err); !ok || codeErr.Code != codes.NotFound {
+		return err
+	}
+
+	if r.Method == "COPY" {
+		err = cc.CopyObjectContext(r.Context(), user, pathSpec, target)
+	} else {
+		err = s.webDAVMove(r, user, pathSpec, target)
+	}
+	if aside != "" {
+		s.dropOverwritten(user, aside, target, err == nil)
+	}
+	if err != nil {
+		if codeErr, ok := err.(*codes.Err); ok && codeErr.Code == codes.NotFound {
+			return errWebDAVConflict
+		}
+		return err
+	}
+	if overwritten {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+// dropOverwritten deletes the object moved aside to aside when it was
+// replaced, or moves it back to target otherwise. It does not use the
+// context of the request, as it must be done even if the request was
+// canceled. Failures are only logged, as the result of the request
+// does not depend on them.
+func (s *Service) dropOverwritten(user *entities.User, aside, target string, replaced bool) {
+	var err error
+	if replaced {
+		err = s.MetaDataController.DeleteObject(user, aside)
+	} else {
+		err = s.MetaDataController.MoveObject(user, aside, target)
+	}
+	if err != nil {
+		server.Log.WithFields(logrus.Fields{
+			"error":    err,
+			"aside":    aside,
+			"target":   target,
+			"replaced": replaced,
+		}).Error("overwritten object left aside")
+	}
+}
+
+func (s *Service) webDAVMove(r *http.Request, user *entities.User, source, target string) error {
+	if cond := getCondition(r); cond != nil {
+		cc, ok := s.asConditionalController()
+		if !ok {
+			return errConditionsNotSupported
+		}
+		return cc.MoveObjectIf(r.Context(), user, source, target, cond)
+	}
+	return s.contextController().MoveObjectContext(r.Context(), user, source, target)
+}
+
+func (s *Service) webDAVDelete(r *http.Request, user *entities.User, pathSpec string) error {
+	if cond := getCondition(r); cond != nil {
+		cc, ok := s.asConditionalController()
+		if !ok {
+			return errConditionsNotSupported
+		}
+		return cc.DeleteObjectIf(r.Context(), user, pathSpec, cond)
+	}
+	return s.contextController().DeleteObjectContext(r.Context(), user, pathSpec)
+}
+
+// getDestination returns the path of the object at the Destination
+// header of r, which must be under the WebDAV frontend of this service.
+func (s *Service) getDestination(r *http.Request) (string, error) {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		return "", codes.NewErr(codes.BadInputData, "bad Destination header")
+	}
+	if dest.Host != "" && dest.Host != r.Host {
+		return "", codes.NewErr(codes.BadInputData, "Destination is in another server")
+	}
+	prefix := s.webDAVPrefix()
+	if !strings.HasPrefix(dest.Path, prefix) {
+		return "", codes.NewErr(codes.BadInputData, "Destination is outside "+prefix)
+	}
+	return strings.TrimPrefix(dest.Path, prefix), nil
+}
+
+// webDAVPrefix returns the path of the WebDAV frontend, with a trailing slash.
+func (s *Service) webDAVPrefix() string {
+	return path.Join(s.Prefix(), WebDAVPath) + "/"
+}
+
+// webDAVHref returns the escaped URL path of an object, trees end with a slash.
+func (s *Service) webDAVHref(oinfo *entities.ObjectInfo) string {
+	p := strings.TrimPrefix(cleanPathSpec(oinfo.PathSpec), "/")
+	if oinfo.Type == entities.ObjectTypeTree && p != "" {
+		p += "/"
+	}
+	return (&url.URL{Path: s.webDAVPrefix() + p}).EscapedPath()
+}
+
+func (s *Service) handleWebDAVError(err error, w http.ResponseWriter) {
+	if handleContextError(err, w) {
+		return
+	}
+	if err == errConditionsNotSupported {
+		server.Log.Warn("metadata controller cannot check conditions")
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	if err == errWebDAVConflict {
+		server.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("parent tree not found")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if codeErr, ok := err.(*codes.Err); ok {
+		if codeErr.Code == codes.NotFound {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object not found")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if codeErr.Code == codes.BadInputData {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("bad webdav request")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err)
+			return
+		} else if codeErr.Code == metadatacontroller.AlreadyExists {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("object already exists")
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if codeErr.Code == metadatacontroller.QuotaExceeded {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("quota exceeded")
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return
+		} else if codeErr.Code == metadatacontroller.PreconditionFailed {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("precondition failed")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+	}
+	server.Log.WithFields(logrus.Fields{
+		"error": err,
+	}).Error("error serving webdav request")
+	w.WriteHeader(http.StatusInternalServerError)
+	return
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"github.com/clawio/entities"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type testMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Prop struct {
+				Props []struct {
+					XMLName xml.Name
+					Value   string `xml:",innerxml"`
+				} `xml:",any"`
+			} `xml:"prop"`
+			Status string `xml:"status"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// props returns the properties of the response for href
+// with the given status, by local name.
+func (ms *testMultistatus) props(href, status string) map[string]string {
+	props := map[string]string{}
+	for _, res := range ms.Responses {
+		if res.Href != href {
+			continue
+		}
+		for _, ps := range res.Propstats {
+			if !strings.Contains(ps.Status, status) {
+				continue
+			}
+			for _, prop := range ps.Prop.Props {
+				props[prop.XMLName.Local] = prop.Value
+			}
+		}
+	}
+	return props
+}
+
+func (suite *TestSuite) setWebDAVController() {
+	c := memory.New()
+	require.Nil(suite.T(), c.Init(user))
+	require.Nil(suite.T(), c.CreateTree(user, "mytree", false))
+	require.Nil(suite.T(), c.(metadatacontroller.BLOBPutter).PutBLOB(user, "mytree/my blob.txt", 3, ""))
+	suite.Service.MetaDataController = c
+}
+
+func (suite *TestSuite) webDAV(method, pathSpec string, header map[string]string, body string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest(method, webDAVURL+pathSpec, strings.NewReader(body))
+	require.Nil(suite.T(), err)
+	setToken(r)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	suite.Server.ServeHTTP(w, r)
+	return w
+}
+
+func (suite *TestSuite) propfind(pathSpec, depth, body string) *testMultistatus {
+	w := suite.webDAV("PROPFIND", pathSpec, map[string]string{"Depth": depth}, body)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	ms := &testMultistatus{}
+	require.Nil(suite.T(), xml.Unmarshal(w.Body.Bytes(), ms))
+	return ms
+}
+
+func (suite *TestSuite) TestWebDAV_propfind() {
+	suite.setWebDAVController()
+	ms := suite.propfind("mytree", "1", "")
+	require.Equal(suite.T(), 2, len(ms.Responses))
+	props := ms.props(webDAVURL+"mytree/", "200")
+	require.Equal(suite.T(), "<D:collection/>", props["resourcetype"])
+	require.Equal(suite.T(), "mytree", props["displayname"])
+	require.NotEqual(suite.T(), "", props["getetag"])
+
+	props = ms.props(webDAVURL+"mytree/my%20blob.txt", "200")
+	require.Equal(suite.T(), "", props["resourcetype"])
+	require.Equal(suite.T(), "3", props["getcontentlength"])
+	require.Equal(suite.T(), "text/plain; charset=utf-8", props["getcontenttype"])
+	require.Contains(suite.T(), props["getlastmodified"], "GMT")
+
+	ms = suite.propfind("", "1", "")
+	require.Equal(suite.T(), 2, len(ms.Responses))
+	require.Equal(suite.T(), webDAVURL, ms.Responses[0].Href)
+	ms = suite.propfind("mytree", "0", "")
+	require.Equal(suite.T(), 1, len(ms.Responses))
+}
+
+func (suite *TestSuite) TestWebDAV_propfindWithInfiniteDepth() {
+	suite.setWebDAVController()
+	ms := suite.propfind("", "infinity", "")
+	require.Equal(suite.T(), 3, len(ms.Responses))
+	ms = suite.propfind("", "", "")
+	require.Equal(suite.T(), 3, len(ms.Responses))
+
+	// listings over MaxListEntries are refused.
+	suite.Service.Config.General.MaxListEntries = 1
+	w := suite.webDAV("PROPFIND", "", map[string]string{"Depth": "infinity"}, "")
+	require.Equal(suite.T(), http.StatusForbidden, w.Code)
+	require.Contains(suite.T(), w.Body.String(), "<D:propfind-finite-depth/>")
+	suite.propfind("mytree", "1", "")
+	require.Nil(suite.T(), suite.Service.MetaDataController.CreateTree(user, "mytree/othertree", false))
+	w = suite.webDAV("PROPFIND", "mytree", map[string]string{"Depth": "1"}, "")
+	require.Equal(suite.T(), http.StatusInsufficientStorage, w.Code)
+}
+
+func (suite *TestSuite) TestWebDAV_propfindProps() {
+	suite.setWebDAVController()
+	ms := suite.propfind("mytree", "0", `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:getcontentlength/><D:lockdiscovery/></D:prop></D:propfind>`)
+	href := webDAVURL + "mytree/"
+	require.Equal(suite.T(), []string{"getcontentlength"}, propNames(ms.props(href, "200")))
+	require.Equal(suite.T(), []string{"lockdiscovery"}, propNames(ms.props(href, "404")))
+
+	ms = suite.propfind("mytree", "0", `<D:propfind xmlns:D="DAV:"><D:propname/></D:propfind>`)
+	props := ms.props(href, "200")
+	require.Equal(suite.T(), "", props["getlastmodified"])
+	require.Contains(suite.T(), props, "getetag")
+}
+
+func (suite *TestSuite) TestWebDAV_propfindWithErrors() {
+	suite.setWebDAVController()
+	w := suite.webDAV("PROPFIND", "notexists", map[string]string{"Depth": "0"}, "")
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+	w = suite.webDAV("PROPFIND", "mytree", map[string]string{"Depth": "2"}, "")
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.webDAV("PROPFIND", "mytree", map[string]string{"Depth": "0"}, "<propfind")
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestWebDAV_proppatch() {
+	suite.setWebDAVController()
+	w := suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:set><D:prop><Z:author>Hugo &amp; co</Z:author></D:prop></D:set>
+<D:remove><D:prop><Z:editor/></D:prop></D:remove>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	props, err := suite.Service.MetaDataController.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), map[string]string{"{urn:z}author": "Hugo & co"}, props)
+
+	// properties set through the API are in PropertyNamespace.
+	require.Nil(suite.T(), suite.Service.MetaDataController.SetProperties(user, "mytree", map[string]string{"color": "red"}))
+	ms := suite.propfind("mytree", "0", "")
+	props = ms.props(webDAVURL+"mytree/", "200")
+	require.Equal(suite.T(), "Hugo &amp; co", props["author"])
+	require.Equal(suite.T(), "red", props["color"])
+
+	// live properties cannot be changed, so nothing is.
+	w = suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:set><D:prop><D:displayname>x</D:displayname><Z:author>x</Z:author></D:prop></D:set>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code)
+	ms = &testMultistatus{}
+	require.Nil(suite.T(), xml.Unmarshal(w.Body.Bytes(), ms))
+	require.Contains(suite.T(), ms.props(webDAVURL+"mytree/", "403"), "displayname")
+	require.Contains(suite.T(), ms.props(webDAVURL+"mytree/", "424"), "author")
+	props, err = suite.Service.MetaDataController.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), "Hugo & co", props["{urn:z}author"])
+}
+
+func (suite *TestSuite) TestWebDAV_proppatchInDocumentOrder() {
+	suite.setWebDAVController()
+	w := suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:set><D:prop><Z:author>x</Z:author><Z:editor>y</Z:editor></D:prop></D:set>
+<D:remove><D:prop><Z:author/></D:prop></D:remove>
+<D:set><D:prop><Z:editor>z</Z:editor></D:prop></D:set>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	props, err := suite.Service.MetaDataController.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), map[string]string{"{urn:z}editor": "z"}, props)
+
+	w = suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:remove><D:prop><Z:editor/></D:prop></D:remove>
+<D:set><D:prop><Z:editor>w</Z:editor></D:prop></D:set>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	props, err = suite.Service.MetaDataController.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), map[string]string{"{urn:z}editor": "w"}, props)
+}
+
+// failingRemoveController fails the first time it removes properties.
+type failingRemoveController struct {
+	metadatacontroller.MetaDataController
+	failed bool
+}
+
+func (c *failingRemoveController) RemoveProperties(user *entities.User, pathSpec string, keys []string) error {
+	if !c.failed {
+		c.failed = true
+		return errors.New("cannot remove properties")
+	}
+	return c.MetaDataController.RemoveProperties(user, pathSpec, keys)
+}
+
+func (suite *TestSuite) TestWebDAV_proppatchWithFailure() {
+	suite.setWebDAVController()
+	c := suite.Service.MetaDataController
+	require.Nil(suite.T(), c.SetProperties(user, "mytree", map[string]string{"color": "red"}))
+	suite.Service.MetaDataController = &failingRemoveController{MetaDataController: c}
+	w := suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:set><D:prop><Z:author>x</Z:author></D:prop></D:set>
+<D:remove><D:prop><color xmlns="`+PropertyNamespace+`"/></D:prop></D:remove>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	ms := &testMultistatus{}
+	require.Nil(suite.T(), xml.Unmarshal(w.Body.Bytes(), ms))
+	require.Len(suite.T(), ms.props(webDAVURL+"mytree/", "500"), 2)
+	props, err := c.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), map[string]string{"color": "red"}, props)
+}
+
+func (suite *TestSuite) TestWebDAV_proppatchWithInvalidProperties() {
+	suite.setWebDAVController()
+	require.Nil(suite.T(), suite.Service.MetaDataController.SetProperties(user, "mytree", map[string]string{"color": "red"}))
+	long := strings.Repeat("x", metadatacontroller.MaxPropertyValueLen+1)
+	w := suite.webDAV("PROPPATCH", "mytree", nil, `<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:z">
+<D:set><D:prop><Z:author>x</Z:author><Z:title>`+long+`</Z:title></D:prop></D:set>
+<D:remove><D:prop><color xmlns="`+PropertyNamespace+`"/></D:prop></D:remove>
+</D:propertyupdate>`)
+	require.Equal(suite.T(), http.StatusMultiStatus, w.Code, w.Body.String())
+	ms := &testMultistatus{}
+	require.Nil(suite.T(), xml.Unmarshal(w.Body.Bytes(), ms))
+	require.Equal(suite.T(), []string{"title"}, propNames(ms.props(webDAVURL+"mytree/", "409")))
+	names := propNames(ms.props(webDAVURL+"mytree/", "424"))
+	sort.Strings(names)
+	require.Equal(suite.T(), []string{"author", "color"}, names)
+	props, err := suite.Service.MetaDataController.GetProperties(user, "mytree")
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), map[string]string{"color": "red"}, props)
+}
+
+func (suite *TestSuite) TestWebDAV_mkcol() {
+	suite.setWebDAVController()
+	require.Equal(suite.T(), http.StatusCreated, suite.webDAV("MKCOL", "othertree", nil, "").Code)
+	require.Equal(suite.T(), http.StatusMethodNotAllowed, suite.webDAV("MKCOL", "othertree", nil, "").Code)
+	require.Equal(suite.T(), http.StatusConflict, suite.webDAV("MKCOL", "notexists/tree", nil, "").Code)
+	require.Equal(suite.T(), http.StatusUnsupportedMediaType, suite.webDAV("MKCOL", "newtree", nil, "<x/>").Code)
+}
+
+func (suite *TestSuite) TestWebDAV_moveAndCopy() {
+	suite.setWebDAVController()
+	dest := func(pathSpec string) map[string]string {
+		return map[string]string{"Destination": webDAVURL + pathSpec}
+	}
+	w := suite.webDAV("COPY", "mytree", dest("copiedtree"), "")
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+	_, err := suite.Service.MetaDataController.ExamineObject(user, "copiedtree/my blob.txt")
+	require.Nil(suite.T(), err)
+
+	w = suite.webDAV("MOVE", "mytree/my%20blob.txt", dest("movedblob"), "")
+	require.Equal(suite.T(), http.StatusCreated, w.Code)
+	_, err = suite.Service.MetaDataController.ExamineObject(user, "movedblob")
+	require.Nil(suite.T(), err)
+
+	header := dest("movedblob")
+	header["Overwrite"] = "F"
+	w = suite.webDAV("MOVE", "copiedtree/my%20blob.txt", header, "")
+	require.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	w = suite.webDAV("MOVE", "copiedtree/my%20blob.txt", dest("movedblob"), "")
+	require.Equal(suite.T(), http.StatusNoContent, w.Code)
+
+	w = suite.webDAV("MOVE", "notexists", dest("othertree"), "")
+	require.Equal(suite.T(), http.StatusNotFound, w.Code)
+	w = suite.webDAV("MOVE", "movedblob", dest("notexists/blob"), "")
+	require.Equal(suite.T(), http.StatusConflict, w.Code)
+	w = suite.webDAV("MOVE", "movedblob", map[string]string{"Destination": "/other/movedblob"}, "")
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+	w = suite.webDAV("MOVE", "movedblob", map[string]string{"Destination": "http://example.com" + webDAVURL + "blob"}, "")
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+}
+
+func (suite *TestSuite) TestWebDAV_overwriteTree() {
+	suite.setWebDAVController()
+	c := suite.Service.MetaDataController
+	require.Nil(suite.T(), c.CreateTree(user, "othertree", false))
+	require.Nil(suite.T(), c.(metadatacontroller.BLOBPutter).PutBLOB(user, "othertree/other.txt", 5, ""))
+	oinfo, err := c.ExamineObject(user, "mytree")
+	require.Nil(suite.T(), err)
+	header := map[string]string{"Destination": webDAVURL + "othertree"}
+
+	// the overwritten tree is restored if the move fails.
+	header["If-Match"] = `"notmatching"`
+	w := suite.webDAV("MOVE", "mytree", header, "")
+	require.Equal(suite.T(), http.StatusPreconditionFailed, w.Code)
+	_, err = c.ExamineObject(user, "othertree/other.txt")
+	require.Nil(suite.T(), err)
+
+	header["If-Match"] = `"` + metadatacontroller.GetETag(oinfo) + `"`
+	w = suite.webDAV("MOVE", "mytree", header, "")
+	require.Equal(suite.T(), http.StatusNoContent, w.Code)
+	_, err = c.ExamineObject(user, "othertree/my blob.txt")
+	require.Nil(suite.T(), err)
+	_, err = c.ExamineObject(user, "othertree/other.txt")
+	require.NotNil(suite.T(), err)
+	oinfos, _, err := c.ListTree(user, "/", nil)
+	require.Nil(suite.T(), err)
+	require.Equal(suite.T(), 1, len(oinfos))
+}
+
+func (suite *TestSuite) TestWebDAV_delete() {
+	suite.setWebDAVController()
+	require.Equal(suite.T(), http.StatusNoContent, suite.webDAV("DELETE", "mytree", nil, "").Code)
+	require.Equal(suite.T(), http.StatusNotFound, suite.webDAV("DELETE", "mytree", nil, "").Code)
+}
+
+func (suite *TestSuite) TestWebDAV_options() {
+	w := suite.webDAV("OPTIONS", "", nil, "")
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	require.Equal(suite.T(), "1", w.Header().Get("DAV"))
+	require.Contains(suite.T(), w.Header().Get("Allow"), "PROPFIND")
+}
+
+func propNames(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PropertyNamespace is the XML namespace under which the properties of
+// the objects are exposed over WebDAV. Properties set over WebDAV in other
+// namespaces are kept with their key in Clark notation, {namespace}name.
+const PropertyNamespace = "https://github.com/clawio/metadata/properties"
+
+const davNamespace = "DAV:"
+
+// davProp is a property of a PROPFIND or PROPPATCH request.
+type davProp struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// davProps are the properties inside a DAV:prop element.
+type davProps []davProp
+
+// UnmarshalXML decodes every child element as a property.
+func (props *davProps) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			prop := davProp{}
+			if err := d.DecodeElement(&prop, &t); err != nil {
+				return err
+			}
+			*props = append(*props, prop)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type propfind struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     davProps  `xml:"DAV: prop"`
+}
+
+// propertyupdate is the body of a PROPPATCH request, with its set and
+// remove instructions in document order, as they must be applied.
+type propertyupdate struct {
+	Updates []davPropUpdate
+}
+
+// davPropUpdate is a set or remove instruction of a propertyupdate.
+type davPropUpdate struct {
+	Remove bool     `xml:"-"`
+	Prop   davProps `xml:"DAV: prop"`
+}
+
+// UnmarshalXML decodes the set and remove children in order, skipping
+// unknown elements.
+func (pu *propertyupdate) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name != (xml.Name{Space: davNamespace, Local: "propertyupdate"}) {
+		return errors.New("expected element DAV: propertyupdate")
+	}
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Space != davNamespace || (t.Name.Local != "set" && t.Name.Local != "remove") {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			update := davPropUpdate{Remove: t.Name.Local == "remove"}
+			if err := d.DecodeElement(&update, &t); err != nil {
+				return err
+			}
+			pu.Updates = append(pu.Updates, update)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// multistatus is the body of the 207 Multi-Status responses. The names
+// of the DAV: elements carry their prefix, as encoding/xml cannot choose
+// the prefixes of the namespaces.
+type multistatus struct {
+	XMLName   xml.Name       `xml:"D:multistatus"`
+	XMLNS     string         `xml:"xmlns:D,attr"`
+	Responses []*davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"D:href"`
+	Propstats []davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davPropValues `xml:"D:prop"`
+	Status string        `xml:"D:status"`
+}
+
+type davPropValues struct {
+	Props []davPropValue
+}
+
+// davPropValue is a property of a response, with its value as XML.
+type davPropValue struct {
+	XMLName  xml.Name
+	InnerXML string `xml:",innerxml"`
+}
+
+// newPropstat returns the propstat of props with the given HTTP status.
+func newPropstat(status int, props []davPropValue) davPropstat {
+	return davPropstat{
+		Prop:   davPropValues{props},
+		Status: "HTTP/1.1 " + strconv.Itoa(status) + " " + http.StatusText(status),
+	}
+}
+
+// responseName returns the name of a property in a response.
+func responseName(name xml.Name) xml.Name {
+	if name.Space == davNamespace {
+		return xml.Name{Local: "D:" + name.Local}
+	}
+	return name
+}
+
+func escapeXML(s string) string {
+	b := &bytes.Buffer{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []*davResponse) error {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(&multistatus{XMLNS: davNamespace, Responses: responses})
+}
+
+// writeDAVError writes a DAV:error body with the precondition that failed.
+func writeDAVError(w http.ResponseWriter, status int, condition string) error {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	_, err := io.WriteString(w, xml.Header+`<D:error xmlns:D="`+davNamespace+`"><D:`+condition+`/></D:error>`)
+	return err
+}
+
+// propertyKey returns the key of the object property exposed as name.
+func propertyKey(name xml.Name) string {
+	if name.Space == PropertyNamespace {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// propertyName returns the name under which the object property key is
+// exposed, and false if it is not a valid XML name.
+func propertyName(key string) (xml.Name, bool) {
+	name := xml.Name{Space: PropertyNamespace, Local: key}
+	if strings.HasPrefix(key, "{") {
+		end := strings.Index(key, "}")
+		if end < 0 {
+			return name, false
+		}
+		name = xml.Name{Space: key[1:end], Local: key[end+1:]}
+	}
+	return name, name.Space != davNamespace && isXMLName(name.Local)
+}
+
+func isXMLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
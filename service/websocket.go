@@ -0,0 +1,207 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/NYTimes/gizmo/server"
+	"github.com/Sirupsen/logrus"
+	"github.com/clawio/entities"
+	"github.com/clawio/keys"
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/gorilla/context"
+	"github.com/gorilla/websocket"
+)
+
+// Types of the messages exchanged over the WebSocket of Subscribe.
+const (
+	// SubscribeMessage subscribes the client to the changes of the
+	// objects under PathSpec. It is sent back once subscribed.
+	SubscribeMessage = "subscribe"
+	// UnsubscribeMessage removes a subscription of the client.
+	// It is sent back once unsubscribed.
+	UnsubscribeMessage = "unsubscribe"
+	// ChangeMessage carries a change under a path subscribed.
+	ChangeMessage = "change"
+	// ResyncMessage is sent before closing the connection of a client
+	// that fell behind. The client has to read the subscribed trees
+	// again or the changes missed from the journal.
+	ResyncMessage = "resync"
+	// ErrorMessage answers the messages that cannot be understood.
+	ErrorMessage = "error"
+)
+
+// WebSocketTokenProtocol is the WebSocket subprotocol requested by the
+// clients that cannot set the Authorization header, like browsers, which
+// send the JWT as the next subprotocol. The connection is opened with
+// this subprotocol, so the token is never sent back.
+const WebSocketTokenProtocol = "clawio.jwt"
+
+const (
+	// webSocketWriteWait is the time allowed to write a message.
+	webSocketWriteWait = 10 * time.Second
+	// webSocketPingPeriod is the interval of the pings sent to keep
+	// idle connections open through proxies.
+	webSocketPingPeriod = 30 * time.Second
+	// webSocketPongWait is the time allowed to read the next message
+	// or the pong of a ping before the connection is closed.
+	webSocketPongWait = 2 * webSocketPingPeriod
+	// webSocketMaxMessageSize is the size of the largest message
+	// accepted from clients.
+	webSocketMaxMessageSize = 8192
+)
+
+// WebSocketMessage is a message exchanged over the WebSocket of Subscribe.
+type WebSocketMessage struct {
+	Type     string
+	PathSpec string                     `json:",omitempty"`
+	Change   *metadatacontroller.Change `json:",omitempty"`
+	Error    string                     `json:",omitempty"`
+}
+
+var upgrader = &websocket.Upgrader{Subprotocols: []string{WebSocketTokenProtocol}}
+
+// Subscribe upgrades the request to a WebSocket over which the client
+// subscribes to and unsubscribes from trees and receives the changes of
+// the objects under them, the source or the target of moves and copies.
+// Clients reading the changes slower than they happen are sent a
+// ResyncMessage and disconnected.
+func (s *Service) Subscribe(w http.ResponseWriter, r *http.Request) {
+	cc, ok := s.changesController(w)
+	if !ok {
+		return
+	}
+	user := context.Get(r, keys.UserKey).(*entities.User)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request.
+		server.Log.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("websocket cannot be opened")
+		return
+	}
+	defer conn.Close()
+	sub := cc.SubscribeChanges(user)
+	defer sub.Close()
+
+	// messages are read by another goroutine, so
+	// the connection is only written from this one.
+	msgs := make(chan *WebSocketMessage)
+	done := make(chan struct{})
+	defer close(done)
+	conn.SetReadLimit(webSocketMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+	})
+	go func() {
+		defer close(msgs)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg := &WebSocketMessage{}
+			if err := json.Unmarshal(data, msg); err != nil {
+				msg = &WebSocketMessage{Type: ErrorMessage, Error: err.Error()}
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	prefixes := map[string]bool{}
+	ping := time.NewTicker(webSocketPingPeriod)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			err = s.handleWebSocketMessage(conn, prefixes, msg)
+		case change, ok := <-sub.C:
+			if !ok {
+				server.Log.WithFields(logrus.Fields{
+					"user": user.Username,
+				}).Warn("websocket subscriber dropped")
+				writeWebSocketMessage(conn, &WebSocketMessage{Type: ResyncMessage})
+				return
+			}
+			if isSubscribed(prefixes, change) {
+				err = writeWebSocketMessage(conn, &WebSocketMessage{Type: ChangeMessage, Change: change})
+			}
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteWait))
+		}
+		if err != nil {
+			server.Log.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("websocket closed")
+			return
+		}
+	}
+}
+
+func (s *Service) handleWebSocketMessage(conn *websocket.Conn, prefixes map[string]bool, msg *WebSocketMessage) error {
+	switch msg.Type {
+	case SubscribeMessage:
+		prefixes[cleanPathSpec(msg.PathSpec)] = true
+	case UnsubscribeMessage:
+		delete(prefixes, cleanPathSpec(msg.PathSpec))
+	case ErrorMessage:
+		// the message could not be decoded.
+	default:
+		msg = &WebSocketMessage{Type: ErrorMessage, Error: "unknown message type " + msg.Type}
+	}
+	return writeWebSocketMessage(conn, msg)
+}
+
+func writeWebSocketMessage(conn *websocket.Conn, msg *WebSocketMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+// isSubscribed reports whether the object changed, or the target of a
+// move or a copy, is under one of the prefixes.
+func isSubscribed(prefixes map[string]bool, change *metadatacontroller.Change) bool {
+	for _, p := range []string{change.PathSpec, change.TargetPathSpec} {
+		if p == "" {
+			continue
+		}
+		p = cleanPathSpec(p)
+		for prefix := range prefixes {
+			if prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func cleanPathSpec(pathSpec string) string {
+	return path.Clean("/" + pathSpec)
+}
+
+// tokenFromProtocol copies the token sent after WebSocketTokenProtocol
+// in the subprotocols of the requests without an Authorization header
+// into it, as browsers cannot set headers when opening a WebSocket. The
+// token is not taken from the URL, which would put it in the logs.
+func tokenFromProtocol(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		protocols := websocket.Subprotocols(r)
+		for i, protocol := range protocols {
+			if protocol == WebSocketTokenProtocol && i+1 < len(protocols) && r.Header.Get("Authorization") == "" {
+				r.Header.Set("Authorization", "Bearer "+protocols[i+1])
+			}
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/clawio/metadata/metadatacontroller"
+	"github.com/clawio/metadata/metadatacontroller/memory"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// dialWebSocket opens the WebSocket of the service requesting the given
+// subprotocols and returns it with the function closing it with the server.
+func (suite *TestSuite) dialWebSocket(header http.Header, query string, protocols ...string) (*websocket.Conn, *http.Response, func()) {
+	ts := httptest.NewServer(suite.Server)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + wsURL + query
+	dialer := &websocket.Dialer{Subprotocols: protocols}
+	conn, res, err := dialer.Dial(url, header)
+	if err != nil {
+		ts.Close()
+		return nil, res, func() {}
+	}
+	return conn, res, func() {
+		conn.Close()
+		ts.Close()
+	}
+}
+
+func (suite *TestSuite) requireWebSocketMessage(conn *websocket.Conn, typ string) *WebSocketMessage {
+	msg := &WebSocketMessage{}
+	require.Nil(suite.T(), conn.ReadJSON(msg))
+	require.Equal(suite.T(), typ, msg.Type, "%+v", msg)
+	return msg
+}
+
+func (suite *TestSuite) TestSubscribe() {
+	defer suite.setJournaledController()()
+	c := suite.Service.MetaDataController
+	require.Nil(suite.T(), c.CreateTree(user, "mytree", false))
+	require.Nil(suite.T(), c.CreateTree(user, "othertree", false))
+	header := http.Header{}
+	header.Set("Authorization", "bearer "+jwtToken)
+	conn, _, closeConn := suite.dialWebSocket(header, "")
+	require.NotNil(suite.T(), conn)
+	defer closeConn()
+
+	require.Nil(suite.T(), conn.WriteJSON(&WebSocketMessage{Type: SubscribeMessage, PathSpec: "mytree"}))
+	msg := suite.requireWebSocketMessage(conn, SubscribeMessage)
+	require.Equal(suite.T(), "mytree", msg.PathSpec)
+
+	// changes outside the trees subscribed are not sent.
+	require.Nil(suite.T(), c.CreateTree(user, "othertree/nested", false))
+	require.Nil(suite.T(), c.CreateTree(user, "mytree/nested", false))
+	msg = suite.requireWebSocketMessage(conn, ChangeMessage)
+	require.Equal(suite.T(), metadatacontroller.ChangeCreate, msg.Change.Op)
+	require.Equal(suite.T(), "mytree/nested", msg.Change.PathSpec)
+
+	// moves into the trees subscribed are sent.
+	require.Nil(suite.T(), c.MoveObject(user, "othertree/nested", "mytree/moved"))
+	msg = suite.requireWebSocketMessage(conn, ChangeMessage)
+	require.Equal(suite.T(), metadatacontroller.ChangeMove, msg.Change.Op)
+	require.Equal(suite.T(), "mytree/moved", msg.Change.TargetPathSpec)
+
+	require.Nil(suite.T(), conn.WriteJSON(&WebSocketMessage{Type: UnsubscribeMessage, PathSpec: "/mytree/"}))
+	suite.requireWebSocketMessage(conn, UnsubscribeMessage)
+	require.Nil(suite.T(), conn.WriteJSON(&WebSocketMessage{Type: SubscribeMessage, PathSpec: "othertree"}))
+	suite.requireWebSocketMessage(conn, SubscribeMessage)
+	require.Nil(suite.T(), c.DeleteObject(user, "mytree/moved"))
+	require.Nil(suite.T(), c.DeleteObject(user, "othertree"))
+	msg = suite.requireWebSocketMessage(conn, ChangeMessage)
+	require.Equal(suite.T(), metadatacontroller.ChangeDelete, msg.Change.Op)
+	require.Equal(suite.T(), "othertree", msg.Change.PathSpec)
+}
+
+func (suite *TestSuite) TestSubscribe_withBadMessage() {
+	defer suite.setJournaledController()()
+	conn, res, closeConn := suite.dialWebSocket(nil, "", WebSocketTokenProtocol, jwtToken)
+	require.NotNil(suite.T(), conn)
+	defer closeConn()
+	require.Equal(suite.T(), WebSocketTokenProtocol, res.Header.Get("Sec-WebSocket-Protocol"))
+	require.Nil(suite.T(), conn.WriteMessage(websocket.TextMessage, []byte("subscribe")))
+	suite.requireWebSocketMessage(conn, ErrorMessage)
+	require.Nil(suite.T(), conn.WriteJSON(&WebSocketMessage{Type: "watch"}))
+	suite.requireWebSocketMessage(conn, ErrorMessage)
+}
+
+func (suite *TestSuite) TestSubscribe_withLargeMessage() {
+	defer suite.setJournaledController()()
+	conn, _, closeConn := suite.dialWebSocket(nil, "", WebSocketTokenProtocol, jwtToken)
+	require.NotNil(suite.T(), conn)
+	defer closeConn()
+	pathSpec := strings.Repeat("a", webSocketMaxMessageSize)
+	require.Nil(suite.T(), conn.WriteJSON(&WebSocketMessage{Type: SubscribeMessage, PathSpec: pathSpec}))
+	// the connection is closed without answering.
+	require.NotNil(suite.T(), conn.ReadJSON(&WebSocketMessage{}))
+}
+
+func (suite *TestSuite) TestSubscribe_withTokenInQuery() {
+	defer suite.setJournaledController()()
+	conn, res, closeConn := suite.dialWebSocket(nil, "?token="+jwtToken)
+	defer closeConn()
+	require.Nil(suite.T(), conn)
+	require.Equal(suite.T(), http.StatusUnauthorized, res.StatusCode)
+}
+
+func (suite *TestSuite) TestSubscribe_withoutToken() {
+	defer suite.setJournaledController()()
+	conn, res, closeConn := suite.dialWebSocket(nil, "")
+	defer closeConn()
+	require.Nil(suite.T(), conn)
+	require.Equal(suite.T(), http.StatusUnauthorized, res.StatusCode)
+}
+
+func (suite *TestSuite) TestSubscribe_withoutJournal() {
+	suite.Service.MetaDataController = memory.New()
+	header := http.Header{}
+	header.Set("Authorization", "bearer "+jwtToken)
+	conn, res, closeConn := suite.dialWebSocket(header, "")
+	defer closeConn()
+	require.Nil(suite.T(), conn)
+	require.Equal(suite.T(), http.StatusNotImplemented, res.StatusCode)
+}
+
+func (suite *TestSuite) TestIsSubscribed() {
+	change := &metadatacontroller.Change{PathSpec: "a/b", TargetPathSpec: "c"}
+	require.False(suite.T(), isSubscribed(map[string]bool{}, change))
+	require.True(suite.T(), isSubscribed(map[string]bool{"/": true}, change))
+	require.True(suite.T(), isSubscribed(map[string]bool{"/a": true}, change))
+	require.True(suite.T(), isSubscribed(map[string]bool{"/a/b": true}, change))
+	require.True(suite.T(), isSubscribed(map[string]bool{"/c": true}, change))
+	require.False(suite.T(), isSubscribed(map[string]bool{"/a/bc": true}, change))
+	require.False(suite.T(), isSubscribed(map[string]bool{"/ab": true}, change))
+}